@@ -0,0 +1,131 @@
+// Package cache holds read-through caches for the queries package.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cache is safe for concurrent use. Values must not be modified after Set.
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	Delete(key string)
+	Purge()
+}
+
+// Nop caches nothing.
+type Nop struct{}
+
+func (Nop) Get(key string) (interface{}, bool) { return nil, false }
+func (Nop) Set(key string, value interface{})  {}
+func (Nop) Delete(key string)                  {}
+func (Nop) Purge()                             {}
+
+var Requests *prometheus.CounterVec
+
+func InitMetrics(ns string) {
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "cache_requests",
+		Help:      "Cache lookups by cache and result: hit or miss",
+	},
+		[]string{"cache", "result"},
+	)
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// LRU keeps at most size entries for ttl each, evicting the least
+// recently used ones first.
+type LRU struct {
+	name string
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+
+	hit, miss prometheus.Counter
+}
+
+// NewLRU creates a cache, name labels its metrics.
+func NewLRU(name string, size int, ttl time.Duration) *LRU {
+	c := &LRU{
+		name:  name,
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+	if Requests != nil {
+		c.hit = Requests.WithLabelValues(name, "hit")
+		c.miss = Requests.WithLabelValues(name, "miss")
+	}
+	return c
+}
+
+func (c *LRU) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if ok && time.Now().After(el.Value.(*entry).expires) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		if c.miss != nil {
+			c.miss.Inc()
+		}
+		return nil, false
+	}
+	if c.hit != nil {
+		c.hit.Inc()
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*entry).value, true
+}
+
+func (c *LRU) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key, value, expires})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *LRU) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = map[string]*list.Element{}
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
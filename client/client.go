@@ -0,0 +1,140 @@
+// Package client is a Go client for the forum API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mailru/easyjson"
+)
+
+type Client struct {
+	// BaseURL is the server address without the /api prefix,
+	// e.g. http://localhost:5000.
+	BaseURL    string
+	HTTPClient *http.Client
+	// MaxRetries limits how many times idempotent calls are repeated
+	// after network errors and 429, 502, 503 or 504 responses.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, it doubles
+	// with every attempt.
+	RetryBackoff time.Duration
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		MaxRetries:   3,
+		RetryBackoff: 100 * time.Millisecond,
+	}
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+type request struct {
+	method     string
+	path       string // relative to /api, query included
+	body       easyjson.Marshaler
+	idempotent bool
+}
+
+func (c *Client) do(ctx context.Context, req *request) (*response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		body, err = easyjson.Marshal(req.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	attempts := 1
+	if req.idempotent {
+		attempts += c.MaxRetries
+	}
+	backoff := c.RetryBackoff
+	var (
+		res *response
+		err error
+	)
+	for i := 0; i < attempts; i++ {
+		if i != 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		res, err = c.roundTrip(ctx, req.method, req.path, body)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if !isRetryableStatus(res.status) {
+			return res, nil
+		}
+	}
+	return res, err
+}
+
+func (c *Client) roundTrip(ctx context.Context, method, path string, body []byte) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: respBody}, nil
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// call performs req and decodes the body into out if the response has
+// the wanted status.
+func (c *Client) call(ctx context.Context, req *request, want int, out easyjson.Unmarshaler) (*response, error) {
+	res, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.status != want {
+		return res, statusError(res)
+	}
+	if out != nil {
+		err = easyjson.Unmarshal(res.body, out)
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// server answers with the statuses in order, the last one repeats, and
+// keeps the times requests came at.
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	body     string
+	hits     []time.Time
+}
+
+func newServer(t *testing.T, body string, statuses ...int) *server {
+	s := &server{statuses: statuses, body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := len(s.hits)
+		s.hits = append(s.hits, time.Now())
+		s.mu.Unlock()
+		status := s.statuses[len(s.statuses)-1]
+		if n < len(s.statuses) {
+			status = s.statuses[n]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(s.body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) count() int {
+	return len(s.times())
+}
+
+func (s *server) times() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.hits...)
+}
+
+func newClient(url string) *Client {
+	c := New(url)
+	c.RetryBackoff = time.Millisecond
+	return c
+}
+
+func TestRetriesIdempotentCalls(t *testing.T) {
+	s := newServer(t, `{"id": 42, "title": "t", "author": "a", "forum": "f", "message": "m"}`,
+		http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+	res, err := newClient(s.URL).GetThread(context.Background(), "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ThreadID != 42 {
+		t.Errorf("got thread %d, want 42", res.ThreadID)
+	}
+	if n := s.count(); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+}
+
+func TestDoesNotRetryOtherCalls(t *testing.T) {
+	s := newServer(t, `{"message": "busy"}`, http.StatusServiceUnavailable, http.StatusCreated)
+	_, err := newClient(s.URL).CreateThread(context.Background(), "f", &models.Thread{})
+	se := &StatusError{}
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable || se.Message != "busy" {
+		t.Errorf("got error %#v, want StatusError 503 busy", err)
+	}
+	if n := s.count(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestRetriesAreLimited(t *testing.T) {
+	s := newServer(t, "", http.StatusTooManyRequests)
+	c := newClient(s.URL)
+	c.MaxRetries = 2
+	_, err := c.GetForum(context.Background(), "f")
+	se := &StatusError{}
+	if !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got error %#v, want StatusError 429", err)
+	}
+	if n := s.count(); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	s := newServer(t, "", http.StatusGatewayTimeout)
+	c := newClient(s.URL)
+	c.MaxRetries = 3
+	c.RetryBackoff = 20 * time.Millisecond
+	c.GetForum(context.Background(), "f")
+
+	hits := s.times()
+	if len(hits) != 4 {
+		t.Fatalf("got %d requests, want 4", len(hits))
+	}
+	want := c.RetryBackoff
+	for i := 1; i < len(hits); i++ {
+		if gap := hits[i].Sub(hits[i-1]); gap < want {
+			t.Errorf("retry %d came after %v, want at least %v", i, gap, want)
+		}
+		want *= 2
+	}
+}
+
+func TestBackoffStopsOnContextDone(t *testing.T) {
+	s := newServer(t, "", http.StatusServiceUnavailable)
+	c := newClient(s.URL)
+	c.RetryBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetForum(ctx, "f")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("call returned after %v, the backoff was not cut short", d)
+	}
+	if n := s.count(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestRetriesNetworkErrors(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		n := hits
+		mu.Unlock()
+		if n == 1 {
+			// drop the connection without an answer
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		w.Write([]byte(`{"forum": 1, "post": 2, "thread": 3, "user": 4}`))
+	}))
+	defer s.Close()
+
+	res, err := newClient(s.URL).Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Post != 2 {
+		t.Errorf("got status %+v", res)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits != 2 {
+		t.Errorf("got %d requests, want 2", hits)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		call   func(c *Client) error
+		check  func(err error) bool
+	}{
+		{
+			"not found", http.StatusNotFound, `{"message": "no such user"}`,
+			func(c *Client) error { _, err := c.GetUser(ctx, "nobody"); return err },
+			func(err error) bool {
+				e := &RecordNotFoundError{}
+				return errors.As(err, &e) && e.Message == "no such user"
+			},
+		},
+		{
+			"conflict", http.StatusConflict, `{"message": "email is taken"}`,
+			func(c *Client) error { _, err := c.UpdateUser(ctx, "u", &models.ForumUser{}); return err },
+			func(err error) bool {
+				e := &UniqueFieldValueAlreadyExistsError{}
+				return errors.As(err, &e) && e.Message == "email is taken"
+			},
+		},
+		{
+			"bad request", http.StatusBadRequest, `{"message": "title is null"}`,
+			func(c *Client) error { _, err := c.CreateThread(ctx, "f", &models.Thread{}); return err },
+			func(err error) bool {
+				e := &BadRequestError{}
+				return errors.As(err, &e) && e.Message == "title is null"
+			},
+		},
+		{
+			"bad request without a body", http.StatusBadRequest, ``,
+			func(c *Client) error { _, err := c.GetForumThreads(ctx, "f", nil); return err },
+			func(err error) bool {
+				e := &BadRequestError{}
+				return errors.As(err, &e) && e.Error() == "bad request"
+			},
+		},
+		{
+			"undocumented status", http.StatusInternalServerError, `oops`,
+			func(c *Client) error { _, err := c.GetPost(ctx, 1, nil); return err },
+			func(err error) bool {
+				e := &StatusError{}
+				return errors.As(err, &e) && e.StatusCode == http.StatusInternalServerError && e.Message == ""
+			},
+		},
+		{
+			"parent post in another thread", http.StatusConflict, `{"message": "parent"}`,
+			func(c *Client) error { _, err := c.CreatePosts(ctx, "1", &models.PostList{}); return err },
+			func(err error) bool { return err == ErrParentPostIsNotInThisThread },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, tt.body, tt.status)
+			err := tt.call(newClient(s.URL))
+			if !tt.check(err) {
+				t.Errorf("got error %#v", err)
+			}
+		})
+	}
+}
+
+func TestConflictReturnsExistingRecord(t *testing.T) {
+	s := newServer(t, `{"slug": "pirates", "title": "Pirates", "user": "j.sparrow"}`, http.StatusConflict)
+	res, err := newClient(s.URL).CreateForum(context.Background(), &models.Forum{ForumSlug: "pirates"})
+	e := &UniqueFieldValueAlreadyExistsError{}
+	if !errors.As(err, &e) {
+		t.Fatalf("got error %#v, want UniqueFieldValueAlreadyExistsError", err)
+	}
+	if res == nil || res.ForumUser != "j.sparrow" {
+		t.Errorf("got forum %+v, want the existing one", res)
+	}
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// Errors mirror the ones returned by the queries package on the server.
+
+var ErrParentPostIsNotInThisThread = errors.New("parent post is not found in this thread")
+
+type RecordNotFoundError struct {
+	Message string
+}
+
+type UniqueFieldValueAlreadyExistsError struct {
+	Message string
+}
+
+// BadRequestError is returned for 400 responses, which the server sends on
+// malformed input and on NullFieldError or ValidationError.
+type BadRequestError struct {
+	Message string
+}
+
+// StatusError is returned for responses the API does not document.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (s RecordNotFoundError) Error() string {
+	return s.Message
+}
+
+func (s UniqueFieldValueAlreadyExistsError) Error() string {
+	return s.Message
+}
+
+func (s BadRequestError) Error() string {
+	if s.Message == "" {
+		return "bad request"
+	}
+	return s.Message
+}
+
+func (s StatusError) Error() string {
+	if s.Message == "" {
+		return fmt.Sprintf("unexpected status %d %s", s.StatusCode, http.StatusText(s.StatusCode))
+	}
+	return fmt.Sprintf("unexpected status %d %s: %s", s.StatusCode, http.StatusText(s.StatusCode), s.Message)
+}
+
+func errorMessage(body []byte) string {
+	msg := models.ErrorMessage{}
+	if err := msg.UnmarshalJSON(body); err != nil {
+		return ""
+	}
+	return msg.Message
+}
+
+// statusError converts an error response to a typed error. Conflicts whose
+// body is the existing record are handled by the callers.
+func statusError(res *response) error {
+	msg := errorMessage(res.body)
+	switch res.status {
+	case http.StatusBadRequest:
+		return &BadRequestError{msg}
+	case http.StatusNotFound:
+		return &RecordNotFoundError{msg}
+	case http.StatusConflict:
+		return &UniqueFieldValueAlreadyExistsError{msg}
+	}
+	return &StatusError{res.status, msg}
+}
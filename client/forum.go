@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+const sinceTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// CreateForum returns the existing forum along with
+// UniqueFieldValueAlreadyExistsError if the slug is taken.
+func (c *Client) CreateForum(ctx context.Context, f *models.Forum) (*models.Forum, error) {
+	res := &models.Forum{}
+	r, err := c.call(ctx, &request{method: "POST", path: "/forum/create", body: f}, http.StatusCreated, res)
+	if err != nil {
+		if r != nil && r.status == http.StatusConflict && res.UnmarshalJSON(r.body) == nil {
+			return res, &UniqueFieldValueAlreadyExistsError{"forum with this slug already exists"}
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) GetForum(ctx context.Context, slug string) (*models.Forum, error) {
+	res := &models.Forum{}
+	_, err := c.call(ctx, &request{
+		method:     "GET",
+		path:       "/forum/" + url.PathEscape(slug) + "/details",
+		idempotent: true,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) GetForumThreads(ctx context.Context, slug string, params *models.ThreadQueryParams) (*models.ThreadList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Desc {
+			query.Set("desc", "true")
+		}
+		if params.Limit != 0 {
+			query.Set("limit", strconv.FormatUint(params.Limit, 10))
+		}
+		if !params.Since.IsZero() {
+			query.Set("since", params.Since.Format(sinceTimeLayout))
+		}
+	}
+	res := &models.ThreadList{}
+	_, err := c.call(ctx, &request{
+		method:     "GET",
+		path:       "/forum/" + url.PathEscape(slug) + "/threads" + encodeQuery(query),
+		idempotent: true,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
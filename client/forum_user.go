@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// CreateUser returns the created user as the only list element. If the
+// nickname or email is taken, the list holds the existing users and the
+// error is UniqueFieldValueAlreadyExistsError.
+func (c *Client) CreateUser(ctx context.Context, u *models.ForumUser) (*models.ForumUserList, error) {
+	created := &models.ForumUser{}
+	r, err := c.call(ctx, &request{
+		method: "POST",
+		path:   "/user/" + url.PathEscape(u.Nickname) + "/create",
+		body:   u,
+	}, http.StatusCreated, created)
+	if err != nil {
+		existing := &models.ForumUserList{}
+		if r != nil && r.status == http.StatusConflict && existing.UnmarshalJSON(r.body) == nil {
+			return existing, &UniqueFieldValueAlreadyExistsError{"user with this nickname and/or email already exists"}
+		}
+		return nil, err
+	}
+	return &models.ForumUserList{*created}, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, nickname string) (*models.ForumUser, error) {
+	res := &models.ForumUser{}
+	_, err := c.call(ctx, &request{
+		method:     "GET",
+		path:       "/user/" + url.PathEscape(nickname) + "/profile",
+		idempotent: true,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateUser changes the profile, empty fields are left as is.
+func (c *Client) UpdateUser(ctx context.Context, nickname string, u *models.ForumUser) (*models.ForumUser, error) {
+	res := &models.ForumUser{}
+	_, err := c.call(ctx, &request{
+		method: "POST",
+		path:   "/user/" + url.PathEscape(nickname) + "/profile",
+		body:   u,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) GetForumUsers(ctx context.Context, slug string, params *models.UserQueryParams) (*models.ForumUserList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Desc {
+			query.Set("desc", "true")
+		}
+		if params.Limit != 0 {
+			query.Set("limit", strconv.FormatUint(params.Limit, 10))
+		}
+		if params.Since != "" {
+			query.Set("since", params.Since)
+		}
+	}
+	res := &models.ForumUserList{}
+	_, err := c.call(ctx, &request{
+		method:     "GET",
+		path:       "/forum/" + url.PathEscape(slug) + "/users" + encodeQuery(query),
+		idempotent: true,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// CreatePosts returns ErrParentPostIsNotInThisThread if a parent post
+// belongs to another thread or doesn't exist.
+func (c *Client) CreatePosts(ctx context.Context, slugOrID string, p *models.PostList) (*models.PostList, error) {
+	res := &models.PostList{}
+	r, err := c.call(ctx, &request{
+		method: "POST",
+		path:   "/thread/" + url.PathEscape(slugOrID) + "/create",
+		body:   p,
+	}, http.StatusCreated, res)
+	if err != nil {
+		if r != nil && r.status == http.StatusConflict {
+			return nil, ErrParentPostIsNotInThisThread
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetPost loads a post, related may contain "user", "forum" and "thread".
+func (c *Client) GetPost(ctx context.Context, id int, related []string) (*models.PostInfo, error) {
+	path := "/post/" + strconv.Itoa(id) + "/details"
+	if len(related) != 0 {
+		path += "?related=" + url.QueryEscape(strings.Join(related, ","))
+	}
+	res := &models.PostInfo{}
+	_, err := c.call(ctx, &request{method: "GET", path: path, idempotent: true}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) UpdatePost(ctx context.Context, id int, p *models.Post) (*models.Post, error) {
+	res := &models.Post{}
+	_, err := c.call(ctx, &request{
+		method: "POST",
+		path:   "/post/" + strconv.Itoa(id) + "/details",
+		body:   p,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) GetThreadPosts(ctx context.Context, slugOrID string, args *models.ThreadPostsQueryArgs) (*models.PostList, error) {
+	query := url.Values{}
+	if args != nil {
+		if args.Limit != 0 {
+			query.Set("limit", strconv.FormatUint(args.Limit, 10))
+		}
+		if args.Since != 0 {
+			query.Set("since", strconv.FormatUint(args.Since, 10))
+		}
+		if args.Sort != "" {
+			query.Set("sort", args.Sort)
+		}
+		if args.Desc {
+			query.Set("desc", "true")
+		}
+	}
+	res := &models.PostList{}
+	_, err := c.call(ctx, &request{
+		method:     "GET",
+		path:       "/thread/" + url.PathEscape(slugOrID) + "/posts" + encodeQuery(query),
+		idempotent: true,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// Clear removes all data from the server.
+func (c *Client) Clear(ctx context.Context) error {
+	_, err := c.call(ctx, &request{method: "POST", path: "/service/clear", idempotent: true}, http.StatusOK, nil)
+	return err
+}
+
+func (c *Client) Status(ctx context.Context) (*models.Status, error) {
+	res := &models.Status{}
+	_, err := c.call(ctx, &request{method: "GET", path: "/service/status", idempotent: true}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// OpenAPI fetches the API specification served by the server as YAML.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	res, err := c.do(ctx, &request{method: "GET", path: "/openapi.yml", idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	if res.status != http.StatusOK {
+		return nil, statusError(res)
+	}
+	return res.body, nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// CreateThread returns the existing thread along with
+// UniqueFieldValueAlreadyExistsError if the slug is taken.
+func (c *Client) CreateThread(ctx context.Context, forum string, t *models.Thread) (*models.Thread, error) {
+	res := &models.Thread{}
+	r, err := c.call(ctx, &request{
+		method: "POST",
+		path:   "/forum/" + url.PathEscape(forum) + "/create",
+		body:   t,
+	}, http.StatusCreated, res)
+	if err != nil {
+		if r != nil && r.status == http.StatusConflict && res.UnmarshalJSON(r.body) == nil {
+			return res, &UniqueFieldValueAlreadyExistsError{"thread with this slug already exists"}
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) GetThread(ctx context.Context, slugOrID string) (*models.Thread, error) {
+	res := &models.Thread{}
+	_, err := c.call(ctx, &request{
+		method:     "GET",
+		path:       "/thread/" + url.PathEscape(slugOrID) + "/details",
+		idempotent: true,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateThread changes title and message, empty fields are left as is.
+func (c *Client) UpdateThread(ctx context.Context, slugOrID string, t *models.Thread) (*models.Thread, error) {
+	res := &models.Thread{}
+	_, err := c.call(ctx, &request{
+		method: "POST",
+		path:   "/thread/" + url.PathEscape(slugOrID) + "/details",
+		body:   t,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,25 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// VoteForThread sets the user's voice, repeating the call doesn't change
+// the result, so it is retried like reads.
+func (c *Client) VoteForThread(ctx context.Context, slugOrID string, v *models.Vote) (*models.Thread, error) {
+	res := &models.Thread{}
+	_, err := c.call(ctx, &request{
+		method:     "POST",
+		path:       "/thread/" + url.PathEscape(slugOrID) + "/vote",
+		body:       v,
+		idempotent: true,
+	}, http.StatusOK, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ArtAndreev/ForumTP/client"
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+var errNeedsDB = errors.New("this command works with the database only, use -db")
+
+// backend is implemented on top of the HTTP API and directly on top of
+// the queries package.
+type backend interface {
+	CreateUser(u *models.ForumUser) (*models.ForumUser, error)
+	CreateForum(f *models.Forum) (*models.Forum, error)
+	CreateThread(t *models.Thread) (*models.Thread, error)
+	GetThread(slugOrID string) (*models.Thread, error)
+	GetThreadPosts(slugOrID string, args *models.ThreadPostsQueryArgs) (*models.PostList, error)
+	Status() (*models.Status, error)
+	Clear() error
+}
+
+type httpBackend struct {
+	c *client.Client
+}
+
+func (b *httpBackend) CreateUser(u *models.ForumUser) (*models.ForumUser, error) {
+	res, err := b.c.CreateUser(context.Background(), u)
+	if err != nil {
+		return nil, err
+	}
+	return &(*res)[0], nil
+}
+
+func (b *httpBackend) CreateForum(f *models.Forum) (*models.Forum, error) {
+	return b.c.CreateForum(context.Background(), f)
+}
+
+func (b *httpBackend) CreateThread(t *models.Thread) (*models.Thread, error) {
+	return b.c.CreateThread(context.Background(), t.Forum, t)
+}
+
+func (b *httpBackend) GetThread(slugOrID string) (*models.Thread, error) {
+	return b.c.GetThread(context.Background(), slugOrID)
+}
+
+func (b *httpBackend) GetThreadPosts(slugOrID string, args *models.ThreadPostsQueryArgs) (*models.PostList, error) {
+	return b.c.GetThreadPosts(context.Background(), slugOrID, args)
+}
+
+func (b *httpBackend) Status() (*models.Status, error) {
+	return b.c.Status(context.Background())
+}
+
+func (b *httpBackend) Clear() error {
+	return b.c.Clear(context.Background())
+}
+
+type dbBackend struct{}
+
+func (dbBackend) CreateUser(u *models.ForumUser) (*models.ForumUser, error) {
+	res, err := queries.CreateUser(u)
+	if err != nil {
+		return nil, err
+	}
+	return &(*res)[0], nil
+}
+
+func (dbBackend) CreateForum(f *models.Forum) (*models.Forum, error) {
+	return queries.CreateForum(f)
+}
+
+func (dbBackend) CreateThread(t *models.Thread) (*models.Thread, error) {
+	return queries.CreateThread(t)
+}
+
+func (dbBackend) GetThread(slugOrID string) (*models.Thread, error) {
+	return queries.GetThreadBySlugOrID(slugOrID)
+}
+
+func (dbBackend) GetThreadPosts(slugOrID string, args *models.ThreadPostsQueryArgs) (*models.PostList, error) {
+	return queries.GetThreadPosts(slugOrID, args)
+}
+
+func (dbBackend) Status() (*models.Status, error) {
+	return queries.GetDatabaseStatus()
+}
+
+func (dbBackend) Clear() error {
+	return queries.ClearDatabase()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+var errNotConfirmed = errors.New("this command destroys data, pass -yes to confirm")
+
+func (c *ctl) createUser(args []string) error {
+	u := &models.ForumUser{}
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	fs.StringVar(&u.Nickname, "nickname", "", "nickname")
+	fs.StringVar(&u.Fullname, "fullname", "", "full name")
+	fs.StringVar(&u.Email, "email", "", "email")
+	fs.StringVar(&u.About, "about", "", "about")
+	fs.Parse(args)
+
+	res, err := c.backend.CreateUser(u)
+	if err != nil {
+		return err
+	}
+	return c.out.print(res)
+}
+
+func (c *ctl) createForum(args []string) error {
+	f := &models.Forum{}
+	fs := flag.NewFlagSet("forum create", flag.ExitOnError)
+	fs.StringVar(&f.ForumSlug, "slug", "", "slug")
+	fs.StringVar(&f.ForumTitle, "title", "", "title")
+	fs.StringVar(&f.ForumUser, "user", "", "owner nickname")
+	fs.Parse(args)
+
+	res, err := c.backend.CreateForum(f)
+	if err != nil {
+		return err
+	}
+	return c.out.print(res)
+}
+
+func (c *ctl) createThread(args []string) error {
+	t := &models.Thread{}
+	fs := flag.NewFlagSet("thread create", flag.ExitOnError)
+	fs.StringVar(&t.Forum, "forum", "", "forum slug")
+	fs.StringVar(&t.ThreadTitle, "title", "", "title")
+	fs.StringVar(&t.ThreadAuthor, "author", "", "author nickname")
+	fs.StringVar(&t.ThreadMessage, "message", "", "message")
+	slug := fs.String("slug", "", "thread slug (optional)")
+	fs.Parse(args)
+	if *slug != "" {
+		t.ThreadSlug = slug
+	}
+
+	res, err := c.backend.CreateThread(t)
+	if err != nil {
+		return err
+	}
+	return c.out.print(res)
+}
+
+func (c *ctl) postTree(args []string) error {
+	params := &models.ThreadPostsQueryArgs{}
+	fs := flag.NewFlagSet("post tree", flag.ExitOnError)
+	thread := fs.String("thread", "", "thread slug or id")
+	fs.StringVar(&params.Sort, "sort", "tree", "tree, parent_tree or flat")
+	fs.BoolVar(&params.Desc, "desc", false, "reverse order")
+	fs.Uint64Var(&params.Limit, "limit", 0, "maximum number of posts (parent posts for parent_tree)")
+	fs.Parse(args)
+	if *thread == "" {
+		return errors.New("-thread is required")
+	}
+
+	t, err := c.backend.GetThread(*thread)
+	if err != nil {
+		return err
+	}
+	posts, err := c.backend.GetThreadPosts(*thread, params)
+	if err != nil {
+		return err
+	}
+	return c.out.printTree(t, posts)
+}
+
+func (c *ctl) status() error {
+	res, err := c.backend.Status()
+	if err != nil {
+		return err
+	}
+	return c.out.print(res)
+}
+
+func confirmed(name string, args []string) bool {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	yes := fs.Bool("yes", false, "confirm data removal")
+	fs.Parse(args)
+	return *yes
+}
+
+func (c *ctl) clear(args []string) error {
+	if !confirmed("clear", args) {
+		return errNotConfirmed
+	}
+	return c.backend.Clear()
+}
+
+func (c *ctl) reset(args []string) error {
+	if !c.dbMode {
+		return errNeedsDB
+	}
+	if !confirmed("reset", args) {
+		return errNotConfirmed
+	}
+	down, err := queries.MigrateDown(0)
+	if err != nil {
+		return err
+	}
+	up, err := queries.MigrateUp()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rolled back %d and applied %d migrations\n", down, up)
+	return nil
+}
+
+func (c *ctl) recount() error {
+	if !c.dbMode {
+		return errNeedsDB
+	}
+	return queries.RecountCounters()
+}
+
+func (c *ctl) exportDump(args []string) error {
+	if !c.dbMode {
+		return errNeedsDB
+	}
+	if len(args) == 0 || args[0] == "-" {
+		return queries.ExportDump(os.Stdout)
+	}
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	err = queries.ExportDump(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *ctl) importDump(args []string) error {
+	if !c.dbMode {
+		return errNeedsDB
+	}
+	opts := queries.ImportOptions{}
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.BoolVar(&opts.RemapIDs, "remap", false, "give threads and posts new ids")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "validate and load the data, then roll back")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("import: file is required, - reads stdin")
+	}
+
+	in := os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	res, err := queries.ImportDump(in, opts)
+	if err != nil {
+		return err
+	}
+	return c.out.print(res)
+}
+
+func (c *ctl) migrate(cmd string, args []string) error {
+	if !c.dbMode {
+		return errNeedsDB
+	}
+
+	switch cmd {
+	case "status":
+		res, err := queries.GetMigrationStatus()
+		if err != nil {
+			return err
+		}
+		return c.out.print(res)
+	case "up":
+		n, err := queries.MigrateUp()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", n)
+	case "down":
+		n := 1
+		if len(args) != 0 {
+			var err error
+			n, err = strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate down: bad number of migrations %q", args[0])
+			}
+		}
+		n, err := queries.MigrateDown(n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d migrations\n", n)
+	case "redo":
+		return queries.MigrateRedo()
+	default:
+		return fmt.Errorf("unknown command migrate %s, see forumctl -h", cmd)
+	}
+	return nil
+}
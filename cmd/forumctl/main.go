@@ -0,0 +1,117 @@
+// Command forumctl administers a forum instance either through the HTTP API
+// or directly through the database.
+//
+//	forumctl [-api URL | -db ADDRESS] [-o table|json] COMMAND [ARGS]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ArtAndreev/ForumTP/client"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+const usage = `Usage: forumctl [flags] command [args]
+
+Commands:
+  user create -nickname N -email E [-fullname F] [-about A]
+  forum create -slug S -title T -user N
+  thread create -forum S -title T -author N -message M [-slug S]
+  post tree -thread SLUG_OR_ID [-sort tree|parent_tree|flat] [-desc] [-limit N]
+  status
+  clear -yes                 remove all data
+  reset -yes                 roll back all migrations and apply them again (-db only)
+  recount                    recompute forum, thread and membership counters (-db only)
+  export [FILE]              write all data as NDJSON to FILE or stdout (-db only)
+  import [-remap] [-dry-run] FILE
+                             load an export, - reads stdin (-db only)
+  migrate status             list applied and pending migrations (-db only)
+  migrate up                 apply pending migrations (-db only)
+  migrate down [N]           roll back the last N migrations, 1 by default (-db only)
+  migrate redo               roll back the last migration and apply it again (-db only)
+
+Flags:
+`
+
+type ctl struct {
+	backend backend
+	out     *printer
+	dbMode  bool
+}
+
+func main() {
+	api := flag.String("api", "", "base URL of the forum API, e.g. http://localhost:5000")
+	dbAddr := flag.String("db", "", "database address user:password@host:port, used instead of -api")
+	dbName := flag.String("db_name", "docker", "database name")
+	migDir := flag.String("migrations", "", "directory with migrations, the ones built in are used by default")
+	format := flag.String("o", "table", "output format: table or json")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*api == "") == (*dbAddr == "") || (*format != "table" && *format != "json") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &ctl{
+		out: &printer{w: os.Stdout, json: *format == "json"},
+	}
+	if *api != "" {
+		c.backend = &httpBackend{client.New(*api)}
+	} else {
+		queries.ConnectDB(*dbAddr, *dbName).SetMaxOpenConns(4)
+		c.backend = dbBackend{}
+		c.dbMode = true
+		if *migDir != "" {
+			queries.UseMigrationsDir(*migDir)
+		}
+	}
+
+	err := c.run(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "forumctl:", err)
+		os.Exit(1)
+	}
+}
+
+func (c *ctl) run(args []string) error {
+	cmd := args[0]
+	if len(args) > 1 && (cmd == "user" || cmd == "forum" || cmd == "thread" ||
+		cmd == "post" || cmd == "migrate") {
+		cmd += " " + args[1]
+		args = args[1:]
+	}
+	args = args[1:]
+
+	switch cmd {
+	case "user create":
+		return c.createUser(args)
+	case "forum create":
+		return c.createForum(args)
+	case "thread create":
+		return c.createThread(args)
+	case "post tree":
+		return c.postTree(args)
+	case "status":
+		return c.status()
+	case "clear":
+		return c.clear(args)
+	case "reset":
+		return c.reset(args)
+	case "recount":
+		return c.recount()
+	case "export":
+		return c.exportDump(args)
+	case "import":
+		return c.importDump(args)
+	case "migrate status", "migrate up", "migrate down", "migrate redo":
+		return c.migrate(strings.TrimPrefix(cmd, "migrate "), args)
+	}
+	return fmt.Errorf("unknown command %q, see forumctl -h", cmd)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mailru/easyjson"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes a model or a list of models as JSON or as a table with
+// a column per JSON field.
+func (p *printer) print(v easyjson.Marshaler) error {
+	if p.json {
+		j, err := easyjson.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.w, string(j))
+		return err
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rows := []reflect.Value{rv}
+	if rv.Kind() == reflect.Slice {
+		rows = rows[:0]
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, rv.Index(i))
+		}
+	}
+	t := rv.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	header := []string{}
+	fields := []int{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "-" || t.Field(i).PkgPath != "" {
+			continue
+		}
+		header = append(header, strings.ToUpper(name))
+		fields = append(fields, i)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := []string{}
+		for _, i := range fields {
+			cells = append(cells, cell(row.Field(i)))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func cell(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "-"
+		}
+		v = v.Elem()
+	}
+	switch val := v.Interface().(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case string:
+		return oneLine(val)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func oneLine(s string) string {
+	s = strings.Replace(s, "\n", " ", -1)
+	if r := []rune(s); len(r) > 60 {
+		return string(r[:57]) + "..."
+	}
+	return s
+}
+
+// printTree shows posts sorted as a tree with replies indented under
+// their parents.
+func (p *printer) printTree(t *models.Thread, posts *models.PostList) error {
+	if p.json {
+		return p.print(posts)
+	}
+	fmt.Fprintf(p.w, "thread %d %q in %s by %s, %d votes\n",
+		t.ThreadID, t.ThreadTitle, t.Forum, t.ThreadAuthor, t.Votes)
+	depth := map[int]int{}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tAUTHOR\tCREATED\tEDITED\tMESSAGE")
+	for _, post := range *posts {
+		d := 0
+		if post.Parent != 0 {
+			d = depth[post.Parent] + 1
+		}
+		depth[post.PostID] = d
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%v\t%s%s\n", post.PostID, post.PostAuthor,
+			post.PostCreated.Format(time.RFC3339), post.IsEdited,
+			strings.Repeat("  ", d), oneLine(post.PostMessage))
+	}
+	return tw.Flush()
+}
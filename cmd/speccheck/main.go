@@ -0,0 +1,99 @@
+// Command speccheck verifies that the router and models agree with
+// swagger.yml. With -addr it also runs every documented operation against a
+// running server and fails on undocumented status codes or invalid bodies.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/handlers"
+	"github.com/ArtAndreev/ForumTP/live"
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/spec"
+)
+
+// documented models by their definition names
+var definitions = map[string]reflect.Type{
+	"Error":             reflect.TypeOf(models.ErrorMessage{}),
+	"Status":            reflect.TypeOf(models.Status{}),
+	"User":              reflect.TypeOf(models.ForumUser{}),
+	"Users":             reflect.TypeOf(models.ForumUserList{}),
+	"Forum":             reflect.TypeOf(models.Forum{}),
+	"ForumUpdate":       reflect.TypeOf(models.ForumUpdate{}),
+	"ForumNode":         reflect.TypeOf(models.ForumNode{}),
+	"ForumNodes":        reflect.TypeOf(models.ForumNodeList{}),
+	"Category":          reflect.TypeOf(models.Category{}),
+	"Categories":        reflect.TypeOf(models.CategoryList{}),
+	"CategoryUpdate":    reflect.TypeOf(models.CategoryUpdate{}),
+	"Thread":            reflect.TypeOf(models.Thread{}),
+	"Threads":           reflect.TypeOf(models.ThreadList{}),
+	"TagCount":          reflect.TypeOf(models.TagCount{}),
+	"TagCounts":         reflect.TypeOf(models.TagCountList{}),
+	"Post":              reflect.TypeOf(models.Post{}),
+	"Posts":             reflect.TypeOf(models.PostList{}),
+	"PostFull":          reflect.TypeOf(models.PostInfo{}),
+	"Vote":              reflect.TypeOf(models.Vote{}),
+	"Webhook":           reflect.TypeOf(models.Webhook{}),
+	"Webhooks":          reflect.TypeOf(models.WebhookList{}),
+	"WebhookDelivery":   reflect.TypeOf(models.WebhookDelivery{}),
+	"WebhookDeliveries": reflect.TypeOf(models.WebhookDeliveryList{}),
+	"Notification":      reflect.TypeOf(models.Notification{}),
+	"NotificationPage":  reflect.TypeOf(models.NotificationPage{}),
+	"NotificationsRead": reflect.TypeOf(models.NotificationsRead{}),
+	"UnreadCount":       reflect.TypeOf(models.UnreadCount{}),
+	"WatchedThread":     reflect.TypeOf(models.WatchedThread{}),
+	"WatchList":         reflect.TypeOf(models.WatchList{}),
+	"LastRead":          reflect.TypeOf(models.LastRead{}),
+	"Feed":              reflect.TypeOf(models.FeedItemList{}),
+	"Attachment":        reflect.TypeOf(models.Attachment{}),
+	"Attachments":       reflect.TypeOf(models.AttachmentList{}),
+	"UserStats":         reflect.TypeOf(models.UserStats{}),
+	"UserPost":          reflect.TypeOf(models.UserPost{}),
+	"UserPosts":         reflect.TypeOf(models.UserPostList{}),
+	"UserRename":        reflect.TypeOf(models.UserRename{}),
+}
+
+func main() {
+	specPath := flag.String("spec", "swagger.yml", "path to the API specification")
+	addr := flag.String("addr", "", "base URL of a running server to run the conformance suite against, e.g. http://localhost:5000")
+	clear := flag.Bool("clear", false, "also run /service/clear during the conformance suite (wipes all data)")
+	attachMaxSize := flag.Int64("attachment_max_size", 10<<20, "largest attachment the server accepts, as its flag of the same name")
+	flag.Parse()
+
+	s, err := spec.Load(*specPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	problems := []string{}
+	r := mux.NewRouter()
+	handlers.RegisterStreamRoutes(r, s.BasePath, handlers.NewLive(live.NewLocal(0)))
+	handlers.RegisterRoutes(r.PathPrefix(s.BasePath).Subrouter())
+	routeProblems, err := spec.CheckRouter(s, r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	problems = append(problems, routeProblems...)
+	for name, t := range definitions {
+		problems = append(problems, spec.CheckModel(s, name, t)...)
+	}
+
+	if *addr != "" {
+		problems = append(problems, runSuite(s, *addr, *clear, *attachMaxSize)...)
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) != 0 {
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+}
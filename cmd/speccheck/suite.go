@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+	"github.com/ArtAndreev/ForumTP/spec"
+)
+
+type suite struct {
+	spec     *spec.Spec
+	addr     string
+	client   *http.Client
+	problems []string
+	covered  map[string]bool // "METHOD path status"
+	// statuses the configuration of the server rules out
+	unreachable map[string]bool
+
+	// largest attachment the server accepts
+	attachmentMaxSize int64
+
+	// records made by the base steps that the steps of features build on
+	nick, other, forum, slug, missing string
+	threadID, postID                  string
+}
+
+// call performs a request to the operation with the given path template and
+// checks the response against the spec and the expected status.
+func (st *suite) call(method, tpl, path, body string, want int) []byte {
+	_, respBody := st.send(method, tpl, path, body, nil, want)
+	return respBody
+}
+
+// send is call with request headers that returns the response too, its
+// body is read already unless it is an event stream. Redirects are not
+// followed. Any of several statuses may be wanted where the configuration
+// of the server decides between them.
+func (st *suite) send(method, tpl, path, body string, header http.Header, want ...int) (*http.Response, []byte) {
+	op := st.spec.Operation(method, tpl)
+	if op == nil {
+		st.problems = append(st.problems, fmt.Sprintf("suite: %s %s is not documented", method, tpl))
+		return nil, nil
+	}
+	req, err := http.NewRequest(method, st.addr+st.spec.BasePath+path, strings.NewReader(body))
+	if err != nil {
+		st.problems = append(st.problems, fmt.Sprintf("%s: %v", op, err))
+		return nil, nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := st.client.Do(req)
+	if err != nil {
+		st.problems = append(st.problems, fmt.Sprintf("%s: %v", op, err))
+		return nil, nil
+	}
+	defer resp.Body.Close()
+	var respBody []byte
+	// event streams never end, only their status is checked
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		respBody, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			st.problems = append(st.problems, fmt.Sprintf("%s: %v", op, err))
+			return nil, nil
+		}
+	}
+
+	st.covered[fmt.Sprintf("%s %d", op, resp.StatusCode)] = true
+	if !wanted(resp.StatusCode, want) {
+		st.problems = append(st.problems, fmt.Sprintf("%s %s: got status %d, want %v: %s",
+			method, path, resp.StatusCode, want, bytes.TrimSpace(respBody)))
+	}
+	for _, v := range st.spec.ValidateResponse(op, resp.StatusCode, respBody) {
+		st.problems = append(st.problems, v.Error())
+	}
+	return resp, respBody
+}
+
+func wanted(status int, want []int) bool {
+	for _, w := range want {
+		if status == w {
+			return true
+		}
+	}
+	return false
+}
+
+// skip takes statuses of an operation out of the coverage check.
+func (st *suite) skip(method, tpl string, codes ...int) {
+	for _, code := range codes {
+		st.unreachable[fmt.Sprintf("%s %s %d", method, tpl, code)] = true
+	}
+}
+
+func runSuite(s *spec.Spec, addr string, clear bool, attachmentMaxSize int64) []string {
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	st := &suite{
+		spec: s,
+		addr: strings.TrimRight(addr, "/"),
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		covered:           map[string]bool{},
+		unreachable:       map[string]bool{},
+		attachmentMaxSize: attachmentMaxSize,
+		nick:              "suite_" + suffix,
+		other:             "suite_other_" + suffix,
+		forum:             "suite-" + suffix,
+		slug:              "suite-thread-" + suffix,
+		missing:           "suite-missing-" + suffix,
+	}
+
+	if clear {
+		st.call("POST", "/service/clear", "/service/clear", "", http.StatusOK)
+	}
+	// features build on the records of the base steps
+	if !st.base() {
+		return st.finish()
+	}
+	st.conditional()
+	st.live()
+	st.webhooks()
+	st.call("GET", "/events", "/events?after=0&limit=10&timeout=0", "", http.StatusOK)
+	st.call("GET", "/events", "/events?limit=0", "", http.StatusBadRequest)
+	st.notifications()
+	st.watch()
+	st.attachments()
+	st.avatars()
+	stats := "/user/" + st.nick + "/stats"
+	if etag := st.etag("/user/{nickname}/stats", stats); etag != "" {
+		st.send("GET", "/user/{nickname}/stats", stats, "", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+	}
+	st.call("GET", "/user/{nickname}/stats", "/user/"+st.missing+"/stats", "", http.StatusNotFound)
+	st.authored()
+	st.rename()
+	st.deletion()
+	st.categories()
+	st.tags()
+	st.call("GET", "/service/status", "/service/status", "", http.StatusOK)
+
+	return st.finish()
+}
+
+// base runs the operations of the original API, it reports whether the
+// records later steps need were made.
+func (st *suite) base() bool {
+	nick, other, forum, slug, missing := st.nick, st.other, st.forum, st.slug, st.missing
+
+	// users
+	user := `{"fullname": "Suite User", "email": "` + nick + `@example.com", "about": "conformance"}`
+	st.call("POST", "/user/{nickname}/create", "/user/"+nick+"/create", user, http.StatusCreated)
+	st.call("POST", "/user/{nickname}/create", "/user/"+nick+"/create", user, http.StatusConflict)
+	st.call("POST", "/user/{nickname}/create", "/user/"+other+"/create",
+		`{"fullname": "Other", "email": "`+other+`@example.com"}`, http.StatusCreated)
+	st.call("GET", "/user/{nickname}/profile", "/user/"+nick+"/profile", "", http.StatusOK)
+	st.call("GET", "/user/{nickname}/profile", "/user/"+missing+"/profile", "", http.StatusNotFound)
+	st.call("POST", "/user/{nickname}/profile", "/user/"+nick+"/profile", `{"about": "updated"}`, http.StatusOK)
+	st.call("POST", "/user/{nickname}/profile", "/user/"+missing+"/profile", `{"about": "updated"}`, http.StatusNotFound)
+	st.call("POST", "/user/{nickname}/profile", "/user/"+nick+"/profile",
+		`{"email": "`+other+`@example.com"}`, http.StatusConflict)
+
+	// forums
+	f := `{"slug": "` + forum + `", "title": "Suite forum", "user": "` + nick + `"}`
+	st.call("POST", "/forum/create", "/forum/create", f, http.StatusCreated)
+	st.call("POST", "/forum/create", "/forum/create", f, http.StatusConflict)
+	st.call("POST", "/forum/create", "/forum/create",
+		`{"slug": "`+missing+`", "title": "Suite forum", "user": "`+missing+`"}`, http.StatusNotFound)
+	st.call("GET", "/forum/{slug}/details", "/forum/"+forum+"/details", "", http.StatusOK)
+	st.call("GET", "/forum/{slug}/details", "/forum/"+missing+"/details", "", http.StatusNotFound)
+
+	// threads
+	t := `{"slug": "` + slug + `", "title": "Suite thread", "author": "` + nick + `", "message": "hello",
+		"created": "2017-01-01T00:00:00.000Z"}`
+	body := st.call("POST", "/forum/{slug}/create", "/forum/"+forum+"/create", t, http.StatusCreated)
+	thread := &models.Thread{}
+	if err := thread.UnmarshalJSON(body); err != nil {
+		st.problems = append(st.problems, "suite: cannot continue without a thread: "+err.Error())
+		return false
+	}
+	threadID := strconv.Itoa(thread.ThreadID)
+	st.threadID = threadID
+	st.call("POST", "/forum/{slug}/create", "/forum/"+forum+"/create", t, http.StatusConflict)
+	st.call("POST", "/forum/{slug}/create", "/forum/"+missing+"/create",
+		`{"title": "Suite thread", "author": "`+nick+`", "message": "hello"}`, http.StatusNotFound)
+	st.call("GET", "/forum/{slug}/threads", "/forum/"+forum+"/threads?limit=10&desc=true", "", http.StatusOK)
+	st.call("GET", "/forum/{slug}/threads", "/forum/"+missing+"/threads", "", http.StatusNotFound)
+	st.call("GET", "/forum/{slug}/threads", "/forum/"+forum+"/threads?desc=maybe", "", http.StatusBadRequest)
+	st.call("GET", "/thread/{slug_or_id}/details", "/thread/"+slug+"/details", "", http.StatusOK)
+	st.call("GET", "/thread/{slug_or_id}/details", "/thread/"+missing+"/details", "", http.StatusNotFound)
+	st.call("POST", "/thread/{slug_or_id}/details", "/thread/"+threadID+"/details", `{"title": "Renamed"}`, http.StatusOK)
+	st.call("POST", "/thread/{slug_or_id}/details", "/thread/"+missing+"/details", `{"title": "Renamed"}`, http.StatusNotFound)
+
+	// posts
+	body = st.call("POST", "/thread/{slug_or_id}/create", "/thread/"+slug+"/create",
+		`[{"author": "`+nick+`", "message": "first"}]`, http.StatusCreated)
+	posts := &models.PostList{}
+	if err := posts.UnmarshalJSON(body); err != nil || len(*posts) == 0 {
+		st.problems = append(st.problems, "suite: cannot continue without a post")
+		return false
+	}
+	postID := strconv.Itoa((*posts)[0].PostID)
+	st.postID = postID
+	st.call("POST", "/thread/{slug_or_id}/create", "/thread/"+threadID+"/create",
+		`[{"author": "`+other+`", "message": "reply", "parent": `+postID+`}]`, http.StatusCreated)
+	st.call("POST", "/thread/{slug_or_id}/create", "/thread/"+slug+"/create",
+		`[{"author": "`+nick+`", "message": "orphan", "parent": 2147483647}]`, http.StatusConflict)
+	st.call("POST", "/thread/{slug_or_id}/create", "/thread/"+missing+"/create",
+		`[{"author": "`+nick+`", "message": "lost"}]`, http.StatusNotFound)
+	for _, sort := range []string{"flat", "tree", "parent_tree"} {
+		st.call("GET", "/thread/{slug_or_id}/posts", "/thread/"+slug+"/posts?limit=10&sort="+sort, "", http.StatusOK)
+	}
+	st.call("GET", "/thread/{slug_or_id}/posts", "/thread/"+missing+"/posts", "", http.StatusNotFound)
+	st.call("GET", "/thread/{slug_or_id}/posts", "/thread/"+slug+"/posts?limit=ten", "", http.StatusBadRequest)
+	st.call("GET", "/forum/{slug}/users", "/forum/"+forum+"/users?limit=10", "", http.StatusOK)
+	st.call("GET", "/forum/{slug}/users", "/forum/"+missing+"/users", "", http.StatusNotFound)
+	st.call("GET", "/forum/{slug}/users", "/forum/"+forum+"/users?desc=maybe", "", http.StatusBadRequest)
+	st.call("GET", "/post/{id}/details", "/post/"+postID+"/details?related=user,forum,thread", "", http.StatusOK)
+	st.call("GET", "/post/{id}/details", "/post/2147483647/details", "", http.StatusNotFound)
+	st.call("POST", "/post/{id}/details", "/post/"+postID+"/details", `{"message": "edited"}`, http.StatusOK)
+	st.call("POST", "/post/{id}/details", "/post/2147483647/details", `{"message": "edited"}`, http.StatusNotFound)
+
+	// votes
+	st.call("POST", "/thread/{slug_or_id}/vote", "/thread/"+slug+"/vote",
+		`{"nickname": "`+nick+`", "voice": 1}`, http.StatusOK)
+	st.call("POST", "/thread/{slug_or_id}/vote", "/thread/"+threadID+"/vote",
+		`{"nickname": "`+nick+`", "voice": -1}`, http.StatusOK)
+	st.call("POST", "/thread/{slug_or_id}/vote", "/thread/"+slug+"/vote",
+		`{"nickname": "`+missing+`", "voice": 1}`, http.StatusNotFound)
+	return true
+}
+
+// conditional checks the entity tags of the base records: a tag read
+// back in If-None-Match gives 304, If-Match accepts a tag of the current
+// version whatever the query it was read with and rejects an old one.
+func (st *suite) conditional() {
+	forum, threadID, postID := st.forum, st.threadID, st.postID
+	for _, r := range []struct{ tpl, path string }{
+		{"/forum/{slug}/details", "/forum/" + forum + "/details"},
+		{"/forum/{slug}/users", "/forum/" + forum + "/users?limit=10"},
+		{"/forum/{slug}/threads", "/forum/" + forum + "/threads?limit=10"},
+		{"/thread/{slug_or_id}/details", "/thread/" + threadID + "/details"},
+		{"/thread/{slug_or_id}/posts", "/thread/" + threadID + "/posts?limit=10"},
+		{"/post/{id}/details", "/post/" + postID + "/details?related=thread"},
+	} {
+		if etag := st.etag(r.tpl, r.path); etag != "" {
+			st.send("GET", r.tpl, r.path, "", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+		}
+	}
+
+	for _, r := range []struct{ tpl, path, body string }{
+		{"/thread/{slug_or_id}/details", "/thread/" + threadID + "/details", `{"message": "tagged"}`},
+		{"/post/{id}/details", "/post/" + postID + "/details", `{"message": "tagged"}`},
+	} {
+		etag := st.etag(r.tpl, r.path+"?html=true")
+		if etag == "" {
+			continue
+		}
+		st.send("POST", r.tpl, r.path, r.body, http.Header{"If-Match": {etag}}, http.StatusOK)
+		st.send("POST", r.tpl, r.path, r.body, http.Header{"If-Match": {etag}}, http.StatusPreconditionFailed)
+	}
+}
+
+// live opens the event streams of the base thread and forum.
+func (st *suite) live() {
+	for _, r := range []struct{ tpl, path, missing string }{
+		{"/thread/{slug_or_id}/live", "/thread/" + st.threadID + "/live", "/thread/" + st.missing + "/live"},
+		{"/forum/{slug}/live", "/forum/" + st.forum + "/live", "/forum/" + st.missing + "/live"},
+	} {
+		st.call("GET", r.tpl, r.path, "", http.StatusOK)
+		st.call("GET", r.tpl, r.path+"?last_event_id=x", "", http.StatusBadRequest)
+		st.call("GET", r.tpl, r.missing, "", http.StatusNotFound)
+	}
+}
+
+// webhooks registers a webhook on the base forum and removes it. The
+// receiver does not exist, nothing is delivered during the suite.
+func (st *suite) webhooks() {
+	hooks := "/forum/" + st.forum + "/webhooks"
+	hook := `{"url": "http://127.0.0.1:9/hook", "secret": "suite", "events": ["` + models.EventPostCreated + `"]}`
+	body := st.call("POST", "/forum/{slug}/webhooks", hooks, hook, http.StatusCreated)
+	w := &models.Webhook{}
+	if err := w.UnmarshalJSON(body); err != nil {
+		st.problems = append(st.problems, "suite: no webhook to continue with: "+err.Error())
+		return
+	}
+	id := strconv.Itoa(w.WebhookID)
+	st.call("POST", "/forum/{slug}/webhooks", hooks, `{"url": "ftp://example.com", "secret": "suite"}`, http.StatusBadRequest)
+	st.call("POST", "/forum/{slug}/webhooks", "/forum/"+st.missing+"/webhooks", hook, http.StatusNotFound)
+	st.call("GET", "/forum/{slug}/webhooks", hooks, "", http.StatusOK)
+	st.call("GET", "/forum/{slug}/webhooks", "/forum/"+st.missing+"/webhooks", "", http.StatusNotFound)
+
+	deliveries := "/forum/{slug}/webhooks/{id}/deliveries"
+	st.call("GET", deliveries, hooks+"/"+id+"/deliveries?limit=10", "", http.StatusOK)
+	st.call("GET", deliveries, hooks+"/"+id+"/deliveries?limit=0", "", http.StatusBadRequest)
+	st.call("GET", deliveries, hooks+"/2147483647/deliveries", "", http.StatusNotFound)
+
+	st.call("DELETE", "/forum/{slug}/webhooks/{id}", hooks+"/"+id, "", http.StatusNoContent)
+	st.call("DELETE", "/forum/{slug}/webhooks/{id}", hooks+"/"+id, "", http.StatusNotFound)
+}
+
+// notifications reads and marks the reply the other user left to the
+// first post of the base thread.
+func (st *suite) notifications() {
+	path := "/user/" + st.nick + "/notifications"
+	st.call("GET", "/user/{nickname}/notifications", path+"?limit=10&unread=true", "", http.StatusOK)
+	st.call("GET", "/user/{nickname}/notifications", path+"?limit=0", "", http.StatusBadRequest)
+	st.call("GET", "/user/{nickname}/notifications", "/user/"+st.missing+"/notifications", "", http.StatusNotFound)
+	st.call("POST", "/user/{nickname}/notifications/read", path+"/read", `{"upTo": 2147483647}`, http.StatusOK)
+	st.call("POST", "/user/{nickname}/notifications/read", "/user/"+st.missing+"/notifications/read", "", http.StatusNotFound)
+}
+
+// watch follows the base forum and thread, reads the feed and stops.
+func (st *suite) watch() {
+	user, missing := "/user/"+st.nick, st.missing
+	forum := "/user/{nickname}/watch/forum/{slug}"
+	st.call("POST", forum, user+"/watch/forum/"+st.forum, "", http.StatusCreated)
+	st.call("POST", forum, user+"/watch/forum/"+st.forum, "", http.StatusOK)
+	st.call("POST", forum, user+"/watch/forum/"+missing, "", http.StatusNotFound)
+	thread := "/user/{nickname}/watch/thread/{slug_or_id}"
+	st.call("POST", thread, user+"/watch/thread/"+st.threadID, "", http.StatusCreated)
+	st.call("POST", thread, user+"/watch/thread/"+st.slug, "", http.StatusOK)
+	st.call("POST", thread, user+"/watch/thread/"+missing, "", http.StatusNotFound)
+
+	read := "/user/{nickname}/watch/thread/{slug_or_id}/read"
+	st.call("POST", read, user+"/watch/thread/"+st.threadID+"/read", `{"post": `+st.postID+`}`, http.StatusOK)
+	st.call("POST", read, user+"/watch/thread/"+st.threadID+"/read", `{"post": -1}`, http.StatusBadRequest)
+	st.call("POST", read, user+"/watch/thread/"+st.threadID+"/read", `{"post": 2147483647}`, http.StatusConflict)
+	st.call("POST", read, user+"/watch/thread/"+missing+"/read", `{"post": 1}`, http.StatusNotFound)
+	st.call("GET", "/user/{nickname}/watch", user+"/watch", "", http.StatusOK)
+	st.call("GET", "/user/{nickname}/watch", "/user/"+missing+"/watch", "", http.StatusNotFound)
+	st.call("GET", "/user/{nickname}/feed", user+"/feed?limit=10", "", http.StatusOK)
+	st.call("GET", "/user/{nickname}/feed", user+"/feed?cursor=%21", "", http.StatusBadRequest)
+	st.call("GET", "/user/{nickname}/feed", "/user/"+missing+"/feed", "", http.StatusNotFound)
+
+	st.call("DELETE", forum, user+"/watch/forum/"+st.forum, "", http.StatusNoContent)
+	st.call("DELETE", forum, user+"/watch/forum/"+st.forum, "", http.StatusNotFound)
+	st.call("DELETE", thread, user+"/watch/thread/"+st.threadID, "", http.StatusNoContent)
+	st.call("DELETE", thread, user+"/watch/thread/"+st.threadID, "", http.StatusNotFound)
+}
+
+// attachments uploads an image to the first post of the base thread,
+// reads it back and removes it. Either the uploads or the 503 of a server
+// without attachments can be checked, not both.
+func (st *suite) attachments() {
+	post, attachments := "/post/{id}/attachments", "/post/"+st.postID+"/attachments"
+	file, thumb := "/attachment/{id}", "/attachment/{id}/thumbnail"
+	st.call("POST", post, attachments, `{"file": "x"}`, http.StatusBadRequest)
+	body, header := multipartFile(pngFile())
+	resp, respBody := st.send("POST", post, attachments, body, header, http.StatusCreated, http.StatusServiceUnavailable)
+	if resp == nil {
+		return
+	}
+	if etag := st.etag(post, attachments); etag != "" {
+		st.send("GET", post, attachments, "", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+	}
+	st.call("GET", post, "/post/2147483647/attachments", "", http.StatusNotFound)
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		st.skip("POST", post, http.StatusCreated, http.StatusNotFound, http.StatusRequestEntityTooLarge,
+			http.StatusUnsupportedMediaType)
+		for _, tpl := range []string{file, thumb} {
+			st.skip("GET", tpl, http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusNotFound)
+			st.call("GET", tpl, strings.Replace(tpl, "{id}", "2147483647", 1), "", http.StatusServiceUnavailable)
+		}
+		st.skip("DELETE", file, http.StatusNoContent)
+		st.call("DELETE", file, "/attachment/2147483647", "", http.StatusNotFound)
+		return
+	}
+	st.skip("POST", post, http.StatusServiceUnavailable)
+	st.skip("GET", file, http.StatusServiceUnavailable)
+	st.skip("GET", thumb, http.StatusServiceUnavailable)
+
+	created := &models.AttachmentList{}
+	if err := created.UnmarshalJSON(respBody); err != nil || len(*created) != 1 {
+		st.problems = append(st.problems, "suite: no attachment to continue with")
+		return
+	}
+	id := strconv.Itoa((*created)[0].AttachmentID)
+	body, header = multipartFile(pngFile())
+	st.send("POST", post, "/post/2147483647/attachments", body, header, http.StatusNotFound)
+	body, header = multipartFile(make([]byte, st.attachmentMaxSize+1))
+	st.send("POST", post, attachments, body, header, http.StatusRequestEntityTooLarge)
+	body, header = multipartFile([]byte{0, 1, 2, 3})
+	st.send("POST", post, attachments, body, header, http.StatusUnsupportedMediaType)
+
+	for _, tpl := range []string{file, thumb} {
+		st.file(tpl, strings.Replace(tpl, "{id}", id, 1))
+		st.call("GET", tpl, strings.Replace(tpl, "{id}", "2147483647", 1), "", http.StatusNotFound)
+	}
+
+	st.call("DELETE", file, "/attachment/"+id, "", http.StatusNoContent)
+	st.call("DELETE", file, "/attachment/"+id, "", http.StatusNotFound)
+}
+
+// authored lists the thread and the post of the base user.
+func (st *suite) authored() {
+	for _, tpl := range []string{"/user/{nickname}/threads", "/user/{nickname}/posts"} {
+		path := strings.Replace(tpl, "{nickname}", st.nick, 1)
+		st.call("GET", tpl, path+"?forum="+st.forum+"&limit=10&desc=true&html=true", "", http.StatusOK)
+		if etag := st.etag(tpl, path); etag != "" {
+			st.send("GET", tpl, path, "", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+		}
+		st.call("GET", tpl, path+"?limit=0", "", http.StatusBadRequest)
+		st.call("GET", tpl, path+"?since_id=1", "", http.StatusBadRequest)
+		st.call("GET", tpl, path+"?forum="+st.missing, "", http.StatusNotFound)
+		st.call("GET", tpl, strings.Replace(tpl, "{nickname}", st.missing, 1), "", http.StatusNotFound)
+	}
+}
+
+// rename renames the other user, the old nickname redirects to the new
+// one then. The other user goes by the new nickname in later steps.
+func (st *suite) rename() {
+	rename, renamed := "/user/{nickname}/rename", strings.ToUpper(st.other[:1])+st.other[1:]+"_renamed"
+	st.call("POST", rename, "/user/"+st.other+"/rename", `{"nickname": "`+renamed+`"}`, http.StatusOK)
+	resp, _ := st.send("GET", "/user/{nickname}/profile", "/user/"+st.other+"/profile", "", nil, http.StatusMovedPermanently)
+	if resp != nil && !strings.HasSuffix(resp.Header.Get("Location"), "/user/"+renamed+"/profile") {
+		st.problems = append(st.problems, fmt.Sprintf("GET /user/%s/profile: redirects to %q, want %s",
+			st.other, resp.Header.Get("Location"), renamed))
+	}
+	st.other = renamed
+	st.call("POST", rename, "/user/"+renamed+"/rename", `{}`, http.StatusBadRequest)
+	st.call("POST", rename, "/user/"+renamed+"/rename", `{"nickname": "`+strings.ToLower(renamed)+`"}`,
+		http.StatusBadRequest)
+	st.call("POST", rename, "/user/"+renamed+"/rename", `{"nickname": "`+st.nick+`"}`, http.StatusConflict)
+	st.call("POST", rename, "/user/"+st.missing+"/rename", `{"nickname": "`+st.missing+`_renamed"}`, http.StatusNotFound)
+	st.call("POST", "/user/{nickname}/profile", "/user/"+renamed+"/profile",
+		`{"nickname": "`+renamed+`_again"}`, http.StatusBadRequest)
+	st.call("POST", "/user/{nickname}/profile", "/user/"+renamed+"/profile",
+		`{"nickname": "`+strings.ToLower(renamed)+`"}`, http.StatusOK)
+	st.other = strings.ToLower(renamed)
+}
+
+// deletion exports the data of a new user and deletes it.
+func (st *suite) deletion() {
+	profile, export := "/user/{nickname}/profile", "/user/{nickname}/export"
+	gone := st.nick + "_gone"
+	st.call("POST", "/user/{nickname}/create", "/user/"+gone+"/create",
+		`{"fullname": "Gone", "email": "`+gone+`@example.com"}`, http.StatusCreated)
+	st.call("POST", "/thread/{slug_or_id}/create", "/thread/"+st.threadID+"/create",
+		`[{"author": "`+gone+`", "message": "bye"}]`, http.StatusCreated)
+	st.call("GET", export, "/user/"+gone+"/export", "", http.StatusOK)
+	st.call("DELETE", profile, "/user/"+gone+"/profile", "", http.StatusNoContent)
+	st.call("DELETE", profile, "/user/"+gone+"/profile", "", http.StatusNotFound)
+	st.call("GET", export, "/user/"+gone+"/export", "", http.StatusNotFound)
+	st.call("DELETE", profile, "/user/"+url.PathEscape(queries.DeletedNickname)+"/profile", "", http.StatusBadRequest)
+	// only while a rename is being finished
+	st.skip("DELETE", profile, http.StatusConflict)
+}
+
+// categories puts the base forum in a new category and a sub-forum
+// under it.
+func (st *suite) categories() {
+	cat, missing := st.forum+"-category", st.missing
+	c := `{"slug": "` + cat + `", "title": "Suite category", "position": 1}`
+	st.call("POST", "/category/create", "/category/create", c, http.StatusCreated)
+	st.call("POST", "/category/create", "/category/create", c, http.StatusConflict)
+	st.call("POST", "/category/create", "/category/create", `{"slug": "`+cat+`"}`, http.StatusBadRequest)
+	st.call("POST", "/category/{slug}/details", "/category/"+cat+"/details", `{"title": "Renamed"}`, http.StatusOK)
+	st.call("POST", "/category/{slug}/details", "/category/"+missing+"/details", `{"title": "Renamed"}`,
+		http.StatusNotFound)
+
+	details := "/forum/{slug}/details"
+	st.call("POST", details, "/forum/"+st.forum+"/details", `{"category": "`+cat+`", "position": 1}`, http.StatusOK)
+	st.call("POST", details, "/forum/"+st.forum+"/details", `{"parent": "`+st.forum+`"}`, http.StatusBadRequest)
+	st.call("POST", details, "/forum/"+missing+"/details", `{"title": "Renamed"}`, http.StatusNotFound)
+	sub := `{"slug": "` + st.forum + `-sub", "title": "Suite sub-forum", "user": "` + st.nick + `", "parent": "` + st.forum + `"`
+	st.call("POST", "/forum/create", "/forum/create", sub+`, "category": "`+cat+`"}`, http.StatusBadRequest)
+	st.call("POST", "/forum/create", "/forum/create", sub+`}`, http.StatusCreated)
+
+	for _, r := range []struct{ tpl, path string }{
+		{"/categories", "/categories"},
+		{"/category/{slug}", "/category/" + cat},
+		{"/forums", "/forums?limit=10&desc=true"},
+	} {
+		if etag := st.etag(r.tpl, r.path); etag != "" {
+			st.send("GET", r.tpl, r.path, "", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+		}
+	}
+	st.call("GET", "/category/{slug}", "/category/"+missing, "", http.StatusNotFound)
+	st.call("GET", "/forums", "/forums?limit=0", "", http.StatusBadRequest)
+}
+
+// tags tags the base thread and reads the tag cloud of the base forum.
+func (st *suite) tags() {
+	forum, thread := "/forum/"+st.forum, "/thread/"+st.threadID
+	st.call("POST", "/thread/{slug_or_id}/details", thread+"/details", `{"tags": ["Suite", "suite"]}`, http.StatusOK)
+	st.call("POST", "/thread/{slug_or_id}/details", thread+"/details", `{"tags": ["two words"]}`, http.StatusBadRequest)
+	st.call("POST", "/forum/{slug}/create", forum+"/create",
+		`{"title": "Tagged", "author": "`+st.nick+`", "message": "hello", "tags": [""]}`, http.StatusBadRequest)
+	st.call("GET", "/forum/{slug}/threads", forum+"/threads?tag=suite", "", http.StatusOK)
+
+	body := st.call("GET", "/post/{id}/details", "/post/"+st.postID+"/details?related=thread", "", http.StatusOK)
+	info := &models.PostInfo{}
+	if err := info.UnmarshalJSON(body); err == nil && (info.Thread == nil || len(info.Thread.Tags) != 1) {
+		st.problems = append(st.problems, fmt.Sprintf("GET /post/%s/details: got thread %+v, want it with its tag",
+			st.postID, info.Thread))
+	}
+
+	tags := "/forum/{slug}/tags"
+	if etag := st.etag(tags, forum+"/tags?limit=10"); etag != "" {
+		st.send("GET", tags, forum+"/tags?limit=10", "", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+	}
+	st.call("GET", tags, forum+"/tags?limit=0", "", http.StatusBadRequest)
+	st.call("GET", tags, "/forum/"+st.missing+"/tags", "", http.StatusNotFound)
+}
+
+// avatars sets an avatar of the base user, reads it back and removes it,
+// like attachments.
+func (st *suite) avatars() {
+	avatar, user := "/user/{nickname}/avatar", "/user/"+st.nick+"/avatar"
+	thumb := "/user/{nickname}/avatar/thumbnail"
+	st.call("POST", avatar, user, `{"file": "x"}`, http.StatusBadRequest)
+	st.call("DELETE", avatar, user, "", http.StatusOK)
+	st.call("DELETE", avatar, "/user/"+st.missing+"/avatar", "", http.StatusNotFound)
+	body, header := multipartFile(pngFile())
+	resp, _ := st.send("POST", avatar, user, body, header, http.StatusOK, http.StatusServiceUnavailable)
+	if resp == nil {
+		return
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		st.skip("POST", avatar, http.StatusOK, http.StatusNotFound, http.StatusRequestEntityTooLarge,
+			http.StatusUnsupportedMediaType)
+		for _, tpl := range []string{avatar, thumb} {
+			st.skip("GET", tpl, http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusNotFound)
+			st.call("GET", tpl, strings.Replace(tpl, "{nickname}", st.nick, 1), "", http.StatusServiceUnavailable)
+		}
+		return
+	}
+	st.skip("POST", avatar, http.StatusServiceUnavailable)
+	st.skip("GET", avatar, http.StatusServiceUnavailable)
+	st.skip("GET", thumb, http.StatusServiceUnavailable)
+
+	body, header = multipartFile(pngFile())
+	st.send("POST", avatar, "/user/"+st.missing+"/avatar", body, header, http.StatusNotFound)
+	body, header = multipartFile(make([]byte, st.attachmentMaxSize+1))
+	st.send("POST", avatar, user, body, header, http.StatusRequestEntityTooLarge)
+	// an allowed attachment, but not an image
+	body, header = multipartFile([]byte("not an image"))
+	st.send("POST", avatar, user, body, header, http.StatusUnsupportedMediaType)
+
+	for _, tpl := range []string{avatar, thumb} {
+		st.file(tpl, strings.Replace(tpl, "{nickname}", st.nick, 1))
+		st.call("GET", tpl, strings.Replace(tpl, "{nickname}", st.other, 1), "", http.StatusNotFound)
+	}
+	st.call("DELETE", avatar, user, "", http.StatusOK)
+}
+
+// file reads a file with its ETag and by a range.
+func (st *suite) file(tpl, path string) {
+	if etag := st.etag(tpl, path); etag != "" {
+		st.send("GET", tpl, path, "", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+	}
+	st.send("GET", tpl, path, "", http.Header{"Range": {"bytes=0-0"}}, http.StatusPartialContent)
+}
+
+// multipartFile makes an upload body with data in its "file" part.
+func multipartFile(data []byte) (string, http.Header) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	part, _ := w.CreateFormFile("file", "suite")
+	part.Write(data)
+	w.Close()
+	return buf.String(), http.Header{"Content-Type": {w.FormDataContentType()}}
+}
+
+// pngFile is a small image, big enough to have a thumbnail made.
+func pngFile() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	return buf.Bytes()
+}
+
+// etag reads the ETag of a GET response, "" if there is none.
+func (st *suite) etag(tpl, path string) string {
+	resp, _ := st.send("GET", tpl, path, "", nil, http.StatusOK)
+	if resp == nil {
+		return ""
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		st.problems = append(st.problems, fmt.Sprintf("GET %s: no ETag", path))
+	}
+	return etag
+}
+
+// finish reports documented operations that the suite never reached.
+func (st *suite) finish() []string {
+	for _, op := range st.spec.Operations() {
+		if op.Path == "/service/clear" {
+			continue
+		}
+		for _, code := range op.StatusCodes() {
+			key := fmt.Sprintf("%s %d", op, code)
+			if !st.covered[key] && !st.unreachable[key] {
+				st.problems = append(st.problems, fmt.Sprintf("suite: %s %d is never exercised", op, code))
+			}
+		}
+	}
+	return st.problems
+}
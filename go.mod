@@ -2,6 +2,7 @@ module github.com/ArtAndreev/ForumTP
 
 require (
 	github.com/ArtAndreev/highload-load-balancing v0.0.0-20190325101219-6fc94b279639
+	github.com/andybalholm/brotli v1.0.6
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/mux v1.6.2
 	github.com/jmoiron/sqlx v1.2.0
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+	"github.com/ArtAndreev/ForumTP/storage"
+)
+
+// maxUploadFiles is how many files one upload request may carry.
+const maxUploadFiles = 10
+
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	switch err {
+	case queries.ErrAttachmentsDisabled:
+		writeErrorMessage(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case queries.ErrAttachmentTooLarge:
+		writeErrorMessage(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case queries.ErrAttachmentType:
+		writeErrorMessage(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	switch err.(type) {
+	case *queries.ValidationError:
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+	default:
+		writeListError(w, err)
+	}
+}
+
+// readUploads spools the files from the "file" parts of a
+// multipart/form-data body. It answers the request itself on errors, the
+// uploads have to be closed otherwise.
+func readUploads(w http.ResponseWriter, r *http.Request, max int) ([]*queries.Upload, bool) {
+	limits := queries.GetAttachmentLimits()
+	// room for part headers on top of the files
+	r.Body = http.MaxBytesReader(w, r.Body, int64(max)*(limits.MaxSize+4096))
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "multipart/form-data body expected")
+		return nil, false
+	}
+
+	uploads := []*queries.Upload{}
+	fail := func() ([]*queries.Upload, bool) {
+		for _, u := range uploads {
+			u.Close()
+		}
+		return nil, false
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeErrorMessage(w, http.StatusBadRequest, "invalid multipart body: "+err.Error())
+			return fail()
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		if len(uploads) == max {
+			writeErrorMessage(w, http.StatusBadRequest, "at most "+strconv.Itoa(max)+" files can be uploaded at once")
+			return fail()
+		}
+		u, err := queries.NewUpload(part.FileName(), part)
+		part.Close()
+		if err != nil {
+			writeAttachmentError(w, err)
+			return fail()
+		}
+		uploads = append(uploads, u)
+	}
+	if len(uploads) == 0 {
+		writeErrorMessage(w, http.StatusBadRequest, "no file parts in the body")
+		return nil, false
+	}
+	return uploads, true
+}
+
+// CreateAttachments takes files from the "file" parts of a
+// multipart/form-data body.
+func CreateAttachments(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"]) // checked by the route
+	uploads, ok := readUploads(w, r, maxUploadFiles)
+	if !ok {
+		return
+	}
+	defer func() {
+		for _, u := range uploads {
+			u.Close()
+		}
+	}()
+
+	res, err := queries.CreateAttachments(id, uploads)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func GetAttachments(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, err := queries.GetPostByID(id); err != nil {
+		writeListError(w, err)
+		return
+	}
+	res, err := queries.GetPostAttachments(id)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := queries.DeleteAttachment(id); err != nil {
+		writeListError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeAttachment sends the file of an attachment. It goes without the
+// API middlewares: files are sent as they are, with range requests.
+func ServeAttachment(w http.ResponseWriter, r *http.Request) {
+	serveAttachment(w, r, false)
+}
+
+// ServeAttachmentThumbnail sends the thumbnail of an image attachment.
+func ServeAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	serveAttachment(w, r, true)
+}
+
+func serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	a, f, err := queries.OpenAttachment(id, thumbnail)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeAttachmentError(w, err)
+		return
+	}
+	defer f.Close()
+	serveBlob(w, r, a, f, thumbnail)
+}
+
+// ServeAvatar sends the avatar of a user, like ServeAttachment.
+func ServeAvatar(w http.ResponseWriter, r *http.Request) {
+	serveAvatar(w, r, false)
+}
+
+func ServeAvatarThumbnail(w http.ResponseWriter, r *http.Request) {
+	serveAvatar(w, r, true)
+}
+
+func serveAvatar(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	a, f, err := queries.OpenUserAvatar(mux.Vars(r)["nickname"], thumbnail)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeAttachmentError(w, err)
+		return
+	}
+	defer f.Close()
+	// a new avatar is another file, so the address can't be cached for long
+	w.Header().Set("Cache-Control", "no-cache")
+	serveBlob(w, r, a, f, thumbnail)
+}
+
+func serveBlob(w http.ResponseWriter, r *http.Request, a *models.Attachment, f storage.File, thumbnail bool) {
+	// files are stored by content, so the hash is a strong validator
+	h := w.Header()
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", "public, max-age=3600")
+	}
+	h.Set("X-Content-Type-Options", "nosniff")
+	if thumbnail {
+		h.Set("ETag", representationETag(r, `"`+a.Hash+`-thumb"`))
+		h.Set("Content-Type", a.ThumbnailType)
+	} else {
+		h.Set("ETag", representationETag(r, `"`+a.Hash+`"`))
+		h.Set("Content-Type", a.ContentType)
+		// only images are shown in the page, the rest is downloaded
+		disposition := "attachment"
+		if strings.HasPrefix(a.ContentType, "image/") {
+			disposition = "inline"
+		}
+		params := map[string]string{}
+		if a.Filename != "" {
+			params["filename"] = a.Filename
+		}
+		h.Set("Content-Disposition", mime.FormatMediaType(disposition, params))
+	}
+	http.ServeContent(w, r, "", a.Created, f)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+// Lists of what a user wrote page like the v2 forum lists in both API
+// versions, they have no v1 clients to keep.
+
+func readAuthorQuery(w http.ResponseWriter, r *http.Request) (*models.AuthorQueryParams, bool, bool) {
+	query := r.URL.Query()
+	params, err := parseAuthorQueryParams(query)
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return nil, false, false
+	}
+	if err = checkListLimit(&params.Limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return nil, false, false
+	}
+	html, err := parseHTMLParam(query)
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "html must be a boolean")
+		return nil, false, false
+	}
+	return params, html, true
+}
+
+func setAuthorNextLink(w http.ResponseWriter, r *http.Request, created time.Time, id int) {
+	setNextLink(w, r, map[string]string{
+		"since":    created.Format(sinceTimeLayout),
+		"since_id": strconv.Itoa(id),
+	})
+}
+
+func GetUserThreads(w http.ResponseWriter, r *http.Request) {
+	params, html, ok := readAuthorQuery(w, r)
+	if !ok {
+		return
+	}
+	res, err := queries.GetUserThreads(mux.Vars(r)["nickname"], params)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.ThreadList{}
+	}
+	if html {
+		for k := range *res {
+			queries.RenderThread(&(*res)[k])
+		}
+	}
+	// threads without a date can't be paged past
+	if n := len(*res); uint64(n) == params.Limit && (*res)[n-1].ThreadCreated != nil {
+		last := (*res)[n-1]
+		setAuthorNextLink(w, r, *last.ThreadCreated, last.ThreadID)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func GetUserPosts(w http.ResponseWriter, r *http.Request) {
+	params, html, ok := readAuthorQuery(w, r)
+	if !ok {
+		return
+	}
+	res, err := queries.GetUserPosts(mux.Vars(r)["nickname"], params)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.UserPostList{}
+	}
+	if html {
+		for k := range *res {
+			queries.RenderPost(&(*res)[k].Post)
+		}
+	}
+	if n := len(*res); uint64(n) == params.Limit {
+		last := (*res)[n-1]
+		setAuthorNextLink(w, r, last.PostCreated, last.PostID)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
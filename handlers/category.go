@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+	c := &models.Category{}
+	if err = c.UnmarshalJSON(body); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	res, err := queries.CreateCategory(c)
+	if err != nil {
+		switch err.(type) {
+		case *queries.NullFieldError:
+			writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		case *queries.UniqueFieldValueAlreadyExistsError:
+			writeJSON(w, http.StatusConflict, res)
+		default:
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// GetCategory returns the category with the tree of its forums.
+func GetCategory(w http.ResponseWriter, r *http.Request) {
+	res, err := queries.GetCategory(mux.Vars(r)["slug"])
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	res, err := queries.GetCategories()
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.CategoryList{}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+	u := &models.CategoryUpdate{}
+	if err = u.UnmarshalJSON(body); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	res, err := queries.UpdateCategory(mux.Vars(r)["slug"], u)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Encoder creates a writer compressing into w for a content coding.
+type Encoder func(w io.Writer) io.WriteCloser
+
+type resettableWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// pooledWriter goes back to its pool once closed.
+type pooledWriter struct {
+	resettableWriter
+	pool *sync.Pool
+}
+
+func (p pooledWriter) Close() error {
+	err := p.resettableWriter.Close()
+	p.pool.Put(p.resettableWriter)
+	return err
+}
+
+func pooledEncoder(pool *sync.Pool) Encoder {
+	return func(w io.Writer) io.WriteCloser {
+		rw := pool.Get().(resettableWriter)
+		rw.Reset(w)
+		return pooledWriter{rw, pool}
+	}
+}
+
+var (
+	gzipWriters = &sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(nil)
+		},
+	}
+	brotliWriters = &sync.Pool{
+		New: func() interface{} {
+			return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+		},
+	}
+)
+
+var encoders = map[string]Encoder{
+	"br":   pooledEncoder(brotliWriters),
+	"gzip": pooledEncoder(gzipWriters),
+}
+
+// encodingPreference breaks ties between codings the client likes equally.
+var encodingPreference = []string{"br", "gzip"}
+
+// RegisterEncoding makes a content coding available to
+// CompressionMiddleware or replaces the built in gzip and br encoders.
+// Codings missing from encodingPreference are never picked.
+func RegisterEncoding(coding string, e Encoder) {
+	encoders[coding] = e
+}
+
+// negotiateEncoding picks a registered coding from Accept-Encoding, ""
+// means the response goes as is.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		weight := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				w, err := strconv.ParseFloat(p[2:], 64)
+				if err == nil {
+					weight = w
+				}
+			}
+		}
+		q[coding] = weight
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range encodingPreference {
+		if encoders[coding] == nil {
+			continue
+		}
+		weight, ok := q[coding]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = coding, weight
+		}
+	}
+	return best
+}
+
+type codingKey struct{}
+
+// responseCoding returns the coding CompressionMiddleware negotiated for
+// the response to r, "" if it goes as is.
+func responseCoding(r *http.Request) string {
+	coding, _ := r.Context().Value(codingKey{}).(string)
+	return coding
+}
+
+// representationETag makes etag specific to the coding of the response
+// to r: compressed responses are different representations, so "tag"
+// becomes "tag-gzip" or "tag-br". Conditional request headers are
+// compared with the result as is, a tag of another coding never matches.
+func representationETag(r *http.Request, etag string) string {
+	coding := responseCoding(r)
+	if coding == "" || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + coding + `"`
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	coding      string
+	encoder     Encoder
+	cw          io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	h := c.Header()
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", c.coding)
+		h.Del("Content-Length")
+		c.cw = c.encoder(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.cw != nil {
+		return c.cw.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *compressWriter) Close() error {
+	if c.cw != nil {
+		return c.cw.Close()
+	}
+	return nil
+}
+
+// CompressionMiddleware compresses responses with the coding negotiated
+// through Accept-Encoding.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		coding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if coding == "" || r.Method == "HEAD" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		c := &compressWriter{ResponseWriter: w, coding: coding, encoder: encoders[coding]}
+		defer c.Close()
+		next.ServeHTTP(c, r.WithContext(context.WithValue(r.Context(), codingKey{}, coding)))
+	})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/ArtAndreev/ForumTP/spec"
+)
+
+// Docs serves the API specification. Documents are prepared once on
+// startup as they only depend on configuration.
+type Docs struct {
+	yml  []byte
+	json []byte
+	html []byte
+}
+
+func NewDocs(specYAML []byte, publicURL, version string) (*Docs, error) {
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return nil, err
+	}
+	yml := spec.Rewrite(specYAML, spec.Overrides{
+		Host:    u.Host,
+		Schemes: []string{u.Scheme},
+		Version: version,
+	})
+	s, err := spec.Parse(yml)
+	if err != nil {
+		return nil, err
+	}
+	j, err := s.JSON()
+	if err != nil {
+		return nil, err
+	}
+	html, err := s.RenderDocs(u.Scheme + "://" + u.Host + s.BasePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Docs{yml: yml, json: j, html: html}, nil
+}
+
+func (d *Docs) ServeYAML(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, "application/x-yaml; charset=utf-8", d.yml)
+}
+
+func (d *Docs) ServeJSON(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, "application/json", d.json)
+}
+
+func (d *Docs) ServeHTML(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, "text/html; charset=utf-8", d.html)
+}
+
+func (d *Docs) serve(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	_, err := w.Write(body)
+	if err != nil {
+		log.Println(err)
+	}
+}
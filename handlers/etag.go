@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+// maxETagBody is the largest body an ETag is computed for, longer lists
+// are streamed without one.
+const maxETagBody = 1 << 20
+
+// etagOf returns a strong ETag for a response body. Records with a
+// version get it in front of the hash, "v3-hash", so that requests
+// changing them can be checked against the version alone.
+func etagOf(version int, body []byte) string {
+	sum := sha256.Sum256(body)
+	hash := base64.RawURLEncoding.EncodeToString(sum[:18])
+	if version != 0 {
+		return `"v` + strconv.Itoa(version) + "-" + hash + `"`
+	}
+	return `"` + hash + `"`
+}
+
+// etagMatches reports whether a list of entity tags from If-None-Match
+// contains etag. The comparison is weak, W/"tag" matches "tag".
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter holds the body back until it is complete or too big for
+// an ETag.
+type etagWriter struct {
+	http.ResponseWriter
+	status  int
+	version int
+	buf     bytes.Buffer
+	direct  bool
+}
+
+// setETagVersion puts the version of the record a handler wrapped in
+// withETag responds with into the ETag.
+func setETagVersion(w http.ResponseWriter, version int) {
+	if e, ok := w.(*etagWriter); ok {
+		e.version = version
+	}
+}
+
+func (e *etagWriter) WriteHeader(status int) {
+	if e.status == 0 {
+		e.status = status
+	}
+}
+
+func (e *etagWriter) Write(b []byte) (int, error) {
+	if e.status == 0 {
+		e.status = http.StatusOK
+	}
+	if e.direct {
+		return e.ResponseWriter.Write(b)
+	}
+	if e.buf.Len()+len(b) <= maxETagBody {
+		return e.buf.Write(b)
+	}
+	e.direct = true
+	e.ResponseWriter.WriteHeader(e.status)
+	_, err := e.buf.WriteTo(e.ResponseWriter)
+	if err != nil {
+		return 0, err
+	}
+	return e.ResponseWriter.Write(b)
+}
+
+// withETag adds a strong ETag computed from the body to successful
+// responses of h and answers If-None-Match with 304 Not Modified. The tag
+// is specific to the content coding of the response.
+func withETag(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e := &etagWriter{ResponseWriter: w}
+		h(e, r)
+		if e.direct {
+			return
+		}
+		if e.status == 0 {
+			e.status = http.StatusOK
+		}
+		if e.status == http.StatusOK {
+			etag := representationETag(r, etagOf(e.version, e.buf.Bytes()))
+			w.Header().Set("ETag", etag)
+			if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+				w.Header().Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.WriteHeader(e.status)
+		e.buf.WriteTo(w)
+	}
+}
+
+// checkIfMatch answers 412 and returns false if If-Match of the request
+// has no tag of the given version of a record. Any tag the GET handler
+// wrote for the version matches, whatever the query and content coding.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int) bool {
+	prefix := `"v` + strconv.Itoa(version) + "-"
+	for _, tag := range strings.Split(r.Header.Get("If-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	writeErrorMessage(w, http.StatusPreconditionFailed, queries.ErrRecordChanged.Error())
+	return false
+}
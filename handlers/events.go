@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+// Long polls of the change feed wait for new events at most this long.
+const (
+	defaultEventsWait = 30 * time.Second
+	maxEventsWait     = 60 * time.Second
+)
+
+func GetEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	after, limit, wait := int64(0), uint64(0), defaultEventsWait
+	var err error
+	if raw := query.Get("after"); raw != "" {
+		after, err = strconv.ParseInt(raw, 10, 64)
+	}
+	if raw := query.Get("limit"); raw != "" && err == nil {
+		limit, err = strconv.ParseUint(raw, 10, 64)
+	}
+	if raw := query.Get("timeout"); raw != "" && err == nil {
+		var seconds uint64
+		seconds, err = strconv.ParseUint(raw, 10, 64)
+		wait = time.Duration(seconds) * time.Second
+	}
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if wait > maxEventsWait {
+		wait = maxEventsWait
+	}
+
+	res, err := queries.GetEvents(r.Context(), after, limit, wait)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, res)
+}
@@ -30,7 +30,7 @@ func CreateForum(w http.ResponseWriter, r *http.Request) {
 	res, err := queries.CreateForum(f)
 	if err != nil {
 		switch err.(type) {
-		case *queries.NullFieldError:
+		case *queries.NullFieldError, *queries.ValidationError:
 			j, jErr := models.ErrorMessage{Message: err.Error()}.MarshalJSON()
 			if jErr != nil {
 				log.Println(err)
@@ -103,3 +103,81 @@ func GetForum(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Fprintln(w, string(j))
 }
+
+// UpdateForum renames, reorders or moves a forum with its sub-forums.
+func UpdateForum(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+	u := &models.ForumUpdate{}
+	if err = u.UnmarshalJSON(body); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	res, err := queries.UpdateForum(mux.Vars(r)["slug"], u)
+	if err != nil {
+		switch err.(type) {
+		case *queries.ValidationError:
+			writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		default:
+			writeListError(w, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GetForums lists forums of all levels by slug, like the v2 lists in both
+// API versions.
+func GetForums(w http.ResponseWriter, r *http.Request) {
+	params, err := parseUserQueryParams(r.URL.Query())
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&params.Limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := queries.GetForums((*models.ForumQueryParams)(params))
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.ForumNodeList{}
+	}
+	if n := len(*res); uint64(n) == params.Limit {
+		setNextLink(w, r, map[string]string{"since": (*res)[n-1].ForumSlug})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GetForumTags returns the tag cloud of the forum.
+func GetForumTags(w http.ResponseWriter, r *http.Request) {
+	params, err := parseUserQueryParams(r.URL.Query())
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&params.Limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := queries.GetForumTags(mux.Vars(r)["slug"], params.Limit)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.TagCountList{}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
 
 	"github.com/gorilla/mux"
 
@@ -32,7 +34,7 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	res, err := queries.CreateUser(u)
 	if err != nil {
 		switch err.(type) {
-		case *queries.NullFieldError:
+		case *queries.NullFieldError, *queries.ValidationError:
 			j, jErr := models.ErrorMessage{Message: err.Error()}.MarshalJSON()
 			if jErr != nil {
 				log.Println(err)
@@ -69,7 +71,14 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetUser(w http.ResponseWriter, r *http.Request) {
-	res, err := queries.GetUserByNickname(mux.Vars(r)["nickname"])
+	nickname := mux.Vars(r)["nickname"]
+	res, err := queries.GetUserByNickname(nickname)
+	if _, ok := err.(*queries.RecordNotFoundError); ok {
+		if renamed, rErr := queries.GetRenamedNickname(nickname); rErr == nil {
+			redirectRenamedUser(w, r, renamed)
+			return
+		}
+	}
 	if err != nil {
 		switch err.(type) {
 		case *queries.RecordNotFoundError:
@@ -114,7 +123,13 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	res, err := queries.UpdateUser(mux.Vars(r)["nickname"], u)
 	if err != nil {
+		if err == queries.ErrNicknameChanged {
+			writeErrorMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		switch err.(type) {
+		case *queries.ValidationError:
+			writeErrorMessage(w, http.StatusBadRequest, err.Error())
 		case *queries.RecordNotFoundError:
 			j, jErr := models.ErrorMessage{Message: err.Error()}.MarshalJSON()
 			if jErr != nil {
@@ -150,27 +165,22 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetForumUsers(w http.ResponseWriter, r *http.Request) {
-	params := &models.UserQueryParams{}
-	query := r.URL.Query()
-	rawDesc := query.Get("desc")
-	var err error
-	if rawDesc != "" {
-		params.Desc, err = strconv.ParseBool(rawDesc)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	params, err := parseUserQueryParams(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
-	rawLimit := query.Get("limit")
-	if rawLimit != "" {
-		params.Limit, err = strconv.ParseUint(rawLimit, 10, 64)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	clampListLimit(&params.Limit)
+	lw := &listWriter{w: w, nullEmpty: true}
+	err = queries.StreamUsersInForum(mux.Vars(r)["slug"], params, func(u *models.ForumUser) error {
+		return lw.add(u)
+	})
+	if err != nil && lw.sent {
+		// the status is out already, drop the connection so that
+		// the client can't take a truncated list for a whole one
+		log.Println(err)
+		panic(http.ErrAbortHandler)
 	}
-	params.Since = query.Get("since")
-	res, err := queries.GetAllUsersInForum(mux.Vars(r)["slug"], params)
 	if err != nil {
 		switch err.(type) {
 		case *queries.RecordNotFoundError:
@@ -189,11 +199,126 @@ func GetForumUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	j, jErr := res.MarshalJSON()
-	if jErr != nil {
+	err = lw.close()
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func GetUserStats(w http.ResponseWriter, r *http.Request) {
+	res, err := queries.GetUserStats(mux.Vars(r)["nickname"])
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// SetAvatar takes the image from the "file" part of a multipart/form-data
+// body.
+func SetAvatar(w http.ResponseWriter, r *http.Request) {
+	uploads, ok := readUploads(w, r, 1)
+	if !ok {
+		return
+	}
+	defer uploads[0].Close()
+
+	res, err := queries.SetUserAvatar(mux.Vars(r)["nickname"], uploads[0])
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	res, err := queries.DeleteUserAvatar(mux.Vars(r)["nickname"])
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// redirectRenamedUser sends the client from the profile of an old
+// nickname to the profile of the user who had it.
+func redirectRenamedUser(w http.ResponseWriter, r *http.Request, nickname string) {
+	i := strings.LastIndex(r.URL.Path, "/user/")
+	loc := url.URL{Path: r.URL.Path[:i] + "/user/" + nickname + "/profile", RawQuery: r.URL.RawQuery}
+	w.Header().Set("Location", loc.String())
+	writeErrorMessage(w, http.StatusMovedPermanently, "User was renamed to "+nickname)
+}
+
+func RenameUser(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	fmt.Fprintln(w, string(j))
+	r.Body.Close()
+	rename := &models.UserRename{}
+	if err = rename.UnmarshalJSON(body); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	res, err := queries.RenameUser(mux.Vars(r)["nickname"], rename.Nickname)
+	if err != nil {
+		if err == queries.ErrRenameInProgress {
+			writeErrorMessage(w, http.StatusConflict, err.Error())
+			return
+		}
+		switch err.(type) {
+		case *queries.NullFieldError, *queries.ValidationError:
+			writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		case *queries.UniqueFieldValueAlreadyExistsError:
+			writeErrorMessage(w, http.StatusConflict, err.Error())
+		default:
+			writeListError(w, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// DeleteUser deletes the account, threads and posts stay under a
+// placeholder user.
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	err := queries.DeleteUser(mux.Vars(r)["nickname"])
+	if err != nil {
+		if err == queries.ErrRenameInProgress {
+			writeErrorMessage(w, http.StatusConflict, err.Error())
+			return
+		}
+		switch err.(type) {
+		case *queries.ValidationError:
+			writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		default:
+			writeListError(w, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportUser sends a zip archive of the data of the user. Like files it
+// goes without the API middlewares.
+func ExportUser(w http.ResponseWriter, r *http.Request) {
+	nickname := mux.Vars(r)["nickname"]
+	if _, err := queries.GetUserByNickname(nickname); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeListError(w, err)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/zip")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": nickname + ".zip"}))
+	h.Set("Cache-Control", "no-store")
+	if err := queries.ExportUser(nickname, w); err != nil {
+		// the archive may be out in part, a cut connection tells the
+		// client it is broken
+		log.Println(err)
+		panic(http.ErrAbortHandler)
+	}
 }
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/live"
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment, so that
+// proxies don't close it.
+const sseKeepAlive = 15 * time.Second
+
+// Live streams events of a thread or a forum over Server-Sent Events or a
+// WebSocket, whichever the client asks for. The connection is held open,
+// so the handlers must get the ResponseWriter of the server and not one
+// wrapped by middlewares.
+type Live struct {
+	hub live.Hub
+}
+
+func NewLive(h live.Hub) *Live {
+	return &Live{hub: h}
+}
+
+func (l *Live) ServeThread(w http.ResponseWriter, r *http.Request) {
+	id, err := queries.GetThreadIDBySlugOrID(mux.Vars(r)["slug_or_id"])
+	if err != nil {
+		writeLiveError(w, err)
+		return
+	}
+	l.serve(w, r, live.ThreadTopic(id))
+}
+
+func (l *Live) ServeForum(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	if err := queries.CheckExistenceOfForum(slug); err != nil {
+		writeLiveError(w, err)
+		return
+	}
+	l.serve(w, r, live.ForumTopic(slug))
+}
+
+func writeLiveError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	writeListError(w, err)
+}
+
+// lastEventID is where a reconnecting client resumes. Browsers send the
+// header for event streams, WebSocket clients can only use the query.
+func lastEventID(r *http.Request) (int64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func (l *Live) serve(w http.ResponseWriter, r *http.Request, topic string) {
+	lastID, err := lastEventID(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeErrorMessage(w, http.StatusBadRequest, "bad last event id")
+		return
+	}
+	if isWebSocket(r) {
+		l.serveWebSocket(w, r, topic, lastID)
+		return
+	}
+	l.serveEventStream(w, r, topic, lastID)
+}
+
+func (l *Live) serveEventStream(w http.ResponseWriter, r *http.Request, topic string, lastID int64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Println("live: response writer is not a http.Flusher")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sub := l.hub.Subscribe(topic, lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				// fell behind, the client reconnects with Last-Event-ID
+				return
+			}
+			var j []byte
+			j, err = e.MarshalJSON()
+			if err == nil {
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, j)
+			}
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (l *Live) serveWebSocket(w http.ResponseWriter, r *http.Request, topic string, lastID int64) {
+	c, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer c.Close()
+	sub := l.hub.Subscribe(topic, lastID)
+	defer sub.Close()
+
+	for {
+		var e models.Event
+		var ok bool
+		select {
+		case e, ok = <-sub.Events():
+			if !ok {
+				return
+			}
+		case <-c.Closed():
+			return
+		}
+		j, err := e.MarshalJSON()
+		if err == nil {
+			err = c.WriteText(j)
+		}
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+}
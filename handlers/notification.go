@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := &models.NotificationQueryParams{}
+	var err error
+	if raw := query.Get("limit"); raw != "" {
+		params.Limit, err = strconv.ParseUint(raw, 10, 64)
+	}
+	if raw := query.Get("since"); raw != "" && err == nil {
+		params.Since, err = strconv.ParseInt(raw, 10, 64)
+	}
+	if raw := query.Get("unread"); raw != "" && err == nil {
+		params.UnreadOnly, err = strconv.ParseBool(raw)
+	}
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&params.Limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := queries.GetNotifications(mux.Vars(r)["nickname"], params)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if n := len(res.Notifications); uint64(n) == params.Limit {
+		since := strconv.FormatInt(res.Notifications[n-1].NotificationID, 10)
+		setNextLink(w, r, map[string]string{"since": since})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+	mark := &models.NotificationsRead{}
+	if len(body) != 0 {
+		err = mark.UnmarshalJSON(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := queries.MarkNotificationsRead(mux.Vars(r)["nickname"], mark)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+const sinceTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Limits of list endpoints, the spec documents the same numbers.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 10000
+)
+
+// clampListLimit applies the limits for v1, which never rejected a limit.
+func clampListLimit(limit *uint64) {
+	switch {
+	case *limit == 0:
+		*limit = defaultListLimit
+	case *limit > maxListLimit:
+		*limit = maxListLimit
+	}
+}
+
+// parseHTMLParam tells whether the client wants message_html, the
+// rendered message, in threads and posts.
+func parseHTMLParam(query url.Values) (bool, error) {
+	raw := query.Get("html")
+	if raw == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(raw)
+}
+
+func parseThreadQueryParams(query url.Values) (*models.ThreadQueryParams, error) {
+	params := &models.ThreadQueryParams{}
+	var err error
+	rawDesc := query.Get("desc")
+	if rawDesc != "" {
+		params.Desc, err = strconv.ParseBool(rawDesc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rawLimit := query.Get("limit")
+	if rawLimit != "" {
+		params.Limit, err = strconv.ParseUint(rawLimit, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rawTime := query.Get("since")
+	if rawTime != "" {
+		params.Since, err = time.Parse(sinceTimeLayout, rawTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	params.Tag = query.Get("tag")
+	return params, nil
+}
+
+func parseUserQueryParams(query url.Values) (*models.UserQueryParams, error) {
+	params := &models.UserQueryParams{}
+	var err error
+	rawDesc := query.Get("desc")
+	if rawDesc != "" {
+		params.Desc, err = strconv.ParseBool(rawDesc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rawLimit := query.Get("limit")
+	if rawLimit != "" {
+		params.Limit, err = strconv.ParseUint(rawLimit, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	params.Since = query.Get("since")
+	return params, nil
+}
+
+func parseThreadPostsQueryArgs(query url.Values) (*models.ThreadPostsQueryArgs, error) {
+	params := &models.ThreadPostsQueryArgs{}
+	var err error
+	rawLimit := query.Get("limit")
+	if rawLimit != "" {
+		params.Limit, err = strconv.ParseUint(rawLimit, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rawSince := query.Get("since")
+	if rawSince != "" {
+		params.Since, err = strconv.ParseUint(rawSince, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	params.Sort = query.Get("sort")
+	rawDesc := query.Get("desc")
+	if rawDesc != "" {
+		params.Desc, err = strconv.ParseBool(rawDesc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// parseAuthorQueryParams reads the parameters of the thread lists and
+// forum, since_id needs since like in v2.
+func parseAuthorQueryParams(query url.Values) (*models.AuthorQueryParams, error) {
+	tp, err := parseThreadQueryParams(query)
+	if err != nil {
+		return nil, err
+	}
+	params := &models.AuthorQueryParams{ThreadQueryParams: *tp, Forum: query.Get("forum")}
+	if raw := query.Get("since_id"); raw != "" {
+		params.SinceID, err = strconv.Atoi(raw)
+		if err != nil {
+			return nil, err
+		}
+		if params.Since.IsZero() {
+			return nil, errors.New("since_id requires since")
+		}
+	}
+	return params, nil
+}
@@ -91,6 +91,11 @@ func GetPost(w http.ResponseWriter, r *http.Request) {
 	if qs, ok := r.URL.Query()["related"]; ok {
 		params = strings.Split(qs[0], ",")
 	}
+	html, err := parseHTMLParam(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
 	res, err := queries.GetPostInfoByID(id, &params)
 	if err != nil {
@@ -110,6 +115,20 @@ func GetPost(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	attachments, err := queries.GetPostAttachments(id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.Attachments = *attachments
+	if html {
+		queries.RenderPost(res.Post)
+		if res.Thread != nil {
+			queries.RenderThread(res.Thread)
+		}
+	}
+	setETagVersion(w, res.Post.Version)
 
 	j, err := res.MarshalJSON()
 	if err != nil {
@@ -141,8 +160,25 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := queries.UpdatePostByID(id, p)
+	var res *models.Post
+	if r.Header.Get("If-Match") != "" {
+		var cur *models.Post
+		cur, err = queries.GetPostByID(id)
+		if err == nil {
+			// the client has read the post through GetPost
+			if !checkIfMatch(w, r, cur.Version) {
+				return
+			}
+			res, err = queries.UpdatePostIfUnchanged(p, cur)
+		}
+	} else {
+		res, err = queries.UpdatePostByID(id, p)
+	}
 	if err != nil {
+		if err == queries.ErrRecordChanged {
+			writeErrorMessage(w, http.StatusPreconditionFailed, err.Error())
+			return
+		}
 		switch err.(type) {
 		case *queries.RecordNotFoundError:
 			j, jErr := models.ErrorMessage{Message: err.Error()}.MarshalJSON()
@@ -170,37 +206,32 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetThreadPosts(w http.ResponseWriter, r *http.Request) {
-	params := &models.ThreadPostsQueryArgs{}
-	query := r.URL.Query()
-	rawLimit := query.Get("limit")
-	var err error
-	if rawLimit != "" {
-		params.Limit, err = strconv.ParseUint(rawLimit, 10, 64)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-	rawSince := query.Get("since")
-	if rawSince != "" {
-		params.Since, err = strconv.ParseUint(rawSince, 10, 64)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	params, err := parseThreadPostsQueryArgs(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
-	params.Sort = query.Get("sort")
-	rawDesc := query.Get("desc")
-	if rawDesc != "" {
-		params.Desc, err = strconv.ParseBool(rawDesc)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	html, err := parseHTMLParam(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 	path := mux.Vars(r)["slug_or_id"]
 
-	res, err := queries.GetThreadPosts(path, params)
+	clampListLimit(&params.Limit)
+	lw := &listWriter{w: w, nullEmpty: true}
+	err = queries.StreamThreadPosts(path, params, func(p *models.Post) error {
+		if html {
+			queries.RenderPost(p)
+		}
+		return lw.add(p)
+	})
+	if err != nil && lw.sent {
+		// the status is out already, drop the connection so that
+		// the client can't take a truncated list for a whole one
+		log.Println(err)
+		panic(http.ErrAbortHandler)
+	}
 	if err != nil {
 		if err == queries.ErrParentPostIsNotInThisThread {
 			j, jErr := models.ErrorMessage{Message: err.Error()}.MarshalJSON()
@@ -239,12 +270,8 @@ func GetThreadPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// if records have been inserted successfully
-	j, err := res.MarshalJSON()
+	err = lw.close()
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
 	}
-	fmt.Fprintln(w, string(j))
 }
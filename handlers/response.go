@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+func writeErrorMessage(w http.ResponseWriter, status int, msg string) {
+	j, err := models.ErrorMessage{Message: msg}.MarshalJSON()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	fmt.Fprintln(w, string(j))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v json.Marshaler) {
+	j, err := v.MarshalJSON()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	fmt.Fprintln(w, string(j))
+}
+
+func writeListError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *queries.RecordNotFoundError:
+		writeErrorMessage(w, http.StatusNotFound, err.Error())
+	default:
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
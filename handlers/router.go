@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type route struct {
+	path    string
+	method  string
+	handler http.HandlerFunc
+}
+
+var routesV1 = []route{
+	{"/categories", "GET", withETag(GetCategories)},
+	{"/category/create", "POST", CreateCategory},
+	{"/category/{slug}", "GET", withETag(GetCategory)},
+	{"/category/{slug}/details", "POST", UpdateCategory},
+
+	{"/forums", "GET", withETag(GetForums)},
+	{"/forum/create", "POST", CreateForum},
+	{"/forum/{slug}/create", "POST", CreateThread},
+	{"/forum/{slug}/details", "GET", withETag(GetForum)},
+	{"/forum/{slug}/details", "POST", UpdateForum},
+	{"/forum/{slug}/threads", "GET", withETag(GetThreads)},
+	{"/forum/{slug}/tags", "GET", withETag(GetForumTags)},
+	{"/forum/{slug}/users", "GET", withETag(GetForumUsers)},
+	{"/forum/{slug}/webhooks", "GET", GetWebhooks},
+	{"/forum/{slug}/webhooks", "POST", CreateWebhook},
+	{"/forum/{slug}/webhooks/{id:[0-9]+}", "DELETE", DeleteWebhook},
+	{"/forum/{slug}/webhooks/{id:[0-9]+}/deliveries", "GET", GetWebhookDeliveries},
+
+	{"/attachment/{id:[0-9]+}", "DELETE", DeleteAttachment},
+
+	{"/events", "GET", GetEvents},
+
+	{"/post/{id:[0-9]+}/details", "GET", withETag(GetPost)},
+	{"/post/{id:[0-9]+}/details", "POST", UpdatePost},
+	{"/post/{id:[0-9]+}/attachments", "GET", withETag(GetAttachments)},
+	{"/post/{id:[0-9]+}/attachments", "POST", CreateAttachments},
+
+	{"/service/clear", "POST", ClearDatabase},
+	{"/service/status", "GET", GetDatabaseStatus},
+
+	{"/thread/{slug_or_id}/create", "POST", CreatePosts},
+	{"/thread/{slug_or_id}/details", "GET", withETag(GetThread)},
+	{"/thread/{slug_or_id}/details", "POST", UpdateThread},
+	{"/thread/{slug_or_id}/posts", "GET", withETag(GetThreadPosts)},
+	{"/thread/{slug_or_id}/vote", "POST", VoteForPost},
+
+	{"/user/{nickname}/avatar", "POST", SetAvatar},
+	{"/user/{nickname}/avatar", "DELETE", DeleteAvatar},
+	{"/user/{nickname}/create", "POST", CreateUser},
+	{"/user/{nickname}/feed", "GET", GetFeed},
+	{"/user/{nickname}/notifications", "GET", GetNotifications},
+	{"/user/{nickname}/notifications/read", "POST", MarkNotificationsRead},
+	{"/user/{nickname}/posts", "GET", withETag(GetUserPosts)},
+	{"/user/{nickname}/profile", "GET", GetUser},
+	{"/user/{nickname}/profile", "POST", UpdateUser},
+	{"/user/{nickname}/profile", "DELETE", DeleteUser},
+	{"/user/{nickname}/rename", "POST", RenameUser},
+	{"/user/{nickname}/stats", "GET", withETag(GetUserStats)},
+	{"/user/{nickname}/threads", "GET", withETag(GetUserThreads)},
+	{"/user/{nickname}/watch", "GET", GetWatchList},
+	{"/user/{nickname}/watch/forum/{slug}", "POST", WatchForum},
+	{"/user/{nickname}/watch/forum/{slug}", "DELETE", UnwatchForum},
+	{"/user/{nickname}/watch/thread/{slug_or_id}", "POST", WatchThread},
+	{"/user/{nickname}/watch/thread/{slug_or_id}", "DELETE", UnwatchThread},
+	{"/user/{nickname}/watch/thread/{slug_or_id}/read", "POST", MarkThreadRead},
+}
+
+// routesV2 override v1 endpoints whose behaviour can't change without
+// breaking v1 clients. Everything else is served by the v1 handlers.
+var routesV2 = []route{
+	{"/forum/{slug}/threads", "GET", withETag(GetThreadsV2)},
+	{"/forum/{slug}/users", "GET", withETag(GetForumUsersV2)},
+	{"/thread/{slug_or_id}/posts", "GET", withETag(GetThreadPostsV2)},
+}
+
+// RegisterRoutes mounts v1 endpoints on the /api subrouter.
+func RegisterRoutes(api *mux.Router) {
+	for _, rt := range routesV1 {
+		api.HandleFunc(rt.path, rt.handler).Methods(rt.method)
+	}
+}
+
+// RegisterRoutesV2 mounts v2 endpoints on the /api/v2 subrouter.
+func RegisterRoutesV2(api *mux.Router) {
+	// the first matching route wins, so overrides go first
+	for _, rt := range routesV2 {
+		api.HandleFunc(rt.path, rt.handler).Methods(rt.method)
+	}
+	RegisterRoutes(api)
+}
+
+// RegisterStreamRoutes mounts the endpoints that go without the API
+// middlewares under prefix of r: live updates hold connections open and
+// files are sent as they are, with range requests.
+func RegisterStreamRoutes(r *mux.Router, prefix string, lv *Live) {
+	r.HandleFunc(prefix+"/thread/{slug_or_id}/live", lv.ServeThread).Methods("GET")
+	r.HandleFunc(prefix+"/forum/{slug}/live", lv.ServeForum).Methods("GET")
+	r.HandleFunc(prefix+"/attachment/{id:[0-9]+}", ServeAttachment).Methods("GET")
+	r.HandleFunc(prefix+"/attachment/{id:[0-9]+}/thumbnail", ServeAttachmentThumbnail).Methods("GET")
+	r.HandleFunc(prefix+"/user/{nickname}/avatar", ServeAvatar).Methods("GET")
+	r.HandleFunc(prefix+"/user/{nickname}/avatar/thumbnail", ServeAvatarThumbnail).Methods("GET")
+	r.HandleFunc(prefix+"/user/{nickname}/export", ExportUser).Methods("GET")
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mailru/easyjson"
+	"github.com/mailru/easyjson/jwriter"
+)
+
+// streamFlushSize is how much of a list is buffered before it is sent.
+const streamFlushSize = 32 << 10
+
+// listWriter writes a JSON array element by element, so long lists are
+// never held in memory. Nothing is sent until the first flush, errors
+// before it can still get a proper status.
+type listWriter struct {
+	w         http.ResponseWriter
+	out       jwriter.Writer
+	n         int
+	sent      bool
+	nullEmpty bool // v1 answers null for empty lists
+}
+
+func (lw *listWriter) add(v easyjson.Marshaler) error {
+	if lw.n == 0 {
+		lw.out.RawByte('[')
+	} else {
+		lw.out.RawByte(',')
+	}
+	lw.n++
+	v.MarshalEasyJSON(&lw.out)
+	if lw.out.Size() < streamFlushSize {
+		return nil
+	}
+	return lw.flush()
+}
+
+func (lw *listWriter) flush() error {
+	if lw.out.Error != nil {
+		return lw.out.Error
+	}
+	lw.sent = true
+	_, err := lw.out.DumpTo(lw.w)
+	return err
+}
+
+func (lw *listWriter) close() error {
+	switch {
+	case lw.n != 0:
+		lw.out.RawByte(']')
+	case lw.nullEmpty:
+		lw.out.RawString("null")
+	default:
+		lw.out.RawString("[]")
+	}
+	lw.out.RawByte('\n')
+	return lw.flush()
+}
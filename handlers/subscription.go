@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+func WatchThread(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	res, created, err := queries.WatchThread(vars["nickname"], vars["slug_or_id"])
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, res)
+}
+
+func UnwatchThread(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := queries.UnwatchThread(vars["nickname"], vars["slug_or_id"]); err != nil {
+		writeListError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func MarkThreadRead(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+	lr := &models.LastRead{}
+	if len(body) != 0 {
+		if err = lr.UnmarshalJSON(body); err != nil || lr.Post < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	vars := mux.Vars(r)
+	res, err := queries.MarkThreadRead(vars["nickname"], vars["slug_or_id"], lr.Post)
+	if err == queries.ErrPostIsNotInThisThread {
+		writeErrorMessage(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func WatchForum(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	res, created, err := queries.WatchForum(vars["nickname"], vars["slug"])
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, res)
+}
+
+func UnwatchForum(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := queries.UnwatchForum(vars["nickname"], vars["slug"]); err != nil {
+		writeListError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetWatchList(w http.ResponseWriter, r *http.Request) {
+	res, err := queries.GetWatchList(mux.Vars(r)["nickname"])
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// Feed cursors are opaque to clients: the position of the last item as
+// "created|type|id" in base64.
+
+func encodeFeedCursor(c *models.FeedCursor) string {
+	s := c.Created.Format(time.RFC3339Nano) + "|" + c.Type + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+var errBadCursor = errors.New("bad cursor")
+
+func decodeFeedCursor(s string) (*models.FeedCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) != 3 {
+		return nil, errBadCursor
+	}
+	c := &models.FeedCursor{Type: parts[1]}
+	c.Created, err = time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, errBadCursor
+	}
+	c.ID, err = strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, errBadCursor
+	}
+	return c, nil
+}
+
+func GetFeed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := uint64(0)
+	cursor := &models.FeedCursor{}
+	var err error
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.ParseUint(raw, 10, 64)
+	}
+	if raw := query.Get("cursor"); raw != "" && err == nil {
+		cursor, err = decodeFeedCursor(raw)
+	}
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := queries.GetFeed(mux.Vars(r)["nickname"], cursor, limit)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if n := len(*res); uint64(n) == limit {
+		last := (*res)[n-1]
+		c := &models.FeedCursor{Type: last.Type}
+		if last.Thread != nil {
+			c.ID = last.Thread.ThreadID
+			c.Created = time.Unix(0, 0) // threads without a date are sorted as created at the epoch
+			if last.Thread.ThreadCreated != nil {
+				c.Created = *last.Thread.ThreadCreated
+			}
+		} else {
+			c.ID, c.Created = last.Post.PostID, last.Post.PostCreated
+		}
+		setNextLink(w, r, map[string]string{"cursor": encodeFeedCursor(c)})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -5,8 +5,6 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
 
@@ -33,7 +31,7 @@ func CreateThread(w http.ResponseWriter, r *http.Request) {
 	res, err := queries.CreateThread(t)
 	if err != nil {
 		switch err.(type) {
-		case *queries.NullFieldError:
+		case *queries.NullFieldError, *queries.ValidationError:
 			j, jErr := models.ErrorMessage{Message: err.Error()}.MarshalJSON()
 			if jErr != nil {
 				log.Println(err)
@@ -79,38 +77,30 @@ func CreateThread(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetThreads(w http.ResponseWriter, r *http.Request) {
-	params := &models.ThreadQueryParams{}
-	query := r.URL.Query()
-	rawDesc := query.Get("desc")
-	var err error
-	if rawDesc != "" {
-		params.Desc, err = strconv.ParseBool(rawDesc)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-	rawLimit := query.Get("limit")
-	if rawLimit != "" {
-		params.Limit, err = strconv.ParseUint(rawLimit, 10, 64)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-	rawTime := query.Get("since")
-	if rawTime != "" {
-		params.Since, err = time.Parse("2006-01-02T15:04:05.000Z07:00", rawTime)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	params, err := parseThreadQueryParams(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
+	html, err := parseHTMLParam(r.URL.Query())
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	res, err := queries.GetAllThreadsInForum(mux.Vars(r)["slug"], params)
+	clampListLimit(&params.Limit)
+	lw := &listWriter{w: w, nullEmpty: true}
+	err = queries.StreamThreadsInForum(mux.Vars(r)["slug"], params, func(t *models.Thread) error {
+		if html {
+			queries.RenderThread(t)
+		}
+		return lw.add(t)
+	})
+	if err != nil && lw.sent {
+		// the status is out already, drop the connection so that
+		// the client can't take a truncated list for a whole one
+		log.Println(err)
+		panic(http.ErrAbortHandler)
+	}
 	if err != nil {
 		switch err.(type) {
 		case *queries.RecordNotFoundError:
@@ -129,17 +119,19 @@ func GetThreads(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	j, jErr := res.MarshalJSON()
-	if jErr != nil {
+	err = lw.close()
+	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
 	}
-	fmt.Fprintln(w, string(j))
 }
 
 func GetThread(w http.ResponseWriter, r *http.Request) {
 	path := mux.Vars(r)["slug_or_id"]
+	html, err := parseHTMLParam(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
 	res, err := queries.GetThreadBySlugOrID(path)
 	if err != nil {
@@ -159,6 +151,10 @@ func GetThread(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if html {
+		queries.RenderThread(res)
+	}
+	setETagVersion(w, res.Version)
 
 	j, err := res.MarshalJSON()
 	if err != nil {
@@ -185,10 +181,27 @@ func UpdateThread(w http.ResponseWriter, r *http.Request) {
 	}
 	path := mux.Vars(r)["slug_or_id"]
 
-	res, err := queries.UpdateThread(t, path)
+	var res *models.Thread
+	if r.Header.Get("If-Match") != "" {
+		var cur *models.Thread
+		cur, err = queries.GetThreadBySlugOrID(path)
+		if err == nil {
+			// the client has read the thread through GetThread
+			if !checkIfMatch(w, r, cur.Version) {
+				return
+			}
+			res, err = queries.UpdateThreadIfUnchanged(t, cur)
+		}
+	} else {
+		res, err = queries.UpdateThread(t, path)
+	}
 	if err != nil {
+		if err == queries.ErrRecordChanged {
+			writeErrorMessage(w, http.StatusPreconditionFailed, err.Error())
+			return
+		}
 		switch err.(type) {
-		case *queries.NullFieldError:
+		case *queries.NullFieldError, *queries.ValidationError:
 			j, jErr := models.ErrorMessage{Message: err.Error()}.MarshalJSON()
 			if jErr != nil {
 				log.Println(err)
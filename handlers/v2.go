@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+// v2 list endpoints always paginate, answer 400 with an error body and
+// return [] instead of null for empty lists. They are not streamed: the
+// next link needs the last record before the body goes out, and the page
+// is bounded by maxListLimit anyway.
+
+func checkListLimit(limit *uint64) error {
+	switch {
+	case *limit == 0:
+		*limit = defaultListLimit
+	case *limit > maxListLimit:
+		return fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	return nil
+}
+
+// setNextLink advertises the next page, which starts after the last
+// returned record.
+func setNextLink(w http.ResponseWriter, r *http.Request, since map[string]string) {
+	query := r.URL.Query()
+	for k, v := range since {
+		query.Set(k, v)
+	}
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Add("Link", "<"+next.String()+`>; rel="next"`)
+}
+
+func GetThreadsV2(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params, err := parseThreadQueryParams(query)
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&params.Limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	html, err := parseHTMLParam(query)
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "html must be a boolean")
+		return
+	}
+	if rawSinceID := query.Get("since_id"); rawSinceID != "" {
+		params.SinceID, err = strconv.Atoi(rawSinceID)
+		if err != nil || params.Since.IsZero() {
+			writeErrorMessage(w, http.StatusBadRequest, "since_id must be a number and requires since")
+			return
+		}
+	}
+
+	res, err := queries.GetAllThreadsInForum(mux.Vars(r)["slug"], params)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.ThreadList{}
+	}
+	if html {
+		for k := range *res {
+			queries.RenderThread(&(*res)[k])
+		}
+	}
+	if n := len(*res); uint64(n) == params.Limit {
+		last := (*res)[n-1]
+		setNextLink(w, r, map[string]string{
+			"since":    last.ThreadCreated.Format(sinceTimeLayout),
+			"since_id": strconv.Itoa(last.ThreadID),
+		})
+	}
+
+	j, err := res.MarshalJSON()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, string(j))
+}
+
+func GetForumUsersV2(w http.ResponseWriter, r *http.Request) {
+	params, err := parseUserQueryParams(r.URL.Query())
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&params.Limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := queries.GetAllUsersInForum(mux.Vars(r)["slug"], params)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.ForumUserList{}
+	}
+	if n := len(*res); uint64(n) == params.Limit {
+		setNextLink(w, r, map[string]string{"since": (*res)[n-1].Nickname})
+	}
+
+	j, err := res.MarshalJSON()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, string(j))
+}
+
+func GetThreadPostsV2(w http.ResponseWriter, r *http.Request) {
+	params, err := parseThreadPostsQueryArgs(r.URL.Query())
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+		return
+	}
+	if err = checkListLimit(&params.Limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	html, err := parseHTMLParam(r.URL.Query())
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "html must be a boolean")
+		return
+	}
+	switch params.Sort {
+	case "":
+		params.Sort = "flat"
+	case "flat", "tree", "parent_tree":
+	default:
+		writeErrorMessage(w, http.StatusBadRequest, "sort must be one of flat, tree, parent_tree")
+		return
+	}
+
+	res, err := queries.GetThreadPosts(mux.Vars(r)["slug_or_id"], params)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	if *res == nil {
+		*res = models.PostList{}
+	}
+	if html {
+		for k := range *res {
+			queries.RenderPost(&(*res)[k])
+		}
+	}
+	// parent_tree pages by root posts, so the limit applies to them
+	// and the cursor is the root of the last tree
+	count, last := uint64(len(*res)), 0
+	if params.Sort == "parent_tree" {
+		count = 0
+		for _, p := range *res {
+			if p.Parent == 0 {
+				count++
+				last = p.PostID
+			}
+		}
+	} else if count != 0 {
+		last = (*res)[count-1].PostID
+	}
+	if count == params.Limit {
+		setNextLink(w, r, map[string]string{"since": strconv.Itoa(last)})
+	}
+
+	j, err := res.MarshalJSON()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, string(j))
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	APIPrefixV1 = "/api"
+	APIPrefixV2 = "/api/v2"
+)
+
+func APIVersionMiddleware(version string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("API-Version", version)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DeprecationMiddleware marks v1 endpoints that have a v2 replacement
+// and points clients to the successor.
+func DeprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasV2Replacement(r) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", "<"+APIPrefixV2+strings.TrimPrefix(r.URL.Path, APIPrefixV1)+
+				`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasV2Replacement(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	tpl = strings.TrimPrefix(tpl, APIPrefixV1)
+	for _, rt := range routesV2 {
+		if rt.path == tpl && rt.method == r.Method {
+			return true
+		}
+	}
+	return false
+}
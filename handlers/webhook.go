@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+	wh := &models.Webhook{}
+	err = wh.UnmarshalJSON(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wh.Forum = mux.Vars(r)["slug"]
+
+	res, err := queries.CreateWebhook(wh)
+	if err != nil {
+		switch err.(type) {
+		case *queries.NullFieldError, *queries.ValidationError:
+			writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		case *queries.RecordNotFoundError:
+			writeErrorMessage(w, http.StatusNotFound, err.Error())
+		default:
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	res, err := queries.GetForumWebhooks(mux.Vars(r)["slug"])
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"]) // checked by the route
+	err := queries.DeleteWebhook(mux.Vars(r)["slug"], id)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	limit := uint64(0)
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.ParseUint(rawLimit, 10, 64)
+		if err != nil {
+			writeErrorMessage(w, http.StatusBadRequest, "invalid query parameters: "+err.Error())
+			return
+		}
+	}
+	if err := checkListLimit(&limit); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := queries.GetWebhookDeliveries(mux.Vars(r)["slug"], id, limit)
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,169 @@
+// Package live fans out forum events to clients subscribed to a thread or
+// a forum.
+package live
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// Publisher gets events of successful writes.
+type Publisher interface {
+	// Publish assigns e an ID and delivers it to subscribers of its topics.
+	Publish(e *models.Event)
+}
+
+// Hub is a Publisher clients can subscribe to. Local keeps everything in
+// the process, events of other servers reach it when they are published
+// through Postgres NOTIFY (see queries.UseNotifyHub).
+type Hub interface {
+	Publisher
+	// Subscribe returns the events of topic with IDs above lastID that
+	// are still known followed by new ones. lastID 0 means only new events.
+	Subscribe(topic string, lastID int64) Subscription
+}
+
+// Subscription is closed by the hub when the subscriber falls behind,
+// it can resume with the ID of the last event it got.
+type Subscription interface {
+	Events() <-chan models.Event
+	Close()
+}
+
+func ThreadTopic(id int) string {
+	return "thread:" + strconv.Itoa(id)
+}
+
+// slugs are case insensitive
+func ForumTopic(slug string) string {
+	return "forum:" + strings.ToLower(slug)
+}
+
+func topicsOf(e *models.Event) []string {
+	if e.Thread == 0 {
+		return []string{ForumTopic(e.Forum)}
+	}
+	return []string{ForumTopic(e.Forum), ThreadTopic(e.Thread)}
+}
+
+// Nop drops events.
+type Nop struct{}
+
+func (Nop) Publish(e *models.Event) {}
+
+// subscriberBuffer is how far a subscriber can fall behind before it is
+// dropped.
+const subscriberBuffer = 256
+
+type subscription struct {
+	hub    *Local
+	topic  string
+	c      chan models.Event
+	closed bool
+}
+
+func (s *subscription) Events() <-chan models.Event {
+	return s.c
+}
+
+func (s *subscription) Close() {
+	s.hub.mu.Lock()
+	s.hub.drop(s)
+	s.hub.mu.Unlock()
+}
+
+// Local is an in-process Hub remembering the last events for resuming
+// subscribers. Event IDs are only meaningful to the process that
+// assigned them, a subscriber resuming on another server is reset.
+type Local struct {
+	mu      sync.Mutex
+	lastID  int64
+	history []models.Event // IDs without gaps, oldest first
+	size    int
+	subs    map[string]map[*subscription]struct{}
+}
+
+// NewLocal returns a hub keeping historySize last events for resuming.
+func NewLocal(historySize int) *Local {
+	return &Local{
+		size: historySize,
+		subs: map[string]map[*subscription]struct{}{},
+	}
+}
+
+func (h *Local) Publish(e *models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e.ID = h.lastID
+	if h.size > 0 {
+		h.history = append(h.history, *e)
+		if len(h.history) >= 2*h.size {
+			h.history = append(h.history[:0:0], h.history[len(h.history)-h.size:]...)
+		}
+	}
+	for _, topic := range topicsOf(e) {
+		for s := range h.subs[topic] {
+			select {
+			case s.c <- *e:
+			default:
+				h.drop(s)
+			}
+		}
+	}
+}
+
+func (h *Local) Subscribe(topic string, lastID int64) Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []models.Event
+	if lastID > 0 && lastID < h.lastID {
+		first := h.lastID - int64(len(h.history)) + 1
+		if lastID+1 < first {
+			lastID = first - 1
+			replay = append(replay, models.Event{ID: lastID, Type: models.EventReset})
+		}
+		for _, e := range h.history[lastID+1-first:] {
+			for _, t := range topicsOf(&e) {
+				if t == topic {
+					replay = append(replay, e)
+				}
+			}
+		}
+	} else if lastID > h.lastID {
+		// IDs of another process or from before a restart
+		replay = append(replay, models.Event{ID: h.lastID, Type: models.EventReset})
+	}
+
+	s := &subscription{
+		hub:   h,
+		topic: topic,
+		c:     make(chan models.Event, len(replay)+subscriberBuffer),
+	}
+	for _, e := range replay {
+		s.c <- e
+	}
+	if h.subs[topic] == nil {
+		h.subs[topic] = map[*subscription]struct{}{}
+	}
+	h.subs[topic][s] = struct{}{}
+	return s
+}
+
+// drop must be called with mu held.
+func (h *Local) drop(s *subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.c)
+	delete(h.subs[s.topic], s)
+	if len(h.subs[s.topic]) == 0 {
+		delete(h.subs, s.topic)
+	}
+}
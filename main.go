@@ -1,9 +1,14 @@
 package main
 
+//go:generate go run -mod=vendor ./cmd/speccheck -spec swagger.yml
+
 import (
+	_ "embed" // API specification
 	"flag"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
@@ -11,49 +16,148 @@ import (
 
 	metrics "github.com/ArtAndreev/highload-load-balancing/highload-metrics"
 
+	"github.com/ArtAndreev/ForumTP/cache"
 	"github.com/ArtAndreev/ForumTP/handlers"
+	"github.com/ArtAndreev/ForumTP/live"
 	"github.com/ArtAndreev/ForumTP/queries"
+	"github.com/ArtAndreev/ForumTP/spec"
+	"github.com/ArtAndreev/ForumTP/storage"
+	"github.com/ArtAndreev/ForumTP/webhook"
 )
 
+// version is set on build with -ldflags "-X main.version=..."
+var version = "dev"
+
+//go:embed swagger.yml
+var swaggerYML []byte
+
 func main() {
 	promNS := flag.String("metrics_ns", "forum", "namespace for prometheus metrics")
+	publicURL := flag.String("public_url", "http://localhost:5000", "URL the API is reachable at, used in the served specification")
+	dbAddr := flag.String("db", "docker:docker@localhost:5432", "database address user:password@host:port")
+	dbName := flag.String("db_name", "docker", "database name")
+	replicaAddrs := flag.String("replicas", "", "comma separated addresses of read replicas, user:password@host:port")
+	replicaCheck := flag.Duration("replica_check", 5*time.Second, "how often replicas are health checked")
+	migrateMode := flag.String("migrate", queries.MigrateStrict, `apply migrations on start: "strict" fails on errors, "log" only logs them, "off" skips them`)
+	timezone := flag.String("timezone", "UTC", "timezone API timestamps are serialized in, an IANA name")
+	cacheSize := flag.Int("cache_size", 10000, "entries kept by each record cache, 0 disables caching")
+	cacheTTL := flag.Duration("cache_ttl", time.Minute, "how long cached records live, bounds staleness between replicas")
+	liveHistory := flag.Int("live_history", 1000, "events kept for live subscribers resuming with the last event ID")
+	liveNotify := flag.Bool("live_notify", false, "share live events between servers of the database with LISTEN/NOTIFY")
+	webhookPoll := flag.Duration("webhook_poll", time.Second, "how often the webhook outbox is checked for due deliveries, 0 disables delivery")
+	eventsRetain := flag.Duration("events_retention", 7*24*time.Hour, "how long the change feed keeps events, 0 keeps them forever")
+	eventsCompact := flag.Duration("events_compact_after", 24*time.Hour, "age after which only the last event of every record is kept, 0 disables compaction")
+	attachDir := flag.String("attachments_dir", "attachments", "directory attachment files are kept in, empty disables attachments")
+	attachMaxSize := flag.Int64("attachment_max_size", 10<<20, "largest attachment accepted, in bytes")
+	attachTypes := flag.String("attachment_types", strings.Join(queries.DefaultAttachmentTypes, ","), "comma separated media types attachments may have")
+	attachGrace := flag.Duration("attachments_gc_grace", 24*time.Hour, "how long files no post has any more are kept before they are deleted")
+	specMode := flag.String("spec_validation", "", `validate requests and responses against the spec: "log" or "strict"`)
 	flag.Parse()
 
 	metrics.InitMetrics(*promNS)
 	prometheus.MustRegister(metrics.AccessHits)
+	cache.InitMetrics(*promNS)
+	prometheus.MustRegister(cache.Requests)
 
 	r := mux.NewRouter()
 	r.Handle("/metrics", promhttp.Handler())
 
-	api := r.PathPrefix("/api").Subrouter()
-	api.Use(handlers.ApplicationJSONMiddleware)
-	api.Use(metrics.CountHitsMiddleware)
-
-	api.HandleFunc("/forum/create", handlers.CreateForum).Methods("POST")
-	api.HandleFunc("/forum/{slug}/create", handlers.CreateThread).Methods("POST")
-	api.HandleFunc("/forum/{slug}/details", handlers.GetForum).Methods("GET")
-	api.HandleFunc("/forum/{slug}/threads", handlers.GetThreads).Methods("GET")
-	api.HandleFunc("/forum/{slug}/users", handlers.GetForumUsers).Methods("GET")
+	docs, err := handlers.NewDocs(swaggerYML, *publicURL, version)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r.HandleFunc("/api/openapi.yml", docs.ServeYAML).Methods("GET")
+	r.HandleFunc("/api/openapi.json", docs.ServeJSON).Methods("GET")
+	r.HandleFunc("/api/docs", docs.ServeHTML).Methods("GET")
 
-	api.HandleFunc("/post/{id:[0-9]+}/details", handlers.GetPost).Methods("GET")
-	api.HandleFunc("/post/{id:[0-9]+}/details", handlers.UpdatePost).Methods("POST")
+	// live updates hold connections open and files are sent as they are,
+	// so they go without middlewares
+	hub := live.NewLocal(*liveHistory)
+	lv := handlers.NewLive(hub)
+	for _, prefix := range []string{handlers.APIPrefixV2, handlers.APIPrefixV1} {
+		handlers.RegisterStreamRoutes(r, prefix, lv)
+	}
 
-	api.HandleFunc("/service/clear", handlers.ClearDatabase).Methods("POST")
-	api.HandleFunc("/service/status", handlers.GetDatabaseStatus).Methods("GET")
+	var apiSpec *spec.Spec
+	if *specMode != "" {
+		apiSpec, err = spec.Parse(swaggerYML)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("validating API against the spec (%v mode)\n", *specMode)
+	}
 
-	api.HandleFunc("/thread/{slug_or_id}/create", handlers.CreatePosts).Methods("POST")
-	api.HandleFunc("/thread/{slug_or_id}/details", handlers.GetThread).Methods("GET")
-	api.HandleFunc("/thread/{slug_or_id}/details", handlers.UpdateThread).Methods("POST")
-	api.HandleFunc("/thread/{slug_or_id}/posts", handlers.GetThreadPosts).Methods("GET")
-	api.HandleFunc("/thread/{slug_or_id}/vote", handlers.VoteForPost).Methods("POST")
+	// v2 goes first as /api would match its paths too
+	apiV2 := r.PathPrefix(handlers.APIPrefixV2).Subrouter()
+	apiV2.Use(handlers.CompressionMiddleware)
+	apiV2.Use(handlers.ApplicationJSONMiddleware)
+	apiV2.Use(handlers.APIVersionMiddleware("2"))
+	apiV2.Use(metrics.CountHitsMiddleware)
+	if *specMode != "" {
+		apiV2.Use(spec.Middleware(apiSpec, handlers.APIPrefixV2, *specMode))
+	}
+	handlers.RegisterRoutesV2(apiV2)
 
-	api.HandleFunc("/user/{nickname}/create", handlers.CreateUser).Methods("POST")
-	api.HandleFunc("/user/{nickname}/profile", handlers.GetUser).Methods("GET")
-	api.HandleFunc("/user/{nickname}/profile", handlers.UpdateUser).Methods("POST")
+	api := r.PathPrefix(handlers.APIPrefixV1).Subrouter()
+	api.Use(handlers.CompressionMiddleware)
+	api.Use(handlers.ApplicationJSONMiddleware)
+	api.Use(handlers.APIVersionMiddleware("1"))
+	api.Use(handlers.DeprecationMiddleware)
+	api.Use(metrics.CountHitsMiddleware)
+	if *specMode != "" {
+		api.Use(spec.Middleware(apiSpec, handlers.APIPrefixV1, *specMode))
+	}
+	handlers.RegisterRoutes(api)
 
-	db := queries.InitDB("docker:docker@localhost:5432", "docker")
+	if err := queries.SetTimezone(*timezone); err != nil {
+		log.Fatal(err)
+	}
+	if *cacheSize > 0 {
+		queries.UseCache(func(name string) cache.Cache {
+			return cache.NewLRU(name, *cacheSize, *cacheTTL)
+		})
+	}
+	if *attachDir != "" {
+		s, err := storage.NewLocal(*attachDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		types := []string{}
+		for _, t := range strings.Split(*attachTypes, ",") {
+			types = append(types, strings.TrimSpace(t))
+		}
+		queries.UseStorage(s, queries.AttachmentLimits{MaxSize: *attachMaxSize, Types: types, Thumbnail: 256})
+	}
+	db := queries.InitDB(*dbAddr, *dbName, *migrateMode)
 	defer db.Close()
+	if *replicaAddrs != "" {
+		for _, addr := range strings.Split(*replicaAddrs, ",") {
+			if err := queries.AddReplica(strings.TrimSpace(addr), *dbName); err != nil {
+				log.Fatal(err)
+			}
+		}
+		go queries.CheckReplicas(*replicaCheck)
+	}
+	if *liveNotify {
+		if err := queries.UseNotifyHub(hub, *dbAddr, *dbName); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		queries.UseHub(hub)
+	}
+	go queries.RunEventsSequencer(time.Second)
+	go queries.FinishRenames()
+	go queries.FinishDeletions()
+	if *eventsRetain > 0 || *eventsCompact > 0 {
+		go queries.RunEventsRetention(time.Hour, *eventsRetain, *eventsCompact)
+	}
+	if *attachDir != "" {
+		go queries.RunBlobCollector(time.Hour, *attachGrace)
+	}
+	if *webhookPoll > 0 {
+		go webhook.NewDispatcher().Run(*webhookPoll)
+	}
 
-	log.Println("starting server at:", 5000)
+	log.Printf("starting server %v at: %v\n", version, 5000)
 	http.ListenAndServe(":5000", r)
 }
@@ -0,0 +1,451 @@
+// Package markdown renders post and thread messages to HTML that is safe
+// to put into a page as is.
+//
+// The syntax is CommonMark without reference links and raw HTML, plus the
+// tables, strikethrough and bare links of GitHub. Raw HTML is escaped
+// rather than filtered, and links and images only keep URLs of a few
+// schemes, so whatever the input, the output carries no markup of its own
+// and nothing a browser would run.
+package markdown
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDepth bounds the nesting of block quotes and lists, deeper markers
+// are left as text.
+const maxDepth = 16
+
+// maxFilledCells bounds the empty cells added to short table rows, past
+// it the table ends. A wide header over many short rows would take far
+// more output than input otherwise.
+const maxFilledCells = 10000
+
+var (
+	atxRe        = regexp.MustCompile(`^ {0,3}(#{1,6})(?: +(.*)|$)`)
+	hrRe         = regexp.MustCompile(`^ {0,3}(?:(?:\* *){3,}|(?:- *){3,}|(?:_ *){3,})$`)
+	fenceRe      = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+	quoteRe      = regexp.MustCompile(`^ {0,3}> ?`)
+	bulletRe     = regexp.MustCompile(`^( {0,3})([-+*])( *)`)
+	orderedRe    = regexp.MustCompile(`^( {0,3})([0-9]{1,9})([.)])( *)`)
+	setextRe     = regexp.MustCompile(`^ {0,3}(=+|-+) *$`)
+	tableDelimRe = regexp.MustCompile(`^ {0,3}\|? *:?-+:? *(?:\| *:?-+:? *)*\|? *$`)
+)
+
+// Render returns the HTML of a Markdown text.
+func Render(src string) string {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = strings.Replace(src, "\r", "\n", -1)
+	src = strings.Replace(src, "\x00", "\uFFFD", -1)
+	lines := strings.Split(src, "\n")
+	for k, l := range lines {
+		lines[k] = expandTabs(l)
+	}
+	b := &strings.Builder{}
+	renderBlocks(b, lines, false, 0)
+	return b.String()
+}
+
+// renderBlocks writes the blocks of lines, paragraphs go without <p> in
+// tight lists.
+func renderBlocks(b *strings.Builder, lines []string, tight bool, depth int) {
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		switch {
+		case isBlank(l):
+			i++
+		case indent(l) >= 4:
+			i = indentedCode(b, lines, i)
+		case isFence(l):
+			i = fencedCode(b, lines, i)
+		case hrRe.MatchString(l):
+			b.WriteString("<hr />\n")
+			i++
+		case atxRe.MatchString(l):
+			atxHeading(b, l)
+			i++
+		case depth < maxDepth && quoteRe.MatchString(l):
+			i = blockquote(b, lines, i, depth)
+		case depth < maxDepth && isListItem(l):
+			i = list(b, lines, i, depth)
+		case isTableStart(lines, i):
+			i = table(b, lines, i)
+		default:
+			i = paragraph(b, lines, i, tight)
+		}
+	}
+}
+
+// interruptsParagraph tells whether l starts a block rather than
+// continuing the paragraph above it.
+func interruptsParagraph(l string) bool {
+	if hrRe.MatchString(l) || atxRe.MatchString(l) || quoteRe.MatchString(l) || isFence(l) {
+		return true
+	}
+	// only lists that can't be taken for text do
+	m, ok := parseListMarker(l)
+	return ok && !isBlank(m.content) && (!m.ordered || m.start == 1)
+}
+
+func paragraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	par := []string{strings.TrimLeft(lines[i], " ")}
+	for i++; i < len(lines); i++ {
+		l := lines[i]
+		if isBlank(l) {
+			break
+		}
+		if m := setextRe.FindStringSubmatch(l); m != nil {
+			level := 2
+			if m[1][0] == '=' {
+				level = 1
+			}
+			heading(b, level, strings.TrimSpace(strings.Join(par, "\n")))
+			return i + 1
+		}
+		if interruptsParagraph(l) {
+			break
+		}
+		par = append(par, strings.TrimLeft(l, " "))
+	}
+	text := renderInline(strings.TrimRight(strings.Join(par, "\n"), " "))
+	if tight {
+		b.WriteString(text)
+		return i
+	}
+	b.WriteString("<p>")
+	b.WriteString(text)
+	b.WriteString("</p>\n")
+	return i
+}
+
+func heading(b *strings.Builder, level int, text string) {
+	tag := "h" + strconv.Itoa(level)
+	b.WriteString("<" + tag + ">")
+	b.WriteString(renderInline(text))
+	b.WriteString("</" + tag + ">\n")
+}
+
+func atxHeading(b *strings.Builder, l string) {
+	m := atxRe.FindStringSubmatch(l)
+	text := strings.TrimRight(m[2], " ")
+	// the closing sequence is optional and needs a space before it
+	if t := strings.TrimRight(text, "#"); t == "" {
+		text = ""
+	} else if strings.HasSuffix(t, " ") {
+		text = strings.TrimRight(t, " ")
+	}
+	heading(b, len(m[1]), text)
+}
+
+func indentedCode(b *strings.Builder, lines []string, i int) int {
+	code := []string{}
+	end := 0
+	for ; i < len(lines) && (isBlank(lines[i]) || indent(lines[i]) >= 4); i++ {
+		code = append(code, stripIndent(lines[i], 4))
+		if !isBlank(lines[i]) {
+			end = len(code)
+		}
+	}
+	// trailing blank lines are not part of the code
+	b.WriteString("<pre><code>")
+	for _, c := range code[:end] {
+		b.WriteString(escape(c))
+		b.WriteByte('\n')
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+func isFence(l string) bool {
+	m := fenceRe.FindStringSubmatch(l)
+	// the info string of a backtick fence can't have backticks
+	return m != nil && !(m[2][0] == '`' && strings.Contains(m[3], "`"))
+}
+
+func fencedCode(b *strings.Builder, lines []string, i int) int {
+	m := fenceRe.FindStringSubmatch(lines[i])
+	ind, fence := len(m[1]), m[2]
+	b.WriteString("<pre><code")
+	if info := strings.Fields(m[3]); len(info) != 0 {
+		b.WriteString(` class="language-` + escape(unescapeText(info[0])) + `"`)
+	}
+	b.WriteString(">")
+	for i++; i < len(lines); i++ {
+		if isClosingFence(lines[i], fence) {
+			i++
+			break
+		}
+		b.WriteString(escape(stripIndent(lines[i], ind)))
+		b.WriteByte('\n')
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+func isClosingFence(l, fence string) bool {
+	if indent(l) > 3 {
+		return false
+	}
+	s := strings.TrimSpace(l)
+	return len(s) >= len(fence) && strings.Trim(s, fence[:1]) == ""
+}
+
+func blockquote(b *strings.Builder, lines []string, i int, depth int) int {
+	inner := []string{}
+	for ; i < len(lines); i++ {
+		l := lines[i]
+		if loc := quoteRe.FindStringIndex(l); loc != nil {
+			inner = append(inner, l[loc[1]:])
+			continue
+		}
+		// a paragraph goes on without the marker
+		if isBlank(l) || isBlank(inner[len(inner)-1]) || interruptsParagraph(l) {
+			break
+		}
+		inner = append(inner, l)
+	}
+	b.WriteString("<blockquote>\n")
+	renderBlocks(b, inner, false, depth+1)
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+type listMarker struct {
+	ordered bool
+	delim   byte // the bullet or the character after the number
+	start   int
+	width   int // indent of the content
+	content string
+}
+
+func parseListMarker(l string) (listMarker, bool) {
+	m := listMarker{}
+	var end, spaces int
+	if s := bulletRe.FindStringSubmatch(l); s != nil {
+		m.delim = s[2][0]
+		end, spaces = len(s[1])+1, len(s[3])
+	} else if s := orderedRe.FindStringSubmatch(l); s != nil {
+		m.ordered = true
+		m.delim = s[3][0]
+		m.start, _ = strconv.Atoi(s[2])
+		end, spaces = len(s[1])+len(s[2])+1, len(s[4])
+	} else {
+		return m, false
+	}
+	switch {
+	case end+spaces == len(l):
+		m.width = end + 1
+	case spaces == 0:
+		return m, false
+	case spaces > 4:
+		// the content is indented code
+		m.width = end + 1
+		m.content = l[m.width:]
+	default:
+		m.width = end + spaces
+		m.content = l[m.width:]
+	}
+	return m, true
+}
+
+func isListItem(l string) bool {
+	_, ok := parseListMarker(l)
+	return ok
+}
+
+func list(b *strings.Builder, lines []string, i int, depth int) int {
+	first, _ := parseListMarker(lines[i])
+	items := [][]string{}
+	loose := false
+	for i < len(lines) && !hrRe.MatchString(lines[i]) {
+		m, ok := parseListMarker(lines[i])
+		if !ok || m.ordered != first.ordered || m.delim != first.delim {
+			break
+		}
+		if len(items) != 0 && isBlank(lines[i-1]) {
+			loose = true
+		}
+		var item []string
+		item, i = listItem(lines, i, m)
+		items = append(items, item)
+		for k := 1; k < len(item); k++ {
+			if isBlank(item[k-1]) && !isBlank(item[k]) {
+				loose = true
+			}
+		}
+	}
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, it := range items {
+		b.WriteString("<li>")
+		if loose {
+			b.WriteByte('\n')
+		}
+		renderBlocks(b, it, !loose, depth+1)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// listItem returns the content of the item starting at i without the
+// trailing blank lines, and where the next block starts.
+func listItem(lines []string, i int, m listMarker) ([]string, int) {
+	item := []string{m.content}
+	end := i + 1
+	for i++; i < len(lines); i++ {
+		l := lines[i]
+		switch {
+		case isBlank(l):
+			item = append(item, "")
+			continue
+		case indent(l) >= m.width:
+			item = append(item, l[m.width:])
+			end = i + 1
+			continue
+		case !isBlank(item[len(item)-1]) && !interruptsParagraph(l) && !isListItem(l):
+			item = append(item, l)
+			end = i + 1
+			continue
+		}
+		break
+	}
+	// lines from end on are blank
+	return item[:len(item)-(i-end)], i
+}
+
+func isTableStart(lines []string, i int) bool {
+	return i+1 < len(lines) && strings.Contains(lines[i], "|") &&
+		tableDelimRe.MatchString(lines[i+1]) &&
+		len(splitRow(lines[i])) == len(splitRow(lines[i+1]))
+}
+
+func table(b *strings.Builder, lines []string, i int) int {
+	head := splitRow(lines[i])
+	align := make([]string, len(head))
+	for k, c := range splitRow(lines[i+1]) {
+		left, right := strings.HasPrefix(c, ":"), strings.HasSuffix(c, ":")
+		switch {
+		case left && right:
+			align[k] = "center"
+		case right:
+			align[k] = "right"
+		case left:
+			align[k] = "left"
+		}
+	}
+	b.WriteString("<table>\n<thead>\n")
+	tableRow(b, "th", head, align)
+	b.WriteString("</thead>\n")
+	i += 2
+	start, filled := i, 0
+	for ; i < len(lines) && !isBlank(lines[i]) && !interruptsParagraph(lines[i]); i++ {
+		cells := splitRow(lines[i])
+		if n := len(align) - len(cells); n > 0 {
+			if filled += n; filled > maxFilledCells {
+				break
+			}
+		}
+		if i == start {
+			b.WriteString("<tbody>\n")
+		}
+		tableRow(b, "td", cells, align)
+	}
+	if i > start {
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return i
+}
+
+// tableRow writes as many cells as there are columns, whatever the row
+// has.
+func tableRow(b *strings.Builder, tag string, cells []string, align []string) {
+	b.WriteString("<tr>\n")
+	for k, a := range align {
+		b.WriteString("<" + tag)
+		if a != "" {
+			b.WriteString(` align="` + a + `"`)
+		}
+		b.WriteString(">")
+		if k < len(cells) {
+			b.WriteString(renderInline(cells[k]))
+		}
+		b.WriteString("</" + tag + ">\n")
+	}
+	b.WriteString("</tr>\n")
+}
+
+// splitRow splits a table row on the pipes not escaped with a backslash,
+// the escaping backslashes are dropped.
+func splitRow(l string) []string {
+	l = strings.TrimSpace(l)
+	l = strings.TrimPrefix(l, "|")
+	if strings.HasSuffix(l, "|") && !strings.HasSuffix(l, `\|`) {
+		l = l[:len(l)-1]
+	}
+	cells := []string{}
+	cell := strings.Builder{}
+	for i := 0; i < len(l); i++ {
+		switch {
+		case l[i] == '\\' && i+1 < len(l) && l[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case l[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(l[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func isBlank(l string) bool {
+	return strings.TrimSpace(l) == ""
+}
+
+func indent(l string) int {
+	n := 0
+	for n < len(l) && l[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+func stripIndent(l string, n int) string {
+	if i := indent(l); i < n {
+		n = i
+	}
+	return l[n:]
+}
+
+// expandTabs turns the tabs of the indent into spaces with tab stops of 4.
+func expandTabs(l string) string {
+	if !strings.Contains(l, "\t") {
+		return l
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(l); i++ {
+		switch l[i] {
+		case '\t':
+			b.WriteString(strings.Repeat(" ", 4-b.Len()%4))
+		case ' ':
+			b.WriteByte(' ')
+		default:
+			b.WriteString(l[i:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,541 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	autolinkRe = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^<>\x00-\x20]*)>`)
+	emailRe    = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	entityRe   = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	tagRe      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// node is a piece of the inline output. Delimiter runs keep their
+// characters until emphasis is resolved, the tags they turn into go
+// around what is left of them.
+type node struct {
+	html string
+	alt  string // plain text of an image
+
+	ch        byte // '*', '_' or '~' of a delimiter run
+	n         int  // characters of the run left
+	orig      int
+	active    bool
+	canOpen   bool
+	canClose  bool
+	closeTags string
+	openTags  string
+}
+
+type bracket struct {
+	node   int
+	image  bool
+	active bool
+}
+
+type inlineParser struct {
+	src      string
+	pos      int
+	buf      []byte // text not in nodes yet
+	nodes    []*node
+	brackets []bracket
+}
+
+func renderInline(src string) string {
+	p := &inlineParser{src: src}
+	p.parse()
+	p.processEmphasis(0)
+	b := strings.Builder{}
+	for _, n := range p.nodes {
+		b.WriteString(n.closeTags)
+		if n.ch != 0 {
+			b.WriteString(strings.Repeat(string(n.ch), n.n))
+		} else {
+			b.WriteString(n.html)
+		}
+		b.WriteString(n.openTags)
+	}
+	return b.String()
+}
+
+func (p *inlineParser) flush() {
+	if len(p.buf) != 0 {
+		p.nodes = append(p.nodes, &node{html: string(p.buf)})
+		p.buf = p.buf[:0]
+	}
+}
+
+func (p *inlineParser) add(n *node) {
+	p.flush()
+	p.nodes = append(p.nodes, n)
+}
+
+func (p *inlineParser) parse() {
+	s := p.src
+	for p.pos < len(s) {
+		c := s[p.pos]
+		switch {
+		case c == '\\':
+			p.backslash()
+		case c == '`':
+			p.codeSpan()
+		case c == '*' || c == '_' || c == '~':
+			p.delimiterRun()
+		case c == '[':
+			p.add(&node{html: "["})
+			p.brackets = append(p.brackets, bracket{node: len(p.nodes) - 1, active: true})
+			p.pos++
+		case c == '!' && strings.HasPrefix(s[p.pos:], "!["):
+			p.add(&node{html: "!["})
+			p.brackets = append(p.brackets, bracket{node: len(p.nodes) - 1, image: true, active: true})
+			p.pos += 2
+		case c == ']':
+			p.closeBracket()
+		case c == '<':
+			p.autolink()
+		case c == '&':
+			p.entity()
+		case c == '\n':
+			p.lineBreak()
+		case (c == 'h' || c == 'w') && p.bareLink():
+		default:
+			p.buf = append(p.buf, escape(s[p.pos:p.pos+1])...)
+			p.pos++
+		}
+	}
+	p.flush()
+}
+
+func (p *inlineParser) backslash() {
+	s := p.src
+	switch {
+	case p.pos+1 < len(s) && s[p.pos+1] == '\n':
+		p.trimSpaces()
+		p.buf = append(p.buf, "<br />\n"...)
+	case p.pos+1 < len(s) && isASCIIPunct(s[p.pos+1]):
+		p.buf = append(p.buf, escape(s[p.pos+1:p.pos+2])...)
+	default:
+		p.buf = append(p.buf, '\\')
+		p.pos++
+		return
+	}
+	p.pos += 2
+}
+
+func (p *inlineParser) codeSpan() {
+	s := p.src
+	n := runLength(s, p.pos)
+	for i := p.pos + n; i < len(s); {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			break
+		}
+		j += i
+		if m := runLength(s, j); m != n {
+			i = j + m
+			continue
+		}
+		code := strings.Replace(s[p.pos+n:j], "\n", " ", -1)
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		p.buf = append(p.buf, "<code>"+escape(code)+"</code>"...)
+		p.pos = j + n
+		return
+	}
+	// no closing run, the backticks are text
+	p.buf = append(p.buf, s[p.pos:p.pos+n]...)
+	p.pos += n
+}
+
+func (p *inlineParser) delimiterRun() {
+	s := p.src
+	c := s[p.pos]
+	n := runLength(s, p.pos)
+	if c == '~' && n > 2 {
+		p.buf = append(p.buf, s[p.pos:p.pos+n]...)
+		p.pos += n
+		return
+	}
+	before, after := ' ', ' '
+	if p.pos > 0 {
+		before, _ = utf8.DecodeLastRuneInString(s[:p.pos])
+	}
+	if p.pos+n < len(s) {
+		after, _ = utf8.DecodeRuneInString(s[p.pos+n:])
+	}
+	left := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	right := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+	d := &node{ch: c, n: n, orig: n, active: true, canOpen: left, canClose: right}
+	if c == '_' {
+		// no emphasis inside words
+		d.canOpen = left && (!right || isPunct(before))
+		d.canClose = right && (!left || isPunct(after))
+	}
+	p.add(d)
+	p.pos += n
+}
+
+// processEmphasis matches the delimiter runs from nodes[from] on, the
+// way CommonMark does, and leaves them inactive.
+func (p *inlineParser) processEmphasis(from int) {
+	// the delimiter stack, a list linked through prev and next so that
+	// runs no longer in play are skipped
+	ds := []*node{}
+	for _, n := range p.nodes[from:] {
+		if n.active {
+			ds = append(ds, n)
+		}
+	}
+	prev, next := make([]int, len(ds)), make([]int, len(ds))
+	for i := range ds {
+		prev[i], next[i] = i-1, i+1
+	}
+	remove := func(i int) {
+		if prev[i] >= 0 {
+			next[prev[i]] = next[i]
+		}
+		if next[i] < len(ds) {
+			prev[next[i]] = prev[i]
+		}
+	}
+
+	// openersBottom of CommonMark: openers at or below the index have
+	// been tried for closers of the kind
+	type kind struct {
+		ch      byte
+		canOpen bool
+		mod     int
+	}
+	bottom := map[kind]int{}
+	for c := 0; c < len(ds); c = next[c] {
+		closer := ds[c]
+		if !closer.canClose {
+			continue
+		}
+		for closer.n > 0 {
+			k := kind{closer.ch, closer.canOpen, closer.orig % 3}
+			lo, ok := bottom[k]
+			if !ok {
+				lo = -1
+			}
+			o := prev[c]
+			for ; o > lo; o = prev[o] {
+				op := ds[o]
+				if op.ch != closer.ch || !op.canOpen {
+					continue
+				}
+				if closer.ch == '~' {
+					if op.orig == closer.orig {
+						break
+					}
+					continue
+				}
+				// the rule of 3
+				if (op.canClose || closer.canOpen) && (op.orig+closer.orig)%3 == 0 &&
+					!(op.orig%3 == 0 && closer.orig%3 == 0) {
+					continue
+				}
+				break
+			}
+			if o <= lo {
+				bottom[k] = prev[c]
+				break
+			}
+
+			op := ds[o]
+			n, tag := 1, "em"
+			switch {
+			case closer.ch == '~':
+				n, tag = op.n, "del"
+			case op.n >= 2 && closer.n >= 2:
+				n, tag = 2, "strong"
+			}
+			op.n -= n
+			closer.n -= n
+			op.openTags = "<" + tag + ">" + op.openTags
+			closer.closeTags += "</" + tag + ">"
+			// the runs in between stay text
+			next[o], prev[c] = c, o
+			if op.n == 0 {
+				remove(o)
+			}
+		}
+		if closer.n == 0 {
+			remove(c)
+		}
+	}
+	for _, n := range ds {
+		n.active = false
+	}
+}
+
+func (p *inlineParser) closeBracket() {
+	if len(p.brackets) == 0 {
+		p.buf = append(p.buf, ']')
+		p.pos++
+		return
+	}
+	br := p.brackets[len(p.brackets)-1]
+	p.brackets = p.brackets[:len(p.brackets)-1]
+	dest, title, end, ok := parseInlineLink(p.src, p.pos+1)
+	if !br.active || !ok {
+		p.buf = append(p.buf, ']')
+		p.pos++
+		return
+	}
+	p.pos = end
+	p.flush()
+	p.processEmphasis(br.node + 1)
+
+	opener := p.nodes[br.node]
+	u, safe := safeURL(dest, br.image)
+	if br.image {
+		// the alt text is the plain text of the label
+		b := strings.Builder{}
+		for _, n := range p.nodes[br.node+1:] {
+			switch {
+			case n.ch != 0:
+				b.WriteString(strings.Repeat(string(n.ch), n.n))
+			case n.alt != "":
+				b.WriteString(n.alt)
+			default:
+				b.WriteString(tagRe.ReplaceAllString(n.html, ""))
+			}
+		}
+		alt := b.String()
+		p.nodes = p.nodes[:br.node+1]
+		opener.html, opener.alt = alt, alt
+		if safe {
+			opener.html = `<img src="` + escape(u) + `" alt="` + alt + `"`
+			if title != "" {
+				opener.html += ` title="` + escape(title) + `"`
+			}
+			opener.html += " />"
+		}
+		return
+	}
+
+	opener.html = ""
+	if safe {
+		opener.html = `<a href="` + escape(u) + `"`
+		if title != "" {
+			opener.html += ` title="` + escape(title) + `"`
+		}
+		opener.html += ` rel="nofollow">`
+		p.add(&node{html: "</a>"})
+	}
+	// no links in links
+	for k := range p.brackets {
+		if !p.brackets[k].image {
+			p.brackets[k].active = false
+		}
+	}
+}
+
+// parseInlineLink parses the (destination "title") after the label of a
+// link starting at s[i], end is where the link ends.
+func parseInlineLink(s string, i int) (dest, title string, end int, ok bool) {
+	if i >= len(s) || s[i] != '(' {
+		return
+	}
+	i = skipSpace(s, i+1)
+	if i < len(s) && s[i] == '<' {
+		j := i + 1
+		for j < len(s) && s[j] != '>' && s[j] != '<' && s[j] != '\n' {
+			if s[j] == '\\' && j+1 < len(s) {
+				j++
+			}
+			j++
+		}
+		if j >= len(s) || s[j] != '>' {
+			return
+		}
+		dest, i = s[i+1:j], j+1
+	} else {
+		j, depth := i, 0
+	loop:
+		for j < len(s) {
+			switch c := s[j]; {
+			case c == '\\' && j+1 < len(s) && isASCIIPunct(s[j+1]):
+				j++
+			case c == '(':
+				// cmark's limit, it keeps the scans short
+				if depth++; depth > 32 {
+					return
+				}
+			case c == ')' && depth == 0:
+				break loop
+			case c == ')':
+				depth--
+			case c <= ' ':
+				break loop
+			}
+			j++
+		}
+		dest, i = s[i:j], j
+	}
+
+	j := skipSpace(s, i)
+	// the title has to be apart from the destination
+	if j > i && j < len(s) && (s[j] == '"' || s[j] == '\'' || s[j] == '(') {
+		closing := s[j]
+		if closing == '(' {
+			closing = ')'
+		}
+		k := j + 1
+		for k < len(s) && s[k] != closing && !(closing == ')' && s[k] == '(') {
+			if s[k] == '\\' && k+1 < len(s) {
+				k++
+			}
+			k++
+		}
+		if k >= len(s) || s[k] != closing {
+			return
+		}
+		title, j = s[j+1:k], skipSpace(s, k+1)
+	}
+	if j >= len(s) || s[j] != ')' {
+		return
+	}
+	return unescapeText(dest), unescapeText(title), j + 1, true
+}
+
+func (p *inlineParser) autolink() {
+	s := p.src[p.pos:]
+	if m := autolinkRe.FindStringSubmatch(s); m != nil {
+		if u, ok := safeURL(m[1], false); ok {
+			p.buf = append(p.buf, `<a href="`+escape(u)+`" rel="nofollow">`+escape(m[1])+"</a>"...)
+		} else {
+			p.buf = append(p.buf, escape(m[0])...)
+		}
+		p.pos += len(m[0])
+		return
+	}
+	if m := emailRe.FindStringSubmatch(s); m != nil {
+		p.buf = append(p.buf, `<a href="mailto:`+escape(m[1])+`">`+escape(m[1])+"</a>"...)
+		p.pos += len(m[0])
+		return
+	}
+	// no raw HTML
+	p.buf = append(p.buf, "&lt;"...)
+	p.pos++
+}
+
+// bareLink links a URL starting with http://, https:// or www. at the
+// start of a word, like GitHub does. Links inside links are text.
+func (p *inlineParser) bareLink() bool {
+	s := p.src[p.pos:]
+	if len(p.brackets) != 0 || (p.pos > 0 && !strings.ContainsRune(" \t\n(*_~", rune(p.src[p.pos-1]))) {
+		return false
+	}
+	scheme := ""
+	switch {
+	case strings.HasPrefix(s, "http://"), strings.HasPrefix(s, "https://"):
+	case strings.HasPrefix(s, "www."):
+		scheme = "http://"
+	default:
+		return false
+	}
+	n := strings.IndexAny(s, " \t\n<")
+	if n < 0 {
+		n = len(s)
+	}
+	text := strings.TrimRight(s[:n], "?!.,:*_~'\"")
+	// a closing parenthesis is part of the link only if balanced in it
+	for strings.HasSuffix(text, ")") && strings.Count(text, ")") > strings.Count(text, "(") {
+		text = strings.TrimRight(text[:len(text)-1], "?!.,:*_~'\"")
+	}
+	prefix := len("www.")
+	if scheme == "" {
+		prefix = strings.Index(s, "//") + len("//")
+	}
+	if len(text) <= prefix {
+		return false
+	}
+	u := scheme + html.UnescapeString(text)
+	p.buf = append(p.buf, `<a href="`+escape(u)+`" rel="nofollow">`+escape(text)+"</a>"...)
+	p.pos += len(text)
+	return true
+}
+
+func (p *inlineParser) entity() {
+	if m := entityRe.FindString(p.src[p.pos:]); m != "" {
+		p.buf = append(p.buf, escape(html.UnescapeString(m))...)
+		p.pos += len(m)
+		return
+	}
+	p.buf = append(p.buf, "&amp;"...)
+	p.pos++
+}
+
+// lineBreak is hard after two spaces, soft otherwise.
+func (p *inlineParser) lineBreak() {
+	if p.trimSpaces() >= 2 {
+		p.buf = append(p.buf, "<br />\n"...)
+	} else {
+		p.buf = append(p.buf, '\n')
+	}
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// trimSpaces drops the spaces at the end of the pending text.
+func (p *inlineParser) trimSpaces() int {
+	n := 0
+	for len(p.buf) != 0 && p.buf[len(p.buf)-1] == ' ' {
+		p.buf = p.buf[:len(p.buf)-1]
+		n++
+	}
+	return n
+}
+
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isPunct(r rune) bool {
+	return r < utf8.RuneSelf && isASCIIPunct(byte(r)) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// unescapeText resolves backslash escapes and entities.
+func unescapeText(s string) string {
+	if !strings.ContainsAny(s, `\&`) {
+		return s
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return html.UnescapeString(b.String())
+}
+
+// escape makes text safe for both element content and quoted attributes.
+func escape(s string) string {
+	return html.EscapeString(s)
+}
@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Every input here once got, or could get, markup of its own into the
+// output. Whatever they turn into, checkSafe has to accept it.
+var xssInputs = []string{
+	// entity-encoded schemes
+	"[x](&#106;avascript:alert(1))",
+	"[x](&#x6A;avascript&colon;alert(1))",
+	"[x](javascript&#58;alert(1))",
+	"[x](&#x20;javascript:alert(1))",
+	"![x](&#106;avascript:alert(1))",
+	"[x](JaVaScRiPt:alert(1))",
+	"[x](java\tscript:alert(1))",
+	"[x](<java script:alert(1)>)",
+	"[x](vbscript:msgbox(1))",
+
+	// data URLs
+	"[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+	"![x](data:image/svg+xml,%3Csvg%20onload%3Dalert(1)%3E)",
+	"![x](data:image/svg+xml,<svg onload=alert(1)>)",
+	"[x](&#100;ata:text/html,<script>alert(1)</script>)",
+	"<data:text/html,<script>alert(1)</script>>",
+
+	// raw HTML
+	"<script>alert(1)</script>",
+	"<img src=x onerror=alert(1)>",
+	"<a href=\"javascript:alert(1)\">x</a>",
+	"<div\nonmouseover=\"alert(1)\">x</div>",
+	"<!-- --><script>alert(1)</script>",
+	"<iframe srcdoc=\"&lt;script&gt;alert(1)&lt;/script&gt;\">",
+	"`<script>`</script>",
+	"    <script>alert(1)</script>",
+	"> <script>alert(1)</script>",
+	"- <script>alert(1)</script>",
+	"# <script>alert(1)</script>",
+
+	// breaking out of attributes through titles
+	`[x](http://a.b "a\" onmouseover=\"alert(1)")`,
+	`[x](http://a.b 'a" onmouseover="alert(1)')`,
+	`[x](http://a.b (a" onmouseover="alert(1)))`,
+	`![x" onerror="alert(1)](http://a.b/i.png "t\" onload=\"alert(1)")`,
+	`[x](http://a.b "&quot; onmouseover=&quot;alert(1)")`,
+	"[x](http://a.b/\" onmouseover=\"alert(1))",
+
+	// and through autolinks and bare links
+	"<javascript:alert(1)>",
+	`<http://a.b/"onmouseover="alert(1)>`,
+	"<http://a.b/'onmouseover='alert(1)>",
+	`http://a.b/"onmouseover="alert(1)`,
+	"www.a.b/\"><script>alert(1)</script>",
+	`<a@b.c"onmouseover="alert(1)>`,
+	`a"onmouseover="alert(1)@b.c`,
+
+	// table cells
+	"| a | b |\n|---|---|\n| <script>alert(1)</script> | [x](javascript:alert(1)) |",
+	"| a |\n|---|\n| \" onclick=\"alert(1) |",
+	"| <b>a</b> |\n|:-:|\n| ![x](data:image/png;base64,AAAA) |",
+	"| a \\| <script> |\n|---|\n| `|` <img src=x onerror=alert(1)> |",
+
+	// code fence info strings end up in class
+	"```\"><script>alert(1)</script>\nx\n```",
+	"```js\" onmouseover=\"alert(1)\nx\n```",
+}
+
+var (
+	outputTagRe  = regexp.MustCompile(`^<(/?)([a-z][a-z0-9]*)((?:\s+[a-z]+="[^"<>]*")*)\s*/?>`)
+	outputAttrRe = regexp.MustCompile(`\s+([a-z]+)="([^"<>]*)"`)
+
+	allowedTags = map[string]bool{
+		"a": true, "blockquote": true, "br": true, "code": true, "del": true, "em": true,
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+		"img": true, "li": true, "ol": true, "p": true, "pre": true, "strong": true,
+		"table": true, "tbody": true, "td": true, "th": true, "thead": true, "tr": true, "ul": true,
+	}
+	allowedAttrs = map[string]bool{
+		"align": true, "alt": true, "class": true, "href": true, "rel": true,
+		"src": true, "start": true, "title": true,
+	}
+)
+
+// checkSafe fails unless every "<" of out starts a tag of the renderer
+// with its own attributes only and URLs of the allowed schemes.
+func checkSafe(t *testing.T, in, out string) {
+	t.Helper()
+	for i := strings.IndexByte(out, '<'); i >= 0; i = strings.IndexByte(out, '<') {
+		out = out[i:]
+		m := outputTagRe.FindStringSubmatch(out)
+		if m == nil {
+			t.Errorf("%q: unexpected markup in %q", in, out)
+			return
+		}
+		out = out[len(m[0]):]
+		if !allowedTags[m[2]] {
+			t.Errorf("%q: got tag <%s>", in, m[2])
+		}
+		for _, a := range outputAttrRe.FindAllStringSubmatch(m[3], -1) {
+			name, value := a[1], html.UnescapeString(a[2])
+			switch {
+			case !allowedAttrs[name]:
+				t.Errorf("%q: got attribute %s=%q", in, name, value)
+			case name == "href" || name == "src":
+				if _, ok := safeURL(value, name == "src"); !ok {
+					t.Errorf("%q: got URL %q", in, value)
+				}
+			case name == "class" && !strings.HasPrefix(value, "language-"):
+				t.Errorf("%q: got class %q", in, value)
+			}
+		}
+	}
+}
+
+func TestRenderIsSafe(t *testing.T) {
+	for _, in := range xssInputs {
+		checkSafe(t, in, Render(in))
+	}
+}
+
+func TestRenderKeepsUnsafeInputAsText(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"[x](&#106;avascript:alert(1))", "<p>x</p>\n"},
+		{"[x](data:text/html,x)", "<p>x</p>\n"},
+		{"![x](data:image/png;base64,AAAA)", "<p>x</p>\n"},
+		{"<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+		{
+			`[x](http://a.b "a\" onmouseover=\"alert(1)")`,
+			`<p><a href="http://a.b" title="a&#34; onmouseover=&#34;alert(1)" rel="nofollow">x</a></p>` + "\n",
+		},
+		{
+			`<http://a.b/"onmouseover="alert(1)>`,
+			`<p><a href="http://a.b/%22onmouseover=%22alert(1)" rel="nofollow">http://a.b/&#34;onmouseover=&#34;alert(1)</a></p>` + "\n",
+		},
+	} {
+		if got := Render(tt.in); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
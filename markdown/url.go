@@ -0,0 +1,51 @@
+package markdown
+
+import (
+	"strings"
+)
+
+// safeURL checks the scheme of a link or image URL and returns it
+// percent-encoded. Links may be http, https, mailto or relative, images
+// may not be mailto.
+func safeURL(u string, image bool) (string, bool) {
+	// browsers skip whitespace and control characters in the scheme
+	s := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	// the scheme ends with the first colon unless a path, query or
+	// fragment starts before it
+	if i := strings.IndexAny(s, ":/?#"); i >= 0 && s[i] == ':' {
+		switch strings.ToLower(s[:i]) {
+		case "http", "https":
+		case "mailto":
+			if image {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	return encodeURL(u), true
+}
+
+const hexDigits = "0123456789ABCDEF"
+
+// encodeURL percent-encodes what may not appear in a URL as is, escapes
+// already there are kept.
+func encodeURL(u string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(u); i++ {
+		c := u[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"<>\^`+"`"+`{|}`, c) >= 0 {
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
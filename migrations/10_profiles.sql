@@ -0,0 +1,118 @@
+-- +migrate Up
+ALTER TABLE forum_user ADD COLUMN IF NOT EXISTS signature text DEFAULT '' NOT NULL;
+ALTER TABLE forum_user ADD COLUMN IF NOT EXISTS avatar text REFERENCES blob;
+ALTER TABLE forum_user ADD COLUMN IF NOT EXISTS joined timestamptz DEFAULT now() NOT NULL;
+ALTER TABLE forum_user ADD COLUMN IF NOT EXISTS last_seen timestamptz;
+
+-- users of an existing forum joined no later than they first wrote
+UPDATE forum_user u SET joined = LEAST(joined,
+    (SELECT MIN(thread_created) FROM thread WHERE thread_author = u.nickname),
+    (SELECT MIN(post_created) FROM post WHERE post_author = u.nickname));
+UPDATE forum_user u SET last_seen = GREATEST(
+    (SELECT MAX(thread_created) FROM thread WHERE thread_author = u.nickname),
+    (SELECT MAX(post_created) FROM post WHERE post_author = u.nickname));
+
+-- counters of the user profile, rows appear with the first write
+CREATE TABLE IF NOT EXISTS user_stats (
+    nickname citext PRIMARY KEY REFERENCES forum_user ON DELETE CASCADE,
+    threads integer DEFAULT 0 NOT NULL,
+    posts integer DEFAULT 0 NOT NULL,
+    votes integer DEFAULT 0 NOT NULL -- for the threads of the user
+);
+
+INSERT INTO user_stats (nickname, threads, posts, votes)
+SELECT u.nickname,
+    (SELECT COUNT(*) FROM thread WHERE thread_author = u.nickname),
+    (SELECT COUNT(*) FROM post WHERE post_author = u.nickname),
+    COALESCE((SELECT SUM(votes) FROM thread WHERE thread_author = u.nickname), 0)
+FROM forum_user u
+ON CONFLICT (nickname) DO NOTHING;
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION user_seen(who citext) RETURNS void AS $user_seen$
+    BEGIN
+        -- bounded, so that a burst of writes doesn't rewrite the row every time
+        UPDATE forum_user SET last_seen = now()
+        WHERE nickname = who AND (last_seen IS NULL OR last_seen < now() - interval '1 minute');
+    END;
+$user_seen$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION count_user_thread() RETURNS TRIGGER AS $count_user_thread$
+    BEGIN
+        INSERT INTO user_stats (nickname, threads) VALUES (NEW.thread_author, 1)
+        ON CONFLICT (nickname) DO UPDATE SET threads = user_stats.threads + 1;
+        PERFORM user_seen(NEW.thread_author);
+        RETURN NEW;
+    END;
+$count_user_thread$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER count_user_thread AFTER INSERT ON thread
+FOR EACH ROW EXECUTE PROCEDURE count_user_thread();
+
+-- posts come in batches, mostly of a single author
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION count_user_posts() RETURNS TRIGGER AS $count_user_posts$
+    DECLARE
+        r record;
+    BEGIN
+        FOR r IN SELECT post_author, COUNT(*) AS n FROM new_posts GROUP BY post_author ORDER BY post_author LOOP
+            INSERT INTO user_stats (nickname, posts) VALUES (r.post_author, r.n)
+            ON CONFLICT (nickname) DO UPDATE SET posts = user_stats.posts + r.n;
+            PERFORM user_seen(r.post_author);
+        END LOOP;
+        RETURN NULL;
+    END;
+$count_user_posts$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER count_user_posts AFTER INSERT ON post
+REFERENCING NEW TABLE AS new_posts
+FOR EACH STATEMENT EXECUTE PROCEDURE count_user_posts();
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION count_user_votes() RETURNS TRIGGER AS $count_user_votes$
+    BEGIN
+        IF NEW.votes <> OLD.votes THEN
+            INSERT INTO user_stats (nickname, votes) VALUES (NEW.thread_author, NEW.votes - OLD.votes)
+            ON CONFLICT (nickname) DO UPDATE SET votes = user_stats.votes + NEW.votes - OLD.votes;
+        END IF;
+        RETURN NEW;
+    END;
+$count_user_votes$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER count_user_votes AFTER UPDATE OF votes ON thread
+FOR EACH ROW EXECUTE PROCEDURE count_user_votes();
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION voter_seen() RETURNS TRIGGER AS $voter_seen$
+    BEGIN
+        PERFORM user_seen(NEW.nickname);
+        RETURN NEW;
+    END;
+$voter_seen$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER voter_seen AFTER INSERT OR UPDATE ON vote
+FOR EACH ROW EXECUTE PROCEDURE voter_seen();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS voter_seen ON vote;
+DROP FUNCTION IF EXISTS voter_seen();
+DROP TRIGGER IF EXISTS count_user_votes ON thread;
+DROP FUNCTION IF EXISTS count_user_votes();
+DROP TRIGGER IF EXISTS count_user_posts ON post;
+DROP FUNCTION IF EXISTS count_user_posts();
+DROP TRIGGER IF EXISTS count_user_thread ON thread;
+DROP FUNCTION IF EXISTS count_user_thread();
+DROP FUNCTION IF EXISTS user_seen(citext);
+
+DROP TABLE IF EXISTS user_stats;
+
+ALTER TABLE forum_user DROP COLUMN IF EXISTS last_seen;
+ALTER TABLE forum_user DROP COLUMN IF EXISTS joined;
+ALTER TABLE forum_user DROP COLUMN IF EXISTS avatar;
+ALTER TABLE forum_user DROP COLUMN IF EXISTS signature;
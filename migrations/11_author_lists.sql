@@ -0,0 +1,12 @@
+-- +migrate Up
+-- lists of a user are ordered by creation, the id breaks ties
+CREATE INDEX IF NOT EXISTS idx_thread__thread_author_created ON thread (thread_author, thread_created, thread_id);
+CREATE INDEX IF NOT EXISTS idx_post__post_author_created ON post (post_author, post_created, post_id);
+DROP INDEX IF EXISTS idx_thread__thread_author;
+DROP INDEX IF EXISTS idx_post__post_author;
+
+-- +migrate Down
+CREATE INDEX IF NOT EXISTS idx_post__post_author ON post (post_author);
+CREATE INDEX IF NOT EXISTS idx_thread__thread_author ON thread (thread_author);
+DROP INDEX IF EXISTS idx_post__post_author_created;
+DROP INDEX IF EXISTS idx_thread__thread_author_created;
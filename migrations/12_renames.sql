@@ -0,0 +1,28 @@
+-- +migrate Up
+-- renames in progress: the new user is created with a placeholder e-mail,
+-- rows of the old one are moved to it in batches, and at the end the old
+-- user is deleted and its e-mail taken over
+CREATE TABLE IF NOT EXISTS nickname_rename (
+    old_nickname citext PRIMARY KEY REFERENCES forum_user ON DELETE CASCADE,
+    nickname citext UNIQUE NOT NULL REFERENCES forum_user ON DELETE CASCADE,
+    started timestamptz DEFAULT now() NOT NULL
+);
+
+-- old nicknames of renamed users, until someone takes them
+CREATE TABLE IF NOT EXISTS nickname_redirect (
+    old_nickname citext PRIMARY KEY,
+    nickname citext NOT NULL REFERENCES forum_user ON DELETE CASCADE,
+    renamed timestamptz DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_nickname_redirect__nickname ON nickname_redirect (nickname);
+
+-- the batches look rows up by nickname
+CREATE INDEX IF NOT EXISTS idx_users_in_forum__forum_user ON users_in_forum (forum_user);
+CREATE INDEX IF NOT EXISTS idx_notification_actor ON notification (actor);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_notification_actor;
+DROP INDEX IF EXISTS idx_users_in_forum__forum_user;
+DROP TABLE IF EXISTS nickname_redirect;
+DROP TABLE IF EXISTS nickname_rename;
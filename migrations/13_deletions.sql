@@ -0,0 +1,15 @@
+-- +migrate Up
+-- threads, posts and forums of deleted users are kept under this user,
+-- nobody can sign up or write as it
+INSERT INTO forum_user (nickname, fullname, email, about)
+VALUES ('[deleted]', 'Deleted user', 'deleted@forum.invalid', '')
+ON CONFLICT DO NOTHING;
+
+-- deletions in progress, like renames they move rows in batches
+CREATE TABLE IF NOT EXISTS user_deletion (
+    nickname citext PRIMARY KEY REFERENCES forum_user ON DELETE CASCADE,
+    started timestamptz DEFAULT now() NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_deletion;
@@ -0,0 +1,27 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS category (
+    category_slug citext PRIMARY KEY,
+    category_title varchar(128) NOT NULL,
+    position int DEFAULT 0 NOT NULL
+);
+
+-- a top-level forum may be in a category, a sub-forum is in the category
+-- of its top-level forum; siblings are ordered by position, then by slug
+ALTER TABLE forum
+    ADD COLUMN IF NOT EXISTS forum_parent citext CONSTRAINT forum_parent_fkey REFERENCES forum,
+    ADD COLUMN IF NOT EXISTS category citext CONSTRAINT forum_category_fkey REFERENCES category,
+    ADD COLUMN IF NOT EXISTS position int DEFAULT 0 NOT NULL,
+    ADD CONSTRAINT forum_parent_or_category CHECK (forum_parent IS NULL OR category IS NULL);
+
+CREATE INDEX IF NOT EXISTS idx_forum__parent ON forum (forum_parent, position, forum_slug);
+CREATE INDEX IF NOT EXISTS idx_forum__category ON forum (category, position, forum_slug);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_forum__category;
+DROP INDEX IF EXISTS idx_forum__parent;
+ALTER TABLE forum
+    DROP CONSTRAINT IF EXISTS forum_parent_or_category,
+    DROP COLUMN IF EXISTS position,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS forum_parent;
+DROP TABLE IF EXISTS category;
@@ -0,0 +1,43 @@
+-- +migrate Up
+-- tags of a thread, lower case and without repeats
+ALTER TABLE thread ADD COLUMN IF NOT EXISTS tags text[] DEFAULT '{}' NOT NULL;
+
+-- a row per tag of a thread, kept by the triggers below: the forum list of
+-- a tag is read in the order of the index, and so is the tag cloud
+CREATE TABLE IF NOT EXISTS thread_tag (
+    thread_id integer REFERENCES thread ON DELETE CASCADE NOT NULL,
+    forum citext NOT NULL,
+    tag text NOT NULL,
+    thread_created timestamptz,
+    PRIMARY KEY (thread_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_tag__forum_tag_created ON thread_tag (forum, tag, thread_created, thread_id);
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION sync_thread_tags() RETURNS TRIGGER AS $sync_thread_tags$
+    BEGIN
+        IF (TG_OP = 'UPDATE') THEN
+            DELETE FROM thread_tag WHERE thread_id = NEW.thread_id AND tag <> ALL(NEW.tags);
+        END IF;
+        INSERT INTO thread_tag (thread_id, forum, tag, thread_created)
+        SELECT NEW.thread_id, NEW.forum, t, NEW.thread_created FROM unnest(NEW.tags) t
+        ON CONFLICT DO NOTHING;
+        RETURN NULL;
+    END;
+$sync_thread_tags$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- most threads have no tags, inserting them stays as cheap as it was
+CREATE TRIGGER sync_thread_tags_insert AFTER INSERT ON thread
+FOR EACH ROW WHEN (cardinality(NEW.tags) > 0) EXECUTE PROCEDURE sync_thread_tags();
+
+CREATE TRIGGER sync_thread_tags_update AFTER UPDATE OF tags ON thread
+FOR EACH ROW WHEN (OLD.tags IS DISTINCT FROM NEW.tags) EXECUTE PROCEDURE sync_thread_tags();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS sync_thread_tags_update ON thread;
+DROP TRIGGER IF EXISTS sync_thread_tags_insert ON thread;
+DROP FUNCTION IF EXISTS sync_thread_tags();
+DROP TABLE IF EXISTS thread_tag;
+ALTER TABLE thread DROP COLUMN IF EXISTS tags;
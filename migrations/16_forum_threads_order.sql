@@ -0,0 +1,8 @@
+-- +migrate Up
+-- threads of a forum are ordered by creation, the id breaks ties
+CREATE INDEX IF NOT EXISTS idx_thread__forum_created_id ON thread (forum, thread_created, thread_id);
+DROP INDEX IF EXISTS idx_thread__forum_thread_created;
+
+-- +migrate Down
+CREATE INDEX IF NOT EXISTS idx_thread__forum_thread_created ON thread (forum, thread_created);
+DROP INDEX IF EXISTS idx_thread__forum_created_id;
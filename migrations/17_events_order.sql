@@ -0,0 +1,22 @@
+-- +migrate Up
+-- Writers no longer serialize on an advisory lock to order the feed.
+-- Events are inserted without seq, readers number the committed ones in
+-- insertion order. seq only grows, so a reader never sees a gap filled
+-- later, and changes of a record are numbered in the order of the row
+-- locks their transactions took.
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_pkey;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS id bigserial PRIMARY KEY;
+ALTER TABLE events ALTER COLUMN seq DROP DEFAULT;
+ALTER TABLE events ALTER COLUMN seq DROP NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_events_seq ON events (seq);
+CREATE INDEX IF NOT EXISTS idx_events_pending ON events (id) WHERE seq IS NULL;
+
+-- +migrate Down
+DELETE FROM events WHERE seq IS NULL;
+DROP INDEX IF EXISTS idx_events_pending;
+DROP INDEX IF EXISTS idx_events_seq;
+ALTER TABLE events DROP COLUMN IF EXISTS id;
+ALTER TABLE events ALTER COLUMN seq SET NOT NULL;
+ALTER TABLE events ALTER COLUMN seq SET DEFAULT nextval('events_seq_seq');
+ALTER TABLE events ADD PRIMARY KEY (seq);
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- the feed pages through threads of watched forums and posts of watched
+-- threads by creation, the id breaks ties
+CREATE INDEX IF NOT EXISTS idx_post__thread_feed ON post (thread, COALESCE(post_created, 'epoch'), post_id);
+CREATE INDEX IF NOT EXISTS idx_thread__forum_feed ON thread (forum, COALESCE(thread_created, 'epoch'), thread_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_thread__forum_feed;
+DROP INDEX IF EXISTS idx_post__thread_feed;
@@ -0,0 +1,20 @@
+-- +migrate Up
+
+-- databases created by the first version of 1_initial.sql carry a
+-- database level timezone, the session timezone is set by the server now
+-- +migrate StatementBegin
+DO $reset_timezone$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_db_role_setting s
+        JOIN pg_database d ON d.oid = s.setdatabase
+        WHERE d.datname = current_database() AND s.setrole = 0
+            AND array_to_string(s.setconfig, ',') ILIKE '%timezone=%'
+    ) THEN
+        EXECUTE format('ALTER DATABASE %I RESET timezone', current_database());
+    END IF;
+END
+$reset_timezone$;
+-- +migrate StatementEnd
+
+-- +migrate Down
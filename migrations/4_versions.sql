@@ -0,0 +1,26 @@
+-- +migrate Up
+ALTER TABLE thread ADD COLUMN IF NOT EXISTS version integer DEFAULT 1 NOT NULL;
+ALTER TABLE post ADD COLUMN IF NOT EXISTS version integer DEFAULT 1 NOT NULL;
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION increment_version() RETURNS TRIGGER AS $increment_version$
+    BEGIN
+        NEW.version := OLD.version + 1;
+        RETURN NEW;
+    END;
+$increment_version$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER increment_thread_version BEFORE UPDATE ON thread
+FOR EACH ROW EXECUTE PROCEDURE increment_version();
+
+CREATE TRIGGER increment_post_version BEFORE UPDATE ON post
+FOR EACH ROW EXECUTE PROCEDURE increment_version();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS increment_post_version ON post;
+DROP TRIGGER IF EXISTS increment_thread_version ON thread;
+DROP FUNCTION IF EXISTS increment_version();
+
+ALTER TABLE post DROP COLUMN IF EXISTS version;
+ALTER TABLE thread DROP COLUMN IF EXISTS version;
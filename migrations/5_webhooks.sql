@@ -0,0 +1,43 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS webhook (
+    webhook_id serial PRIMARY KEY,
+    forum citext NOT NULL REFERENCES forum (forum_slug) ON DELETE CASCADE,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text[] DEFAULT '{}' NOT NULL, -- empty means all events
+    created timestamptz DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_forum ON webhook (forum);
+
+-- Deliveries are written in the transaction of the change and removed
+-- once delivered or given up on.
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    delivery_id bigserial PRIMARY KEY,
+    webhook_id integer NOT NULL REFERENCES webhook ON DELETE CASCADE,
+    event text NOT NULL,
+    payload text NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    next_attempt timestamptz DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_outbox_next_attempt ON webhook_outbox (next_attempt);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    log_id bigserial PRIMARY KEY,
+    delivery_id bigint NOT NULL,
+    webhook_id integer NOT NULL REFERENCES webhook ON DELETE CASCADE,
+    event text NOT NULL,
+    attempt integer NOT NULL,
+    status integer, -- NULL if no response was received
+    error text DEFAULT '' NOT NULL,
+    duration_ms integer NOT NULL,
+    delivered timestamptz DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_webhook ON webhook_delivery (webhook_id, log_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS webhook_outbox;
+DROP TABLE IF EXISTS webhook;
@@ -0,0 +1,19 @@
+-- +migrate Up
+-- Change feed of all writes. Rows are inserted under an advisory lock
+-- held until commit, so seq order is commit order and a reader never
+-- sees a gap filled later.
+CREATE TABLE IF NOT EXISTS events (
+    seq bigserial PRIMARY KEY,
+    type text NOT NULL,
+    record text NOT NULL, -- e.g. post:42, compaction keeps the last event of each
+    forum citext,
+    thread integer,
+    payload text NOT NULL,
+    created timestamptz DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_record ON events (record, seq);
+CREATE INDEX IF NOT EXISTS idx_events_created ON events (created);
+
+-- +migrate Down
+DROP TABLE IF EXISTS events;
@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS notification (
+    notification_id bigserial PRIMARY KEY,
+    recipient citext NOT NULL REFERENCES forum_user (nickname) ON DELETE CASCADE,
+    type text NOT NULL, -- reply, mention or vote
+    actor citext NOT NULL,
+    forum citext NOT NULL,
+    thread integer NOT NULL,
+    post integer, -- NULL for votes and mentions in threads
+    voice integer,
+    created timestamptz DEFAULT now() NOT NULL,
+    is_read boolean DEFAULT FALSE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_recipient ON notification (recipient, notification_id);
+CREATE INDEX IF NOT EXISTS idx_notification_unread ON notification (recipient) WHERE NOT is_read;
+
+-- +migrate Down
+DROP TABLE IF EXISTS notification;
@@ -0,0 +1,21 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS thread_subscription (
+    nickname citext REFERENCES forum_user ON DELETE CASCADE NOT NULL,
+    thread integer REFERENCES thread ON DELETE CASCADE NOT NULL,
+    last_read integer DEFAULT 0 NOT NULL, -- id of the last post read
+    PRIMARY KEY (nickname, thread)
+);
+
+CREATE TABLE IF NOT EXISTS forum_subscription (
+    nickname citext REFERENCES forum_user ON DELETE CASCADE NOT NULL,
+    forum citext REFERENCES forum ON DELETE CASCADE NOT NULL,
+    PRIMARY KEY (nickname, forum)
+);
+
+-- unread posts
+CREATE INDEX IF NOT EXISTS idx_post__thread_post_id ON post (thread, post_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_post__thread_post_id;
+DROP TABLE IF EXISTS forum_subscription;
+DROP TABLE IF EXISTS thread_subscription;
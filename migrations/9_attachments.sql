@@ -0,0 +1,27 @@
+-- +migrate Up
+-- files by the hex SHA-256 of their content, shared by all attachments
+-- with the same content
+CREATE TABLE IF NOT EXISTS blob (
+    hash text PRIMARY KEY,
+    size bigint NOT NULL,
+    content_type text NOT NULL,
+    width integer DEFAULT 0 NOT NULL,
+    height integer DEFAULT 0 NOT NULL,
+    thumbnail_type text,
+    used timestamptz DEFAULT now() NOT NULL -- last attached, orphans are kept for a while after it
+);
+
+CREATE TABLE IF NOT EXISTS attachment (
+    attachment_id serial PRIMARY KEY,
+    post integer REFERENCES post ON DELETE CASCADE NOT NULL,
+    blob text REFERENCES blob NOT NULL,
+    filename text NOT NULL,
+    created timestamptz DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment__post ON attachment (post);
+CREATE INDEX IF NOT EXISTS idx_attachment__blob ON attachment (blob);
+
+-- +migrate Down
+DROP TABLE IF EXISTS attachment;
+DROP TABLE IF EXISTS blob;
@@ -0,0 +1,10 @@
+// Package migrations holds the database schema, it is built into the
+// binaries so they don't depend on the working directory.
+package migrations
+
+import (
+	"embed"
+)
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Attachment is a file of a post. Files are stored once by their SHA-256,
+// Hash, however many posts have them.
+//
+//easyjson:json
+type Attachment struct {
+	AttachmentID  int       `json:"id" db:"attachment_id"`
+	Post          int       `json:"post"`
+	Filename      string    `json:"filename"`
+	ContentType   string    `json:"contentType" db:"content_type"`
+	Size          int64     `json:"size"`
+	Hash          string    `json:"hash"`
+	Width         int       `json:"width,omitempty"`
+	Height        int       `json:"height,omitempty"`
+	ThumbnailType string    `json:"thumbnailType,omitempty" db:"thumbnail_type"` // empty if there is no thumbnail
+	Created       time.Time `json:"created"`
+}
+
+//easyjson:json
+type AttachmentList []Attachment
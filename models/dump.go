@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// Types of dump records, dumps keep them grouped in this order.
+const (
+	DumpTypeUser     = "user"
+	DumpTypeCategory = "category"
+	DumpTypeForum    = "forum"
+	DumpTypeThread   = "thread"
+	DumpTypePost     = "post"
+	DumpTypeVote     = "vote"
+)
+
+// DumpRecord is a line of an NDJSON dump, Data holds the model of Type.
+//
+//easyjson:json
+type DumpRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+//easyjson:json
+type DumpVote struct {
+	Nickname string `json:"nickname"`
+	Thread   int    `json:"thread"`
+	Voice    int    `json:"voice"`
+}
+
+//easyjson:json
+type ImportResult struct {
+	Users      int  `json:"users"`
+	Categories int  `json:"categories"`
+	Forums     int  `json:"forums"`
+	Threads    int  `json:"threads"`
+	Posts      int  `json:"posts"`
+	Votes      int  `json:"votes"`
+	DryRun     bool `json:"dryRun"`
+}
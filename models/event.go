@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+const (
+	EventThreadCreated = "thread_created"
+	EventPostCreated   = "post_created"
+	EventPostUpdated   = "post_updated"
+	EventThreadVoted   = "thread_voted"
+	EventThreadUpdated = "thread_updated"
+	EventUserCreated   = "user_created"
+	EventUserUpdated   = "user_updated"
+	EventUserRenamed   = "user_renamed"
+	EventUserDeleted   = "user_deleted"
+	EventForumCreated  = "forum_created"
+	EventForumUpdated  = "forum_updated"
+	EventVoteCreated   = "vote_created"
+	EventVoteUpdated   = "vote_updated"
+
+	EventAttachmentCreated = "attachment_created"
+	EventAttachmentDeleted = "attachment_deleted"
+	EventCategoryCreated   = "category_created"
+	EventCategoryUpdated   = "category_updated"
+	// EventReset tells a resuming client that events were missed and it
+	// has to fetch the current state again.
+	EventReset = "reset"
+)
+
+// Event is a change pushed to live subscribers, webhooks or read from the
+// change feed. Data is the record as the API returns it.
+//
+//easyjson:json
+type Event struct {
+	ID     int64           `json:"id"`
+	Type   string          `json:"type"`
+	Forum  string          `json:"forum,omitempty"`
+	Thread int             `json:"thread,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+//easyjson:json
+type EventList []Event
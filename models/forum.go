@@ -2,9 +2,61 @@ package models
 
 //easyjson:json
 type Forum struct {
-	ForumSlug  string `json:"slug" db:"forum_slug"`
-	ForumTitle string `json:"title" db:"forum_title"`
-	ForumUser  string `json:"user" db:"forum_user"`
-	Threads    int    `json:"threads"`
-	Posts      int    `json:"posts"`
+	ForumSlug  string  `json:"slug" db:"forum_slug"`
+	ForumTitle string  `json:"title" db:"forum_title"`
+	ForumUser  string  `json:"user" db:"forum_user"`
+	Threads    int     `json:"threads"`
+	Posts      int     `json:"posts"`
+	Parent     *string `json:"parent,omitempty" db:"forum_parent"` // the forum this one is a sub-forum of
+	Category   *string `json:"category,omitempty"`                 // only top-level forums have one
+	Position   int     `json:"position,omitempty"`                 // order among the siblings
+}
+
+// ForumUpdate changes a forum, fields that are not set are kept. A parent
+// or a category moves the forum there, an empty one takes it out.
+//
+//easyjson:json
+type ForumUpdate struct {
+	Title    string  `json:"title"`
+	Parent   *string `json:"parent"`
+	Category *string `json:"category"`
+	Position *int    `json:"position"`
+}
+
+// ForumNode is a forum in the hierarchy. The totals add up the counters of
+// the forum and all of its sub-forums.
+//
+//easyjson:json
+type ForumNode struct {
+	Forum
+	TotalThreads int           `json:"totalThreads" db:"total_threads"`
+	TotalPosts   int           `json:"totalPosts" db:"total_posts"`
+	Forums       ForumNodeList `json:"forums,omitempty" db:"-"` // sub-forums, only in a category
+}
+
+//easyjson:json
+type ForumNodeList []ForumNode
+
+// Category groups top-level forums. Its counters add up the ones of all
+// forums in it.
+//
+//easyjson:json
+type Category struct {
+	CategorySlug  string        `json:"slug" db:"category_slug"`
+	CategoryTitle string        `json:"title" db:"category_title"`
+	Position      int           `json:"position"`
+	Threads       int           `json:"threads"`
+	Posts         int           `json:"posts"`
+	Forums        ForumNodeList `json:"forums,omitempty" db:"-"` // only in a single category
+}
+
+//easyjson:json
+type CategoryList []Category
+
+// CategoryUpdate changes a category, fields that are not set are kept.
+//
+//easyjson:json
+type CategoryUpdate struct {
+	Title    string `json:"title"`
+	Position *int   `json:"position"`
 }
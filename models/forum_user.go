@@ -1,12 +1,49 @@
 package models
 
+import (
+	"time"
+)
+
 //easyjson:json
 type ForumUser struct {
-	Nickname string `json:"nickname"`
-	Fullname string `json:"fullname"`
-	Email    string `json:"email"`
-	About    string `json:"about"`
+	Nickname  string     `json:"nickname"`
+	Fullname  string     `json:"fullname"`
+	Email     string     `json:"email"`
+	About     string     `json:"about"`
+	Signature string     `json:"signature,omitempty"`
+	Avatar    *string    `json:"avatar,omitempty"` // hash of the image, served by /user/{nickname}/avatar
+	Joined    *time.Time `json:"joined,omitempty"`
+	LastSeen  *time.Time `json:"lastSeen,omitempty" db:"last_seen"` // updated at most once a minute
 }
 
 //easyjson:json
 type ForumUserList []ForumUser
+
+// UserStats are counters kept up to date on every write, see
+// 10_profiles.sql. Votes is the sum of votes for the threads of the user.
+//
+//easyjson:json
+type UserStats struct {
+	Nickname string     `json:"nickname"`
+	Threads  int        `json:"threads"`
+	Posts    int        `json:"posts"`
+	Votes    int        `json:"votes"`
+	Joined   time.Time  `json:"joined"`
+	LastSeen *time.Time `json:"lastSeen,omitempty" db:"last_seen"`
+}
+
+// UserRename asks to change the nickname of a user. As the data of a
+// rename event it also has the old nickname.
+//
+//easyjson:json
+type UserRename struct {
+	OldNickname string `json:"oldNickname,omitempty"`
+	Nickname    string `json:"nickname"`
+}
+
+// DeletedUser is the data of the event of a deleted account.
+//
+//easyjson:json
+type DeletedUser struct {
+	Nickname string `json:"nickname"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	MigrationApplied = "applied"
+	MigrationPending = "pending"
+	MigrationMissing = "missing" // applied, but not known to the binary
+)
+
+//easyjson:json
+type Migration struct {
+	ID        string     `json:"id"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+//easyjson:json
+type MigrationList []Migration
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	NotificationVote    = "vote"
+)
+
+// Notification tells a user that Actor replied to or mentioned them in
+// Post (0 for mentions in the thread message itself), or voted for their
+// thread with Voice.
+//
+//easyjson:json
+type Notification struct {
+	NotificationID int64     `json:"id" db:"notification_id"`
+	Type           string    `json:"type"`
+	Actor          string    `json:"actor"`
+	Forum          string    `json:"forum"`
+	Thread         int       `json:"thread"`
+	Post           int       `json:"post,omitempty"`
+	Voice          int       `json:"voice,omitempty"`
+	Created        time.Time `json:"created"`
+	IsRead         bool      `json:"isRead" db:"is_read"`
+}
+
+//easyjson:json
+type NotificationList []Notification
+
+//easyjson:json
+type NotificationPage struct {
+	Unread        int              `json:"unread"`
+	Notifications NotificationList `json:"notifications"`
+}
+
+// NotificationsRead marks IDs read, or all up to UpTo, or all if both are
+// empty.
+//
+//easyjson:json
+type NotificationsRead struct {
+	IDs  []int64 `json:"ids,omitempty"`
+	UpTo int64   `json:"upTo,omitempty"`
+}
+
+//easyjson:json
+type UnreadCount struct {
+	Unread int `json:"unread"`
+}
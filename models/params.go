@@ -5,9 +5,18 @@ import (
 )
 
 type ThreadQueryParams struct {
-	Desc  bool
-	Limit uint64
-	Since time.Time
+	Desc    bool
+	Limit   uint64
+	Since   time.Time
+	SinceID int    // makes Since exclusive, ties on time are broken by id
+	Tag     string // only threads with the tag, in lists of a forum
+}
+
+// AuthorQueryParams select threads or posts of a user, ordered by
+// creation. Forum narrows them to one forum unless it is empty.
+type AuthorQueryParams struct {
+	ThreadQueryParams
+	Forum string
 }
 
 type UserQueryParams struct {
@@ -16,6 +25,10 @@ type UserQueryParams struct {
 	Since string
 }
 
+// ForumQueryParams page forums by slug like UserQueryParams page users by
+// nickname.
+type ForumQueryParams UserQueryParams
+
 type PostQueryArgs struct {
 	Related string
 }
@@ -26,3 +39,17 @@ type ThreadPostsQueryArgs struct {
 	Sort  string
 	Desc  bool
 }
+
+type NotificationQueryParams struct {
+	Limit      uint64
+	Since      int64 // notifications older than this ID
+	UnreadOnly bool
+}
+
+// FeedCursor is the position after which a feed page starts, the zero
+// value is the start.
+type FeedCursor struct {
+	Created time.Time
+	Type    string
+	ID      int
+}
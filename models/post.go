@@ -16,22 +16,42 @@ type Post struct {
 	PostCreated time.Time `json:"created" db:"post_created"`
 	IsEdited    bool      `json:"isEdited" db:"is_edited"`
 	PostMessage string    `json:"message" db:"post_message"`
+	MessageHTML string    `json:"message_html,omitempty" db:"-"` // only on request
+	Version     int       `json:"-"`
 }
 
 //easyjson:json
 type PostList []Post
 
-type PostInfoAllFields struct {
+// UserPost is a post listed among the posts of its author, with the
+// thread and forum it is in.
+//
+//easyjson:json
+type UserPost struct {
 	Post
-	Forum
-	Thread
-	ForumUser
+	ThreadTitle string  `json:"threadTitle" db:"thread_title"`
+	ThreadSlug  *string `json:"threadSlug,omitempty" db:"thread_slug"`
+	ForumTitle  string  `json:"forumTitle" db:"forum_title"`
+}
+
+//easyjson:json
+type UserPostList []UserPost
+
+// PostInfoAllFields is only scanned from the database, never serialized.
+// The post version is aliased, the thread has a version column too.
+type PostInfoAllFields struct {
+	Post        `json:"-"`
+	Forum       `json:"-"`
+	Thread      `json:"-"`
+	ForumUser   `json:"-"`
+	PostVersion int `json:"-" db:"post_version"`
 }
 
 //easyjson:json
 type PostInfo struct {
-	Post   *Post      `json:"post,omitempty"`
-	Forum  *Forum     `json:"forum,omitempty"`
-	Thread *Thread    `json:"thread,omitempty"`
-	Author *ForumUser `json:"author,omitempty"`
+	Post        *Post          `json:"post,omitempty"`
+	Forum       *Forum         `json:"forum,omitempty"`
+	Thread      *Thread        `json:"thread,omitempty"`
+	Author      *ForumUser     `json:"author,omitempty"`
+	Attachments AttachmentList `json:"attachments,omitempty"`
 }
@@ -0,0 +1,40 @@
+package models
+
+//easyjson:json
+type WatchedThread struct {
+	Thread   *Thread `json:"thread"`
+	LastRead int     `json:"lastRead"`
+	Unread   int     `json:"unread"`
+}
+
+//easyjson:json
+type WatchList struct {
+	Threads []WatchedThread `json:"threads"`
+	Forums  []Forum         `json:"forums"`
+}
+
+// LastRead moves the read marker of a thread to Post, 0 means the last
+// post of the thread.
+//
+//easyjson:json
+type LastRead struct {
+	Post int `json:"post"`
+}
+
+const (
+	FeedThread = "thread"
+	FeedPost   = "post"
+)
+
+// FeedItem is a new thread of a watched forum or a new post of a watched
+// thread.
+//
+//easyjson:json
+type FeedItem struct {
+	Type   string  `json:"type"`
+	Thread *Thread `json:"thread,omitempty"`
+	Post   *Post   `json:"post,omitempty"`
+}
+
+//easyjson:json
+type FeedItemList []FeedItem
@@ -2,19 +2,35 @@ package models
 
 import (
 	"time"
+
+	"github.com/lib/pq"
 )
 
 //easyjson:json
 type Thread struct {
-	ThreadID      int        `json:"id" db:"thread_id"`
-	Forum         string     `json:"forum"`
-	ThreadSlug    *string    `json:"slug,omitempty" db:"thread_slug"`
-	ThreadTitle   string     `json:"title" db:"thread_title"`
-	ThreadAuthor  string     `json:"author" db:"thread_author"`
-	ThreadCreated *time.Time `json:"created,omitempty" db:"thread_created"`
-	ThreadMessage string     `json:"message" db:"thread_message"`
-	Votes         int        `json:"votes"`
+	ThreadID      int            `json:"id" db:"thread_id"`
+	Forum         string         `json:"forum"`
+	ThreadSlug    *string        `json:"slug,omitempty" db:"thread_slug"`
+	ThreadTitle   string         `json:"title" db:"thread_title"`
+	ThreadAuthor  string         `json:"author" db:"thread_author"`
+	ThreadCreated *time.Time     `json:"created,omitempty" db:"thread_created"`
+	ThreadMessage string         `json:"message" db:"thread_message"`
+	MessageHTML   string         `json:"message_html,omitempty" db:"-"` // only on request
+	Votes         int            `json:"votes"`
+	Tags          pq.StringArray `json:"tags,omitempty"` // lower case, set on creation and by updates
+	Version       int            `json:"-"`
 }
 
 //easyjson:json
 type ThreadList []Thread
+
+// TagCount is a tag of a forum with the number of threads that have it.
+//
+//easyjson:json
+type TagCount struct {
+	Tag     string `json:"tag"`
+	Threads int    `json:"threads"`
+}
+
+//easyjson:json
+type TagCountList []TagCount
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook sends events of a forum to URL, signed with Secret. Secret is
+// only accepted, never returned.
+//
+//easyjson:json
+type Webhook struct {
+	WebhookID int       `json:"id" db:"webhook_id"`
+	Forum     string    `json:"forum"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Created   time.Time `json:"created"`
+}
+
+//easyjson:json
+type WebhookList []Webhook
+
+// WebhookDelivery is an attempt to deliver an event, Status is nil when
+// the receiver didn't respond.
+//
+//easyjson:json
+type WebhookDelivery struct {
+	DeliveryID int64     `json:"id" db:"delivery_id"`
+	WebhookID  int       `json:"webhook" db:"webhook_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Status     *int      `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Duration   int       `json:"duration_ms" db:"duration_ms"`
+	Delivered  time.Time `json:"delivered"`
+}
+
+//easyjson:json
+type WebhookDeliveryList []WebhookDelivery
+
+// WebhookOutboxItem is a delivery waiting in the outbox, it is only
+// scanned from the database.
+type WebhookOutboxItem struct {
+	DeliveryID int64 `db:"delivery_id"`
+	WebhookID  int   `db:"webhook_id"`
+	Event      string
+	Payload    string
+	Attempts   int
+	URL        string
+	Secret     string
+}
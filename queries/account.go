@@ -0,0 +1,349 @@
+package queries
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// DeletedNickname is the placeholder user that forums, threads and posts
+// of deleted accounts are kept under, see 13_deletions.sql. Nobody can
+// sign up, write or vote as it.
+const DeletedNickname = "[deleted]"
+
+// createDeletedUser makes the placeholder unless it is there already. It
+// is no user of the forum: the status doesn't count it.
+func createDeletedUser(tx sqlx.Execer) error {
+	_, err := tx.Exec(`INSERT INTO forum_user (nickname, fullname, email, about)
+		VALUES ($1, 'Deleted user', 'deleted@forum.invalid', '')
+		ON CONFLICT DO NOTHING`, DeletedNickname)
+	return err
+}
+
+// deletedRefs are the columns whose rows outlive a deleted user. The rest
+// of the rows go away: votes are withdrawn here, subscriptions and
+// notifications of the user cascade.
+var deletedRefs = []struct{ table, column string }{
+	{"forum", "forum_user"},
+	{"thread", "thread_author"},
+	{"post", "post_author"},
+	{"notification", "actor"},
+}
+
+// deletedPayloadRefs are the fields of the payloads of the feed and of
+// undelivered webhooks that name the author of a thread or a post or the
+// owner of a forum. Webhook payloads carry the record under data.
+var deletedPayloadRefs = []struct{ table, path string }{
+	{"events", "{author}"},
+	{"events", "{user}"},
+	{"webhook_outbox", "{data,author}"},
+	{"webhook_outbox", "{data,user}"},
+}
+
+// DeleteUser deletes the account of the user n. Like a rename it moves the
+// rows of the user in batches, an interrupted deletion is finished by the
+// next call or by FinishDeletions.
+func DeleteUser(n string) error {
+	if strings.EqualFold(n, DeletedNickname) {
+		return &ValidationError{"User", "nickname"}
+	}
+	nickname, err := startDeletion(n)
+	if err != nil {
+		return err
+	}
+	return finishDeletion(nickname)
+}
+
+func startDeletion(n string) (string, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	nickname := ""
+	err = tx.Get(&nickname, "SELECT nickname FROM forum_user WHERE nickname = $1 FOR UPDATE", n)
+	if err == sql.ErrNoRows {
+		return "", &RecordNotFoundError{"User", n}
+	}
+	if err != nil {
+		return "", err
+	}
+	renaming := false
+	err = tx.Get(&renaming, `SELECT EXISTS (SELECT FROM nickname_rename
+		WHERE old_nickname = $1 OR nickname = $1)`, nickname)
+	if err != nil {
+		return "", err
+	}
+	if renaming {
+		return "", ErrRenameInProgress
+	}
+	if err = createDeletedUser(tx); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("INSERT INTO user_deletion (nickname) VALUES ($1) ON CONFLICT DO NOTHING", nickname)
+	if err != nil {
+		return "", err
+	}
+	return nickname, tx.Commit()
+}
+
+// withdrawVotes deletes up to limit votes of the user, all of them if
+// limit is 0, and takes them off the counters of their threads. The vote
+// trigger only counts inserts and updates.
+func withdrawVotes(tx *sqlx.Tx, nickname string, limit int) (int64, error) {
+	votes := "SELECT ctid FROM vote WHERE nickname = $1"
+	if limit > 0 {
+		votes += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	res := int64(0)
+	err := tx.Get(&res, `
+		WITH withdrawn AS (
+			DELETE FROM vote WHERE ctid = ANY(ARRAY(`+votes+`))
+			RETURNING thread, voice
+		), counted AS (
+			UPDATE thread t SET votes = t.votes - w.voice
+			FROM withdrawn w WHERE t.thread_id = w.thread
+		)
+		SELECT COUNT(*) FROM withdrawn`, nickname)
+	return res, err
+}
+
+func withdrawVotesBatch(nickname string) (int64, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := withdrawVotes(tx, nickname, renameBatch)
+	if err != nil {
+		return 0, err
+	}
+	return res, tx.Commit()
+}
+
+func finishDeletion(nickname string) error {
+	for _, ref := range deletedRefs {
+		for {
+			moved, err := moveBatch(nickname, DeletedNickname, ref.table, ref.column, "")
+			if err != nil {
+				return err
+			}
+			if moved < renameBatch {
+				break
+			}
+		}
+	}
+	for {
+		withdrawn, err := withdrawVotesBatch(nickname)
+		if err != nil {
+			return err
+		}
+		if withdrawn < renameBatch {
+			break
+		}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// with the user locked nothing can refer to it until commit
+	locked := 0
+	err = tx.Get(&locked, `SELECT COUNT(*) FROM (SELECT FROM forum_user
+		WHERE nickname = $1 FOR UPDATE) u`, nickname)
+	if err != nil {
+		return err
+	}
+	if locked == 0 {
+		return nil // finished by someone else
+	}
+	for _, ref := range deletedRefs {
+		// rows written since the batches
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %[1]s SET %[2]s = $2 WHERE %[2]s = $1", ref.table, ref.column),
+			nickname, DeletedNickname)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err = withdrawVotes(tx, nickname, 0); err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM users_in_forum WHERE forum_user = $1", nickname)
+	if err != nil {
+		return err
+	}
+	// the avatar gets the grace period of detached files
+	_, err = tx.Exec(`UPDATE blob SET used = now()
+		WHERE hash = (SELECT avatar FROM forum_user WHERE nickname = $1)`, nickname)
+	if err != nil {
+		return err
+	}
+	// the feed keeps no profile, renames or votes of the user
+	votes := strings.TrimSuffix(voteRecord(nickname, 0), "0")
+	votes = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(votes) + "%"
+	_, err = tx.Exec(`DELETE FROM events WHERE record = $1 OR record LIKE $2
+		OR type = $3 AND lower(payload::jsonb ->> 'nickname') = lower($4)`,
+		userRecord(nickname), votes, models.EventUserRenamed, nickname)
+	if err != nil {
+		return err
+	}
+	// and what stays names the placeholder, as the rows do
+	for _, ref := range deletedPayloadRefs {
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE %s
+			SET payload = jsonb_set(payload::jsonb, $3::text[], to_jsonb($2::text))::text
+			WHERE lower(payload::jsonb #>> $3::text[]) = lower($1)`, ref.table),
+			nickname, DeletedNickname, ref.path)
+		if err != nil {
+			return err
+		}
+	}
+	if err = addUserStats(tx, nickname, DeletedNickname); err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM forum_user WHERE nickname = $1", nickname)
+	if err != nil {
+		return err
+	}
+	err = recordChanges(tx, models.EventUserDeleted, "", 0,
+		change{userRecord(nickname), &models.DeletedUser{Nickname: nickname}})
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	// forums and threads are cached with their authors and counters
+	purgeCaches()
+	return err
+}
+
+// FinishDeletions completes the deletions an earlier process was
+// interrupted in.
+func FinishDeletions() {
+	nicknames := []string{}
+	err := db.Select(&nicknames, "SELECT nickname FROM user_deletion ORDER BY started")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, n := range nicknames {
+		log.Printf("deletions: finishing %v\n", n)
+		if err = finishDeletion(n); err != nil {
+			log.Printf("deletions: %v: %v\n", n, err)
+		}
+	}
+}
+
+// ExportUser writes a zip archive of the data of the user n to w: the
+// profile with its counters, threads, posts with their threads and forums,
+// and votes, all from a single snapshot. Lists are NDJSON, a record per
+// line. Nothing is written if the user doesn't exist.
+func ExportUser(n string, w io.Writer) error {
+	tx, err := db.BeginTxx(context.Background(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	u := &models.ForumUser{}
+	err = tx.Get(u, "SELECT * FROM forum_user WHERE nickname = $1", n)
+	if err == sql.ErrNoRows {
+		return &RecordNotFoundError{"User", n}
+	}
+	if err != nil {
+		return err
+	}
+	stats := &models.UserStats{}
+	err = tx.Get(stats, `SELECT u.nickname, COALESCE(s.threads, 0) threads, COALESCE(s.posts, 0) posts,
+		COALESCE(s.votes, 0) votes, u.joined, u.last_seen
+		FROM forum_user u LEFT JOIN user_stats s ON s.nickname = u.nickname
+		WHERE u.nickname = $1`, u.Nickname)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+	for _, f := range []struct {
+		name string
+		v    json.Marshaler
+	}{
+		{"profile.json", u},
+		{"stats.json", stats},
+	} {
+		fw, err := create(f.name)
+		if err != nil {
+			return err
+		}
+		j, err := f.v.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(append(j, '\n')); err != nil {
+			return err
+		}
+	}
+	lists := []struct {
+		name  string
+		query string
+		row   json.Marshaler
+	}{
+		{"threads.ndjson", "SELECT * FROM thread WHERE thread_author = $1 ORDER BY thread_created, thread_id",
+			&models.Thread{}},
+		{"posts.ndjson", `SELECT p.post_id, p.forum, p.thread, p.parent, p.post_author, p.post_created,
+			p.is_edited, p.post_message, t.thread_title, t.thread_slug, f.forum_title
+			FROM post p
+			JOIN thread t ON t.thread_id = p.thread
+			JOIN forum f ON f.forum_slug = p.forum
+			WHERE p.post_author = $1 ORDER BY p.post_created, p.post_id`, &models.UserPost{}},
+		{"votes.ndjson", "SELECT nickname, thread, voice FROM vote WHERE nickname = $1 ORDER BY thread",
+			&models.DumpVote{}},
+	}
+	for _, l := range lists {
+		fw, err := create(l.name)
+		if err != nil {
+			return err
+		}
+		if err = exportRows(tx, fw, l.query, l.row, u.Nickname); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func exportRows(tx *sqlx.Tx, w io.Writer, query string, row json.Marshaler, args ...interface{}) error {
+	rows, err := tx.Queryx(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = rows.StructScan(row); err != nil {
+			return err
+		}
+		j, err := row.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(append(j, '\n')); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,49 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestDeleteUserLeavesNoNickname(t *testing.T) {
+	testDB(t)
+	testUser(t, "stays")
+	testUser(t, "Gone")
+	testForum(t, "deletions", "stays")
+	if _, err := CreateWebhook(&models.Webhook{Forum: "deletions", URL: "http://example.com/hook", Secret: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	testForum(t, "abandoned", "gone")
+	th := testThread(t, "deletions", "gone")
+	posts := models.PostList{{PostAuthor: "gone", PostMessage: "bye"}, {PostAuthor: "stays", PostMessage: "hi"}}
+	if _, err := CreatePosts(&posts, strconv.Itoa(th.ThreadID)); err != nil {
+		t.Fatal(err)
+	}
+	outbox := countRows(t, "webhook_outbox")
+
+	if err := DeleteUser("GONE"); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"events", "webhook_outbox"} {
+		n := 0
+		err := db.Get(&n, `SELECT count(*) FROM `+table+` WHERE lower(payload) LIKE '%"gone"%'`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%s has %d payloads with the deleted nickname", table, n)
+		}
+	}
+	if n := countRows(t, "webhook_outbox"); n != outbox {
+		t.Errorf("got %d deliveries, want all %d kept", n, outbox)
+	}
+	stats, err := GetUserStats(DeletedNickname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Threads != 1 || stats.Posts != 1 {
+		t.Errorf("got stats %+v of the placeholder, want the thread and the post of the deleted user", stats)
+	}
+}
@@ -0,0 +1,413 @@
+package queries
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/storage"
+)
+
+// DefaultAttachmentTypes are the media types accepted unless configured.
+var DefaultAttachmentTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp",
+	"application/pdf", "application/zip", "text/plain",
+}
+
+// AttachmentLimits bound uploaded files. Types are compared with the
+// media type sniffed from the content, what the client claims is ignored.
+type AttachmentLimits struct {
+	MaxSize   int64
+	Types     []string
+	Thumbnail int // side of the square thumbnails fit in
+}
+
+var (
+	blobs            storage.Storage
+	attachmentLimits = AttachmentLimits{
+		MaxSize:   10 << 20,
+		Types:     DefaultAttachmentTypes,
+		Thumbnail: 256,
+	}
+)
+
+// UseStorage enables attachments, their files are kept in s.
+func UseStorage(s storage.Storage, limits AttachmentLimits) {
+	blobs = s
+	attachmentLimits = limits
+}
+
+func GetAttachmentLimits() AttachmentLimits {
+	return attachmentLimits
+}
+
+func thumbnailKey(hash string) string {
+	return hash + ".thumb"
+}
+
+// Upload is a file spooled to disk and checked against the limits before
+// it is attached. Close removes it.
+type Upload struct {
+	Filename    string
+	file        *os.File
+	size        int64
+	hash        string
+	contentType string
+}
+
+// NewUpload reads r to the end, unless it turns out to be too large.
+func NewUpload(filename string, r io.Reader) (*Upload, error) {
+	if blobs == nil {
+		return nil, ErrAttachmentsDisabled
+	}
+	f, err := ioutil.TempFile("", "forum-upload-")
+	if err != nil {
+		return nil, err
+	}
+	u := &Upload{Filename: cleanFilename(filename), file: f}
+	h := sha256.New()
+	u.size, err = io.Copy(io.MultiWriter(f, h), io.LimitReader(r, attachmentLimits.MaxSize+1))
+	if err == nil && u.size > attachmentLimits.MaxSize {
+		err = ErrAttachmentTooLarge
+	}
+	if err == nil && u.size == 0 {
+		err = &ValidationError{"Attachment", "file"}
+	}
+	if err != nil {
+		u.Close()
+		return nil, err
+	}
+	u.hash = hex.EncodeToString(h.Sum(nil))
+
+	head := make([]byte, 512)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		u.Close()
+		return nil, err
+	}
+	u.contentType = http.DetectContentType(head[:n])
+	mediaType, _, _ := mime.ParseMediaType(u.contentType)
+	for _, t := range attachmentLimits.Types {
+		if t == mediaType {
+			return u, nil
+		}
+	}
+	u.Close()
+	return nil, ErrAttachmentType
+}
+
+func (u *Upload) Close() error {
+	u.file.Close()
+	return os.Remove(u.file.Name())
+}
+
+func (u *Upload) reader() io.Reader {
+	return io.NewSectionReader(u.file, 0, u.size)
+}
+
+// cleanFilename keeps the last element of a path some clients send.
+func cleanFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	name = filepath.Base(strings.Replace(name, `\`, "/", -1))
+	name = strings.TrimSpace(name)
+	for utf8.RuneCountInString(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// storeBlob makes sure the file of u and its thumbnail are stored and
+// locks the blob row, so that the collector leaves it alone until tx ends.
+func storeBlob(tx *sqlx.Tx, u *Upload) (*models.Attachment, error) {
+	res := &models.Attachment{Hash: u.hash, Size: u.size, ContentType: u.contentType}
+	err := tx.QueryRow(`SELECT width, height, COALESCE(thumbnail_type, '') FROM blob
+		WHERE hash = $1 FOR UPDATE`, u.hash).Scan(&res.Width, &res.Height, &res.ThumbnailType)
+	if err == nil {
+		_, err = tx.Exec("UPDATE blob SET used = now() WHERE hash = $1", u.hash)
+		if err != nil {
+			return nil, err
+		}
+		// the row can outlive the file if the collector failed halfway
+		ok, err := blobs.Exists(u.hash)
+		if err != nil || ok {
+			return res, err
+		}
+		return res, putBlob(u, res)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(u.contentType)
+	if w, h, err := storage.ImageSize(u.reader(), mediaType); err == nil {
+		res.Width, res.Height = w, h
+	}
+	if err = putBlob(u, res); err != nil {
+		return nil, err
+	}
+	// a concurrent upload of the same file may have inserted it meanwhile
+	_, err = tx.Exec(`INSERT INTO blob (hash, size, content_type, width, height, thumbnail_type)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		ON CONFLICT (hash) DO UPDATE SET used = now()`,
+		res.Hash, res.Size, res.ContentType, res.Width, res.Height, res.ThumbnailType)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// putBlob stores the file of u and, for images, the thumbnail described
+// by a. ThumbnailType is set when a new thumbnail is made.
+func putBlob(u *Upload, a *models.Attachment) error {
+	if err := blobs.Put(u.hash, u.reader()); err != nil {
+		return err
+	}
+	if a.Width == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(u.contentType)
+	thumb, typ, err := storage.Thumbnail(u.reader(), mediaType, a.Width, a.Height, attachmentLimits.Thumbnail)
+	if err != nil {
+		// the file is still fine to attach
+		log.Printf("attachments: no thumbnail for %v: %v\n", u.hash, err)
+		return nil
+	}
+	if err = blobs.Put(thumbnailKey(u.hash), bytes.NewReader(thumb)); err != nil {
+		return err
+	}
+	a.ThumbnailType = typ
+	return nil
+}
+
+// CreateAttachments attaches uploads to the post, all or none of them.
+func CreateAttachments(postID int, uploads []*Upload) (*models.AttachmentList, error) {
+	if blobs == nil {
+		return nil, ErrAttachmentsDisabled
+	}
+	p, err := GetPostByID(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := models.AttachmentList{}
+	changes := []change{}
+	for _, u := range uploads {
+		a, err := storeBlob(tx, u)
+		if err != nil {
+			return nil, err
+		}
+		a.Post = postID
+		a.Filename = u.Filename
+		err = tx.QueryRow(`INSERT INTO attachment (post, blob, filename) VALUES ($1, $2, $3)
+			RETURNING attachment_id, created`, postID, a.Hash, a.Filename).Scan(&a.AttachmentID, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *a)
+		changes = append(changes, change{attachmentRecord(a.AttachmentID), a})
+	}
+	err = recordChanges(tx, models.EventAttachmentCreated, p.Forum, p.Thread, changes...)
+	if err != nil {
+		return nil, err
+	}
+	if err = commitChanges(tx); err != nil {
+		return nil, err
+	}
+	data := make([]json.Marshaler, len(changes))
+	for k, c := range changes {
+		data[k] = c.data
+	}
+	publish(models.EventAttachmentCreated, p.Forum, p.Thread, data...)
+	return &res, nil
+}
+
+const selectAttachments = `SELECT a.attachment_id, a.post, a.filename, b.content_type, b.size,
+	b.hash, b.width, b.height, COALESCE(b.thumbnail_type, '') thumbnail_type, a.created
+	FROM attachment a JOIN blob b ON b.hash = a.blob`
+
+// GetPostAttachments lists attachments of a post in upload order, it
+// doesn't check that the post exists.
+func GetPostAttachments(postID int) (*models.AttachmentList, error) {
+	res := &models.AttachmentList{}
+	err := onReplica(func(q *sqlx.DB) error {
+		return q.Select(res, selectAttachments+" WHERE a.post = $1 ORDER BY a.attachment_id", postID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func GetAttachment(id int) (*models.Attachment, error) {
+	res := &models.Attachment{}
+	err := onReplica(func(q *sqlx.DB) error {
+		return q.Get(res, selectAttachments+" WHERE a.attachment_id = $1", id)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &RecordNotFoundError{"Attachment", fmt.Sprintf("%v", id)}
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// OpenAttachment returns the attachment with its file, or its thumbnail
+// if thumbnail is set.
+func OpenAttachment(id int, thumbnail bool) (*models.Attachment, storage.File, error) {
+	if blobs == nil {
+		return nil, nil, ErrAttachmentsDisabled
+	}
+	a, err := GetAttachment(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := a.Hash
+	if thumbnail {
+		if a.ThumbnailType == "" {
+			return nil, nil, &RecordNotFoundError{"Thumbnail", fmt.Sprintf("%v", id)}
+		}
+		key = thumbnailKey(a.Hash)
+	}
+	f, err := blobs.Open(key)
+	if err == storage.ErrNotExist {
+		log.Printf("attachments: file %v of attachment %v is missing\n", key, id)
+		return nil, nil, &RecordNotFoundError{"Attachment", fmt.Sprintf("%v", id)}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, f, nil
+}
+
+// DeleteAttachment detaches the file from its post, the file itself is
+// deleted by the collector once no post has it.
+func DeleteAttachment(id int) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	a := &models.Attachment{}
+	err = tx.Get(a, `DELETE FROM attachment a USING blob b
+		WHERE a.attachment_id = $1 AND b.hash = a.blob
+		RETURNING a.attachment_id, a.post, a.filename, b.content_type, b.size,
+			b.hash, b.width, b.height, COALESCE(b.thumbnail_type, '') thumbnail_type, a.created`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &RecordNotFoundError{"Attachment", fmt.Sprintf("%v", id)}
+		}
+		return err
+	}
+	_, err = tx.Exec("UPDATE blob SET used = now() WHERE hash = $1", a.Hash)
+	if err != nil {
+		return err
+	}
+	p := models.Post{}
+	err = tx.Get(&p, "SELECT forum, thread FROM post WHERE post_id = $1", a.Post)
+	if err != nil {
+		return err
+	}
+	err = recordChanges(tx, models.EventAttachmentDeleted, p.Forum, p.Thread, change{attachmentRecord(id), a})
+	if err != nil {
+		return err
+	}
+	if err = commitChanges(tx); err != nil {
+		return err
+	}
+	publish(models.EventAttachmentDeleted, p.Forum, p.Thread, a)
+	return nil
+}
+
+// CollectBlobs deletes files no attachment or avatar has had for grace
+// and returns how many there were. Rows are locked while their files are
+// deleted, so an upload of the same content waits and stores the file
+// again.
+func CollectBlobs(grace time.Duration) (int, error) {
+	if blobs == nil {
+		return 0, nil
+	}
+	const batch = 100
+	n := 0
+	for {
+		deleted, err := collectBlobs(grace, batch)
+		n += deleted
+		if err != nil || deleted < batch {
+			return n, err
+		}
+	}
+}
+
+func collectBlobs(grace time.Duration, limit int) (int, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	hashes := []string{}
+	err = tx.Select(&hashes, `SELECT hash FROM blob b
+		WHERE used < now() - $1 * interval '1 millisecond'
+			AND NOT EXISTS (SELECT 1 FROM attachment a WHERE a.blob = b.hash)
+			AND NOT EXISTS (SELECT 1 FROM forum_user u WHERE u.avatar = b.hash)
+		LIMIT $2 FOR UPDATE SKIP LOCKED`,
+		grace.Nanoseconds()/int64(time.Millisecond), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, h := range hashes {
+		if err = blobs.Delete(thumbnailKey(h)); err != nil {
+			return 0, err
+		}
+		if err = blobs.Delete(h); err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM blob WHERE hash = ANY($1)", pq.Array(hashes))
+	if err != nil {
+		return 0, err
+	}
+	return len(hashes), tx.Commit()
+}
+
+// RunBlobCollector collects orphaned files every interval.
+func RunBlobCollector(interval, grace time.Duration) {
+	for range time.Tick(interval) {
+		n, err := CollectBlobs(grace)
+		if err != nil {
+			log.Println("attachments gc:", err)
+			continue
+		}
+		if n != 0 {
+			log.Printf("attachments gc: %d files deleted\n", n)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package queries
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// authorListQuery finishes a query for threads or posts of the author in
+// $1, prefix is the column prefix: thread or post. The arguments follow
+// the ones of the query.
+func authorListQuery(q *strings.Builder, prefix, author string, params *models.AuthorQueryParams) []interface{} {
+	args := []interface{}{author}
+	fmt.Fprintf(q, "WHERE %[1]s_author = $1\n", prefix)
+	if params.Forum != "" {
+		args = append(args, params.Forum)
+		fmt.Fprintf(q, "AND %[1]s.forum = $%[2]d\n", prefix, len(args))
+	}
+	if !params.Since.IsZero() {
+		args = append(args, params.Since)
+		n := len(args)
+		switch {
+		case params.SinceID != 0 && params.Desc:
+			args = append(args, params.SinceID)
+			fmt.Fprintf(q, "AND (%[1]s_created, %[1]s_id) < ($%[2]d, $%[3]d)\n", prefix, n, n+1)
+		case params.SinceID != 0:
+			args = append(args, params.SinceID)
+			fmt.Fprintf(q, "AND (%[1]s_created, %[1]s_id) > ($%[2]d, $%[3]d)\n", prefix, n, n+1)
+		case params.Desc:
+			fmt.Fprintf(q, "AND %[1]s_created <= $%[2]d\n", prefix, n)
+		default:
+			fmt.Fprintf(q, "AND %[1]s_created >= $%[2]d\n", prefix, n)
+		}
+	}
+	// the id breaks ties, so pages never overlap
+	if params.Desc {
+		fmt.Fprintf(q, "ORDER BY %[1]s_created DESC, %[1]s_id DESC", prefix)
+	} else {
+		fmt.Fprintf(q, "ORDER BY %[1]s_created, %[1]s_id", prefix)
+	}
+	if params.Limit != 0 {
+		fmt.Fprintf(q, "\nLIMIT %v", params.Limit)
+	}
+	return args
+}
+
+func checkAuthorList(nickname string, params *models.AuthorQueryParams) error {
+	if _, err := GetUserByNickname(nickname); err != nil {
+		return err
+	}
+	if params.Forum != "" {
+		return CheckExistenceOfForum(params.Forum)
+	}
+	return nil
+}
+
+// GetUserThreads returns threads the user started in all forums, or in
+// params.Forum.
+func GetUserThreads(nickname string, params *models.AuthorQueryParams) (*models.ThreadList, error) {
+	if err := checkAuthorList(nickname, params); err != nil {
+		return nil, err
+	}
+	q := strings.Builder{}
+	q.WriteString("SELECT * FROM thread ")
+	args := authorListQuery(&q, "thread", nickname, params)
+
+	res := &models.ThreadList{}
+	err := onReplica(func(conn *sqlx.DB) error {
+		return conn.Select(res, q.String(), args...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetUserPosts returns posts of the user with titles of their threads
+// and forums.
+func GetUserPosts(nickname string, params *models.AuthorQueryParams) (*models.UserPostList, error) {
+	if err := checkAuthorList(nickname, params); err != nil {
+		return nil, err
+	}
+	q := strings.Builder{}
+	q.WriteString(`SELECT post.post_id, post.forum, post.thread, post.parent,
+		post.post_author, post.post_created, post.is_edited, post.post_message,
+		t.thread_title, t.thread_slug, f.forum_title
+		FROM post
+		JOIN thread t ON t.thread_id = post.thread
+		JOIN forum f ON f.forum_slug = post.forum
+		`)
+	args := authorListQuery(&q, "post", nickname, params)
+
+	res := &models.UserPostList{}
+	err := onReplica(func(conn *sqlx.DB) error {
+		return conn.Select(res, q.String(), args...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestAuthorListsPage(t *testing.T) {
+	testDB(t)
+	testUser(t, "prolific")
+	testUser(t, "someone")
+	testForum(t, "first", "someone")
+	testForum(t, "second", "someone")
+
+	// created at the same time, so the id orders them
+	created := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	threads := []int{}
+	for k := 0; k < 5; k++ {
+		forum := "first"
+		if k%2 == 1 {
+			forum = "second"
+		}
+		th, err := CreateThread(&models.Thread{Forum: forum, ThreadTitle: "t", ThreadAuthor: "prolific",
+			ThreadMessage: "m", ThreadCreated: &created})
+		if err != nil {
+			t.Fatal(err)
+		}
+		threads = append(threads, th.ThreadID)
+	}
+	testThread(t, "first", "someone")
+	posts := []int{}
+	for _, th := range threads[:2] {
+		batch := models.PostList{{PostAuthor: "prolific", PostMessage: "1"}, {PostAuthor: "someone", PostMessage: "2"},
+			{PostAuthor: "prolific", PostMessage: "3"}}
+		res, err := CreatePosts(&batch, strconv.Itoa(th))
+		if err != nil {
+			t.Fatal(err)
+		}
+		posts = append(posts, (*res)[0].PostID, (*res)[2].PostID)
+	}
+	if _, err := db.Exec("UPDATE post SET post_created = $1", created); err != nil {
+		t.Fatal(err)
+	}
+
+	threadPage := func(params *models.AuthorQueryParams) ([]int, time.Time, int) {
+		list, err := GetUserThreads("PROLIFIC", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int{}
+		for _, th := range *list {
+			ids = append(ids, th.ThreadID)
+		}
+		if len(ids) == 0 {
+			return ids, time.Time{}, 0
+		}
+		last := (*list)[len(*list)-1]
+		return ids, *last.ThreadCreated, last.ThreadID
+	}
+	postPage := func(params *models.AuthorQueryParams) ([]int, time.Time, int) {
+		list, err := GetUserPosts("prolific", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int{}
+		for _, p := range *list {
+			ids = append(ids, p.PostID)
+		}
+		if len(ids) == 0 {
+			return ids, time.Time{}, 0
+		}
+		last := (*list)[len(*list)-1]
+		return ids, last.PostCreated, last.PostID
+	}
+
+	for _, list := range []struct {
+		name string
+		page func(*models.AuthorQueryParams) ([]int, time.Time, int)
+		want []int
+	}{
+		{"threads", threadPage, threads},
+		{"posts", postPage, posts},
+	} {
+		for _, desc := range []bool{false, true} {
+			want := list.want
+			if desc {
+				want = reversed(want)
+			}
+			got := []int{}
+			params := &models.AuthorQueryParams{ThreadQueryParams: models.ThreadQueryParams{Desc: desc, Limit: 2}}
+			for len(got) <= len(want) {
+				ids, since, sinceID := list.page(params)
+				got = append(got, ids...)
+				if len(ids) < 2 {
+					break
+				}
+				params.Since, params.SinceID = since, sinceID
+			}
+			if !equalIDs(got, want) {
+				t.Errorf("%s, desc %v: got %v, want %v", list.name, desc, got, want)
+			}
+
+			// without an id the time of since is included
+			params = &models.AuthorQueryParams{ThreadQueryParams: models.ThreadQueryParams{Desc: desc, Since: created}}
+			if ids, _, _ := list.page(params); !equalIDs(ids, want) {
+				t.Errorf("%s, desc %v, since %v: got %v, want %v", list.name, desc, created, ids, want)
+			}
+			params.Since = created.Add(time.Second)
+			if desc {
+				params.Since = created.Add(-time.Second)
+			}
+			if ids, _, _ := list.page(params); len(ids) != 0 {
+				t.Errorf("%s, desc %v, since %v: got %v, want none", list.name, desc, params.Since, ids)
+			}
+		}
+	}
+
+	params := &models.AuthorQueryParams{Forum: "second"}
+	if ids, _, _ := threadPage(params); !equalIDs(ids, []int{threads[1], threads[3]}) {
+		t.Errorf("got threads %v in the second forum, want %v", ids, []int{threads[1], threads[3]})
+	}
+	if ids, _, _ := postPage(params); !equalIDs(ids, posts[2:]) {
+		t.Errorf("got posts %v in the second forum, want %v", ids, posts[2:])
+	}
+}
+
+func reversed(ids []int) []int {
+	res := make([]int, len(ids))
+	for k, id := range ids {
+		res[len(ids)-1-k] = id
+	}
+	return res
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package queries
+
+import (
+	"database/sql"
+	"log"
+	"mime"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/storage"
+)
+
+// Avatars are images kept like attachments, the profile refers to the
+// blob. Replaced avatars are left to the collector.
+
+// SetUserAvatar makes the image of u the avatar of the user.
+func SetUserAvatar(n string, u *Upload) (*models.ForumUser, error) {
+	if blobs == nil {
+		return nil, ErrAttachmentsDisabled
+	}
+	mediaType, _, _ := mime.ParseMediaType(u.contentType)
+	if _, _, err := storage.ImageSize(u.reader(), mediaType); err != nil {
+		return nil, ErrAttachmentType
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	b, err := storeBlob(tx, u)
+	if err != nil {
+		return nil, err
+	}
+	return updateAvatar(tx, n, &b.Hash)
+}
+
+// DeleteUserAvatar leaves the user without an avatar.
+func DeleteUserAvatar(n string) (*models.ForumUser, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return updateAvatar(tx, n, nil)
+}
+
+func updateAvatar(tx *sqlx.Tx, n string, hash *string) (*models.ForumUser, error) {
+	// the old avatar gets the grace period of detached files
+	_, err := tx.Exec(`UPDATE blob SET used = now()
+		WHERE hash = (SELECT avatar FROM forum_user WHERE nickname = $1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	res := &models.ForumUser{}
+	err = tx.Get(res, "UPDATE forum_user SET avatar = $1 WHERE nickname = $2 RETURNING *", hash, n)
+	if err == nil {
+		err = recordChanges(tx, models.EventUserUpdated, "", 0, change{userRecord(res.Nickname), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	userCache.Delete(cacheKey(n))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &RecordNotFoundError{"User", n}
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// OpenUserAvatar returns the avatar of the user with its image, or its
+// thumbnail if thumbnail is set.
+func OpenUserAvatar(n string, thumbnail bool) (*models.Attachment, storage.File, error) {
+	if blobs == nil {
+		return nil, nil, ErrAttachmentsDisabled
+	}
+	res := &models.Attachment{}
+	err := onReplica(func(q *sqlx.DB) error {
+		return q.Get(res, `SELECT b.hash, b.content_type, b.size, b.width, b.height,
+			COALESCE(b.thumbnail_type, '') thumbnail_type
+			FROM forum_user u JOIN blob b ON b.hash = u.avatar
+			WHERE u.nickname = $1`, n)
+	})
+	if err == sql.ErrNoRows || err == nil && thumbnail && res.ThumbnailType == "" {
+		return nil, nil, &RecordNotFoundError{"Avatar", n}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key := res.Hash
+	if thumbnail {
+		key = thumbnailKey(res.Hash)
+	}
+	f, err := blobs.Open(key)
+	if err == storage.ErrNotExist {
+		log.Printf("avatars: file %v of %v is missing\n", key, n)
+		return nil, nil, &RecordNotFoundError{"Avatar", n}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, f, nil
+}
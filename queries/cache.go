@@ -0,0 +1,137 @@
+package queries
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/cache"
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// Read-through caches of the records every request looks up. Values are
+// deep copies both ways, so callers are free to modify what they get and
+// what they have cached, slices and pointers included. Every write path
+// invalidates what it changes, writes from other processes are only
+// seen after the TTL of the cache.
+var (
+	threadCache     cache.Cache = cache.Nop{} // by id
+	threadSlugCache cache.Cache = cache.Nop{} // slug to id, misses are not kept
+	forumCache      cache.Cache = cache.Nop{}
+	userCache       cache.Cache = cache.Nop{}
+	htmlCache       cache.Cache = cache.Nop{} // rendered messages by their text, never stale
+)
+
+// UseCache enables caching, newCache is called once for every cache.
+func UseCache(newCache func(name string) cache.Cache) {
+	threadCache = newCache("thread")
+	threadSlugCache = newCache("thread_slug")
+	forumCache = newCache("forum")
+	userCache = newCache("user")
+	htmlCache = newCache("html")
+}
+
+func purgeCaches() {
+	threadCache.Purge()
+	threadSlugCache.Purge()
+	forumCache.Purge()
+	userCache.Purge()
+}
+
+// nicknames and slugs are case insensitive
+func cacheKey(s string) string {
+	return strings.ToLower(s)
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	res := *s
+	return &res
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	res := *t
+	return &res
+}
+
+func copyThread(t *models.Thread) *models.Thread {
+	res := *t
+	res.ThreadSlug = copyString(t.ThreadSlug)
+	res.ThreadCreated = copyTime(t.ThreadCreated)
+	if t.Tags != nil {
+		res.Tags = append(make(pq.StringArray, 0, len(t.Tags)), t.Tags...)
+	}
+	return &res
+}
+
+func copyForum(f *models.Forum) *models.Forum {
+	res := *f
+	res.Parent = copyString(f.Parent)
+	res.Category = copyString(f.Category)
+	return &res
+}
+
+func copyUser(u *models.ForumUser) *models.ForumUser {
+	res := *u
+	res.Avatar = copyString(u.Avatar)
+	res.Joined = copyTime(u.Joined)
+	res.LastSeen = copyTime(u.LastSeen)
+	return &res
+}
+
+func cachedThread(id int) (*models.Thread, bool) {
+	v, ok := threadCache.Get(strconv.Itoa(id))
+	if !ok {
+		return nil, false
+	}
+	return copyThread(v.(*models.Thread)), true
+}
+
+func cacheThread(t *models.Thread) {
+	threadCache.Set(strconv.Itoa(t.ThreadID), copyThread(t))
+	if t.ThreadSlug != nil {
+		threadSlugCache.Set(cacheKey(*t.ThreadSlug), t.ThreadID)
+	}
+}
+
+func forgetThread(id int) {
+	threadCache.Delete(strconv.Itoa(id))
+}
+
+// forgetUser drops a user after writes that may have moved last_seen:
+// user_seen of the migrations updates it for new threads, posts and votes,
+// at most once a minute.
+func forgetUser(nickname string) {
+	userCache.Delete(cacheKey(nickname))
+}
+
+func cachedForum(slug string) (*models.Forum, bool) {
+	v, ok := forumCache.Get(cacheKey(slug))
+	if !ok {
+		return nil, false
+	}
+	return copyForum(v.(*models.Forum)), true
+}
+
+func cacheForum(f *models.Forum) {
+	forumCache.Set(cacheKey(f.ForumSlug), copyForum(f))
+}
+
+func cachedUser(nickname string) (*models.ForumUser, bool) {
+	v, ok := userCache.Get(cacheKey(nickname))
+	if !ok {
+		return nil, false
+	}
+	return copyUser(v.(*models.ForumUser)), true
+}
+
+func cacheUser(u *models.ForumUser) {
+	userCache.Set(cacheKey(u.Nickname), copyUser(u))
+}
@@ -0,0 +1,175 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/cache"
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func useTestCache(t *testing.T) {
+	UseCache(func(name string) cache.Cache {
+		return cache.NewLRU(name, 100, time.Hour)
+	})
+	t.Cleanup(func() {
+		UseCache(func(string) cache.Cache { return cache.Nop{} })
+	})
+}
+
+func TestCachedValuesAreCopies(t *testing.T) {
+	useTestCache(t)
+	slug, parent, avatar := "slug", "parent", "hash"
+	want := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	created, seen := want, want
+
+	th := &models.Thread{ThreadID: 1, ThreadSlug: &slug, ThreadCreated: &created, Tags: pq.StringArray{"go"}}
+	cacheThread(th)
+	*th.ThreadSlug, th.Tags[0], *th.ThreadCreated = "changed", "changed", time.Time{}
+	got, _ := cachedThread(1)
+	*got.ThreadSlug, got.Tags[0], *got.ThreadCreated = "changed", "changed", time.Time{}
+	got, _ = cachedThread(1)
+	if *got.ThreadSlug != "slug" || got.Tags[0] != "go" || !got.ThreadCreated.Equal(want) {
+		t.Errorf("cached thread was modified: %+v", got)
+	}
+
+	f := &models.Forum{ForumSlug: "forum", Parent: &parent}
+	cacheForum(f)
+	*f.Parent = "changed"
+	gotForum, _ := cachedForum("FORUM")
+	*gotForum.Parent = "changed"
+	gotForum, _ = cachedForum("forum")
+	if *gotForum.Parent != "parent" {
+		t.Errorf("cached forum was modified: %+v", gotForum)
+	}
+
+	u := &models.ForumUser{Nickname: "user", Avatar: &avatar, LastSeen: &seen}
+	cacheUser(u)
+	*u.Avatar, *u.LastSeen = "changed", time.Time{}
+	gotUser, _ := cachedUser("User")
+	*gotUser.Avatar, *gotUser.LastSeen = "changed", time.Time{}
+	gotUser, _ = cachedUser("user")
+	if *gotUser.Avatar != "hash" || !gotUser.LastSeen.Equal(want) {
+		t.Errorf("cached user was modified: %+v", gotUser)
+	}
+}
+
+func TestReadAfterWriteIsNotStale(t *testing.T) {
+	testDB(t)
+	useTestCache(t)
+	testUser(t, "reader")
+	testForum(t, "cached", "reader")
+	th := testThread(t, "cached", "reader")
+	id := strconv.Itoa(th.ThreadID)
+
+	// every read fills the cache before the write
+	if _, err := GetThreadBySlugOrID(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateThread(&models.Thread{ThreadTitle: "renamed"}, id); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetThreadBySlugOrID(id); err != nil || got.ThreadTitle != "renamed" {
+		t.Errorf("got thread %+v, %v after the update", got, err)
+	}
+
+	if _, err := VoteForPost(&models.Vote{Nickname: "reader", Voice: 1}, id); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetThreadByID(th.ThreadID); err != nil || got.Votes != 1 {
+		t.Errorf("got thread %+v, %v after the vote", got, err)
+	}
+
+	if _, err := GetForumBySlug("cached"); err != nil {
+		t.Fatal(err)
+	}
+	testThread(t, "cached", "reader")
+	if got, err := GetForumBySlug("cached"); err != nil || got.Threads != 2 {
+		t.Errorf("got forum %+v, %v after a new thread", got, err)
+	}
+	if _, err := UpdateForum("cached", &models.ForumUpdate{Title: "Cached"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetForumBySlug("cached"); err != nil || got.ForumTitle != "Cached" {
+		t.Errorf("got forum %+v, %v after the update", got, err)
+	}
+
+	if _, err := GetUserByNickname("reader"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateUser("reader", &models.ForumUser{About: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetUserByNickname("reader"); err != nil || got.About != "updated" {
+		t.Errorf("got user %+v, %v after the update", got, err)
+	}
+}
+
+func TestLastSeenIsNotStale(t *testing.T) {
+	testDB(t)
+	useTestCache(t)
+	for _, n := range []string{"author", "poster", "voter"} {
+		testUser(t, n)
+	}
+	testForum(t, "seen", "author")
+
+	unseen := func(n string) {
+		t.Helper()
+		if u, err := GetUserByNickname(n); err != nil || u.LastSeen != nil {
+			t.Fatalf("got user %+v, %v before any writes", u, err)
+		}
+	}
+	seen := func(n, after string) {
+		t.Helper()
+		if u, err := GetUserByNickname(n); err != nil || u.LastSeen == nil {
+			t.Errorf("got user %+v, %v after %s", u, err, after)
+		}
+	}
+
+	unseen("author")
+	th := testThread(t, "seen", "author")
+	seen("author", "a new thread")
+
+	unseen("poster")
+	_, err := CreatePosts(&models.PostList{{PostAuthor: "poster", PostMessage: "seen"}}, strconv.Itoa(th.ThreadID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen("poster", "a new post")
+
+	unseen("voter")
+	if _, err = VoteForPost(&models.Vote{Nickname: "voter", Voice: 1}, strconv.Itoa(th.ThreadID)); err != nil {
+		t.Fatal(err)
+	}
+	seen("voter", "a vote")
+}
+
+func TestMissingSlugIsNotCached(t *testing.T) {
+	testDB(t)
+	useTestCache(t)
+	testUser(t, "elsewhere")
+	testForum(t, "elsewhere", "elsewhere")
+
+	if _, err := GetThreadBySlug("late"); err == nil {
+		t.Fatal("found a thread that is not there yet")
+	}
+	if _, err := GetThreadIDBySlug("late"); err == nil {
+		t.Fatal("found a thread id that is not there yet")
+	}
+	// created by another process, so nothing here invalidates the caches
+	_, err := db.Exec(`INSERT INTO thread (forum, thread_slug, thread_title, thread_author, thread_message)
+		VALUES ('elsewhere', 'late', 'title', 'elsewhere', 'message')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := GetThreadIDBySlug("LATE"); err != nil || id == 0 {
+		t.Errorf("got thread id %d, %v after it was created", id, err)
+	}
+	threadSlugCache.Purge()
+	if got, err := GetThreadBySlug("late"); err != nil || got.ThreadTitle != "title" {
+		t.Errorf("got thread %+v, %v after it was created", got, err)
+	}
+}
@@ -0,0 +1,138 @@
+package queries
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func CreateCategory(c *models.Category) (*models.Category, error) {
+	if c.CategorySlug == "" || c.CategoryTitle == "" {
+		return nil, &NullFieldError{"Category", "slug and/or title"}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &models.Category{}
+	err = tx.Get(res, `INSERT INTO category (category_slug, category_title, position)
+		VALUES ($1, $2, $3) RETURNING *`, c.CategorySlug, c.CategoryTitle, c.Position)
+	if err == nil {
+		err = recordChanges(tx, models.EventCategoryCreated, "", 0, change{categoryRecord(res.CategorySlug), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == UniqueViolationCode {
+			res, err := GetCategory(c.CategorySlug)
+			if err != nil {
+				return res, err
+			}
+			return res, &UniqueFieldValueAlreadyExistsError{"Category", "slug"}
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetCategory returns the category with its forums, sub-forums nested in
+// them.
+func GetCategory(s string) (*models.Category, error) {
+	var res *models.Category
+	err := onReplica(func(conn *sqlx.DB) error {
+		var err error
+		res, err = getCategory(conn, s)
+		return err
+	})
+	return res, err
+}
+
+func getCategory(q sqlx.Queryer, s string) (*models.Category, error) {
+	res := &models.Category{}
+	err := sqlx.Get(q, res, "SELECT * FROM category WHERE category_slug = $1", s)
+	if err == sql.ErrNoRows {
+		return nil, &RecordNotFoundError{"Category", s}
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = sqlx.Select(q, &res.Forums, `WITH RECURSIVE page AS (
+			SELECT * FROM forum WHERE category = $1
+			UNION ALL
+			SELECT f.* FROM page p JOIN forum f ON f.forum_parent = p.forum_slug
+		)`+forumNodes+"ORDER BY p.position, p.forum_slug", res.CategorySlug)
+	if err != nil {
+		return nil, err
+	}
+	res.Forums = nestForums(res.Forums)
+	for _, f := range res.Forums {
+		res.Threads += f.TotalThreads
+		res.Posts += f.TotalPosts
+	}
+	return res, nil
+}
+
+// GetCategories returns all categories in order, without their forums.
+func GetCategories() (*models.CategoryList, error) {
+	res := &models.CategoryList{}
+	err := onReplica(func(conn *sqlx.DB) error {
+		return conn.Select(res, `
+			WITH RECURSIVE tree AS (
+				SELECT category, forum_slug FROM forum WHERE category IS NOT NULL
+				UNION ALL
+				SELECT t.category, f.forum_slug FROM tree t JOIN forum f ON f.forum_parent = t.forum_slug
+			)
+			SELECT c.*, COALESCE(SUM(f.threads), 0) threads, COALESCE(SUM(f.posts), 0) posts
+			FROM category c
+			LEFT JOIN tree t ON t.category = c.category_slug
+			LEFT JOIN forum f ON f.forum_slug = t.forum_slug
+			GROUP BY c.category_slug
+			ORDER BY c.position, c.category_slug`)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func UpdateCategory(s string, u *models.CategoryUpdate) (*models.Category, error) {
+	if u.Title == "" && u.Position == nil {
+		return GetCategory(s)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	slug := ""
+	err = tx.Get(&slug, `UPDATE category SET
+		category_title = COALESCE(NULLIF($2, ''), category_title),
+		position = COALESCE($3, position)
+		WHERE category_slug = $1 RETURNING category_slug`, s, u.Title, u.Position)
+	if err == sql.ErrNoRows {
+		return nil, &RecordNotFoundError{"Category", s}
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := getCategory(tx, slug)
+	if err == nil {
+		err = recordChanges(tx, models.EventCategoryUpdated, "", 0, change{categoryRecord(res.CategorySlug), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
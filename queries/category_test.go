@@ -0,0 +1,109 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestCountersRollUpAfterMoves(t *testing.T) {
+	testDB(t)
+	testUser(t, "mover")
+	for _, slug := range []string{"left", "right"} {
+		if _, err := CreateCategory(&models.Category{CategorySlug: slug, CategoryTitle: slug}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	left, top, sub := "left", "top", "sub"
+	for _, f := range []models.Forum{
+		{ForumSlug: "top", Category: &left},
+		{ForumSlug: "sub", Parent: &top},
+		{ForumSlug: "leaf", Parent: &sub},
+	} {
+		f.ForumTitle, f.ForumUser = f.ForumSlug, "mover"
+		if _, err := CreateForum(&f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a thread with a post in every forum under top
+	for _, forum := range []string{"sub", "leaf"} {
+		th := testThread(t, forum, "mover")
+		posts := models.PostList{{PostAuthor: "mover", PostMessage: "m"}}
+		if _, err := CreatePosts(&posts, strconv.Itoa(th.ThreadID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(when string, want map[string]int) {
+		t.Helper()
+		list, err := GetCategories()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range *list {
+			if c.Threads != want[c.CategorySlug] || c.Posts != want[c.CategorySlug] {
+				t.Errorf("%s: got %d threads and %d posts in %s, want %d", when, c.Threads, c.Posts,
+					c.CategorySlug, want[c.CategorySlug])
+			}
+			got, err := GetCategory(c.CategorySlug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total := 0
+			for _, f := range got.Forums {
+				total += f.TotalThreads
+			}
+			if got.Threads != want[c.CategorySlug] || total != want[c.CategorySlug] {
+				t.Errorf("%s: got category %+v, want %d threads", when, got, want[c.CategorySlug])
+			}
+		}
+	}
+	check("before the move", map[string]int{"left": 2, "right": 0})
+
+	right, none := "right", ""
+	if _, err := UpdateForum("sub", &models.ForumUpdate{Category: &right}); err != nil {
+		t.Fatal(err)
+	}
+	check("after sub moved to the right", map[string]int{"left": 0, "right": 2})
+	if _, err := UpdateForum("leaf", &models.ForumUpdate{Parent: &top}); err != nil {
+		t.Fatal(err)
+	}
+	check("after leaf moved under top", map[string]int{"left": 1, "right": 1})
+	if _, err := UpdateForum("top", &models.ForumUpdate{Category: &none}); err != nil {
+		t.Fatal(err)
+	}
+	check("after top left its category", map[string]int{"left": 0, "right": 1})
+}
+
+func TestForumMovesRejectCycles(t *testing.T) {
+	testDB(t)
+	testUser(t, "mover")
+	top, sub := "top", "sub"
+	for _, f := range []models.Forum{
+		{ForumSlug: "top"},
+		{ForumSlug: "sub", Parent: &top},
+		{ForumSlug: "leaf", Parent: &sub},
+	} {
+		f.ForumTitle, f.ForumUser = f.ForumSlug, "mover"
+		if _, err := CreateForum(&f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, move := range []struct{ forum, parent string }{
+		{"top", "top"},
+		{"top", "leaf"},
+		{"sub", "LEAF"},
+	} {
+		parent := move.parent
+		_, err := UpdateForum(move.forum, &models.ForumUpdate{Parent: &parent})
+		if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("moving %s under %s: got %v, want a validation error", move.forum, move.parent, err)
+		}
+	}
+	f, err := GetForumBySlug("sub")
+	if err != nil || f.Parent == nil || *f.Parent != "top" {
+		t.Errorf("got forum %+v, %v after the rejected moves", f, err)
+	}
+}
@@ -2,6 +2,8 @@ package queries
 
 import (
 	"log"
+	"net/url"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 
@@ -10,10 +12,40 @@ import (
 
 var db *sqlx.DB
 
-func InitDB(address, database string) *sqlx.DB {
+// timezone is the session timezone of every connection. Timestamps are
+// scanned in this location, so it is the one the API serializes them in
+// whatever the settings of the database or the server are.
+var timezone = "UTC"
+
+// SetTimezone changes the timezone of connections opened afterwards, name
+// is an IANA timezone name.
+func SetTimezone(name string) error {
+	if _, err := time.LoadLocation(name); err != nil {
+		return err
+	}
+	timezone = name
+	return nil
+}
+
+// Startup migration modes.
+const (
+	MigrateStrict = "strict" // refuse to start if migrations fail
+	MigrateLog    = "log"    // log the failure and serve anyway
+	MigrateOff    = "off"    // leave the schema alone
+)
+
+func InitDB(address, database, migrateMode string) *sqlx.DB {
+	ConnectDB(address, database)
+
+	makeMigrations(migrateMode)
+
+	return db
+}
+
+// ConnectDB opens the connection without touching the schema.
+func ConnectDB(address, database string) *sqlx.DB {
 	var err error
-	db, err = sqlx.Open("postgres",
-		"postgres://"+address+"/"+database+"?sslmode=disable")
+	db, err = sqlx.Open("postgres", dataSourceName(address, database))
 	if err != nil {
 		log.Panic(err)
 	}
@@ -24,7 +56,9 @@ func InitDB(address, database string) *sqlx.DB {
 
 	log.Printf("Successfully connected to %v, database %v\n", address, database)
 
-	makeMigrations(db)
-
 	return db
 }
+
+func dataSourceName(address, database string) string {
+	return "postgres://" + address + "/" + url.PathEscape(database) + "?sslmode=disable&timezone=" + url.QueryEscape(timezone)
+}
@@ -0,0 +1,804 @@
+package queries
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// Dumps are NDJSON, one models.DumpRecord per line. Records are grouped by
+// type in dumpOrder, so references always point to earlier lines: parent
+// forums and posts come before their children.
+var dumpOrder = []string{
+	models.DumpTypeUser,
+	models.DumpTypeCategory,
+	models.DumpTypeForum,
+	models.DumpTypeThread,
+	models.DumpTypePost,
+	models.DumpTypeVote,
+}
+
+const (
+	maxDumpLine   = 64 << 20
+	maxDumpErrors = 100
+)
+
+type ImportOptions struct {
+	RemapIDs bool // give threads and posts new ids instead of the dumped ones
+	DryRun   bool // load everything, then roll back
+}
+
+// ExportDump writes the whole database to w from a single snapshot.
+func ExportDump(w io.Writer) error {
+	tx, err := db.BeginTxx(context.Background(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bw := bufio.NewWriter(w)
+	tables := []struct {
+		typ   string
+		query string
+		row   json.Marshaler
+	}{
+		{models.DumpTypeUser, "SELECT * FROM forum_user ORDER BY nickname", &models.ForumUser{}},
+		{models.DumpTypeCategory, "SELECT * FROM category ORDER BY category_slug", &models.Category{}},
+		{models.DumpTypeForum, `WITH RECURSIVE tree AS (
+				SELECT forum_slug, 0 depth FROM forum WHERE forum_parent IS NULL
+				UNION ALL
+				SELECT f.forum_slug, t.depth + 1 FROM tree t JOIN forum f ON f.forum_parent = t.forum_slug
+			)
+			SELECT f.* FROM forum f JOIN tree t USING (forum_slug) ORDER BY t.depth, f.forum_slug`, &models.Forum{}},
+		{models.DumpTypeThread, "SELECT * FROM thread ORDER BY thread_id", &models.Thread{}},
+		{models.DumpTypePost, `SELECT post_id, forum, thread, parent, post_author, post_created, is_edited, post_message
+			FROM post ORDER BY thread, path`, &models.Post{}},
+		{models.DumpTypeVote, "SELECT nickname, thread, voice FROM vote ORDER BY thread, nickname", &models.DumpVote{}},
+	}
+	for _, t := range tables {
+		err = exportTable(tx, bw, t.typ, t.query, t.row)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func exportTable(tx *sqlx.Tx, w *bufio.Writer, typ, query string, row json.Marshaler) error {
+	rows, err := tx.Queryx(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = rows.StructScan(row)
+		if err != nil {
+			return err
+		}
+		data, err := row.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		line, err := models.DumpRecord{Type: typ, Data: data}.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	return rows.Err()
+}
+
+type dumpUser struct {
+	line int
+	models.ForumUser
+	exists bool
+}
+
+type dumpCategory struct {
+	line int
+	models.Category
+}
+
+type dumpForum struct {
+	line int
+	models.Forum
+}
+
+type dumpThread struct {
+	line int
+	models.Thread
+	newID int
+}
+
+type dumpPost struct {
+	line int
+	models.Post
+}
+
+type dumpVote struct {
+	line int
+	models.DumpVote
+}
+
+// dump is a parsed dump. Nicknames and slugs are citext in the database,
+// so the maps are keyed by lower case.
+type dump struct {
+	users      []*dumpUser
+	categories []*dumpCategory
+	forums     []*dumpForum
+	threads    []*dumpThread
+	posts      []*dumpPost
+	votes      []*dumpVote
+
+	userByNickname map[string]*dumpUser
+	userByEmail    map[string]*dumpUser
+	categoryBySlug map[string]*dumpCategory
+	forumBySlug    map[string]*dumpForum
+	threadByID     map[int]*dumpThread
+	threadBySlug   map[string]*dumpThread
+	postByID       map[int]*dumpPost
+	voteSeen       map[string]bool
+
+	// references to records that are not in the dump, by the first line
+	// they are used on
+	extUsers      map[string]int
+	extCategories map[string]int
+	extForums     map[string]int
+
+	errs []DumpLineError
+}
+
+func (d *dump) fail(line int, format string, args ...interface{}) {
+	d.errs = append(d.errs, DumpLineError{line, fmt.Sprintf(format, args...)})
+}
+
+func (d *dump) err() error {
+	if len(d.errs) == 0 {
+		return nil
+	}
+	return &DumpError{d.errs}
+}
+
+func readDump(r io.Reader) (*dump, error) {
+	d := &dump{
+		userByNickname: map[string]*dumpUser{},
+		userByEmail:    map[string]*dumpUser{},
+		categoryBySlug: map[string]*dumpCategory{},
+		forumBySlug:    map[string]*dumpForum{},
+		threadByID:     map[int]*dumpThread{},
+		threadBySlug:   map[string]*dumpThread{},
+		postByID:       map[int]*dumpPost{},
+		voteSeen:       map[string]bool{},
+		extUsers:       map[string]int{},
+		extCategories:  map[string]int{},
+		extForums:      map[string]int{},
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), maxDumpLine)
+	stage, line := 0, 0
+	for sc.Scan() && len(d.errs) < maxDumpErrors {
+		line++
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		rec := models.DumpRecord{}
+		err := rec.UnmarshalJSON(b)
+		if err != nil {
+			d.fail(line, "%v", err)
+			continue
+		}
+		n := 0
+		for n < len(dumpOrder) && dumpOrder[n] != rec.Type {
+			n++
+		}
+		if n == len(dumpOrder) {
+			d.fail(line, "unknown record type %q", rec.Type)
+			continue
+		}
+		if n < stage {
+			d.fail(line, "%s record after %s records", rec.Type, dumpOrder[stage])
+			continue
+		}
+		stage = n
+
+		switch rec.Type {
+		case models.DumpTypeUser:
+			u := &dumpUser{line: line}
+			err = u.UnmarshalJSON(rec.Data)
+			if err == nil {
+				d.addUser(u)
+			}
+		case models.DumpTypeCategory:
+			c := &dumpCategory{line: line}
+			err = c.UnmarshalJSON(rec.Data)
+			if err == nil {
+				d.addCategory(c)
+			}
+		case models.DumpTypeForum:
+			f := &dumpForum{line: line}
+			err = f.UnmarshalJSON(rec.Data)
+			if err == nil {
+				d.addForum(f)
+			}
+		case models.DumpTypeThread:
+			t := &dumpThread{line: line}
+			err = t.UnmarshalJSON(rec.Data)
+			if err == nil {
+				d.addThread(t)
+			}
+		case models.DumpTypePost:
+			p := &dumpPost{line: line}
+			err = p.UnmarshalJSON(rec.Data)
+			if err == nil {
+				d.addPost(p)
+			}
+		case models.DumpTypeVote:
+			v := &dumpVote{line: line}
+			err = v.UnmarshalJSON(rec.Data)
+			if err == nil {
+				d.addVote(v)
+			}
+		}
+		if err != nil {
+			d.fail(line, "%s: %v", rec.Type, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		d.fail(line+1, "%v", err)
+	}
+	return d, d.err()
+}
+
+// refUser resolves a nickname to the dumped user or remembers it has to
+// be found in the database.
+func (d *dump) refUser(line int, nickname string) string {
+	key := strings.ToLower(nickname)
+	if u, ok := d.userByNickname[key]; ok {
+		return u.Nickname
+	}
+	if _, ok := d.extUsers[key]; !ok {
+		d.extUsers[key] = line
+	}
+	return nickname
+}
+
+func (d *dump) refCategory(line int, slug string) string {
+	key := strings.ToLower(slug)
+	if c, ok := d.categoryBySlug[key]; ok {
+		return c.CategorySlug
+	}
+	if _, ok := d.extCategories[key]; !ok {
+		d.extCategories[key] = line
+	}
+	return slug
+}
+
+func (d *dump) refForum(line int, slug string) string {
+	key := strings.ToLower(slug)
+	if f, ok := d.forumBySlug[key]; ok {
+		return f.ForumSlug
+	}
+	if _, ok := d.extForums[key]; !ok {
+		d.extForums[key] = line
+	}
+	return slug
+}
+
+func (d *dump) addUser(u *dumpUser) {
+	switch {
+	case u.Nickname == "":
+		d.fail(u.line, "user: nickname is empty")
+	case u.Fullname == "":
+		d.fail(u.line, "user: fullname is empty")
+	case u.Email == "":
+		d.fail(u.line, "user: email is empty")
+	case d.userByNickname[strings.ToLower(u.Nickname)] != nil:
+		d.fail(u.line, "user: nickname %q is already on line %d",
+			u.Nickname, d.userByNickname[strings.ToLower(u.Nickname)].line)
+	case d.userByEmail[strings.ToLower(u.Email)] != nil:
+		d.fail(u.line, "user: email %q is already on line %d",
+			u.Email, d.userByEmail[strings.ToLower(u.Email)].line)
+	default:
+		d.users = append(d.users, u)
+		d.userByNickname[strings.ToLower(u.Nickname)] = u
+		d.userByEmail[strings.ToLower(u.Email)] = u
+	}
+}
+
+func (d *dump) addCategory(c *dumpCategory) {
+	switch {
+	case c.CategorySlug == "":
+		d.fail(c.line, "category: slug is empty")
+	case c.CategoryTitle == "":
+		d.fail(c.line, "category: title is empty")
+	case d.categoryBySlug[strings.ToLower(c.CategorySlug)] != nil:
+		d.fail(c.line, "category: slug %q is already on line %d",
+			c.CategorySlug, d.categoryBySlug[strings.ToLower(c.CategorySlug)].line)
+	default:
+		d.categories = append(d.categories, c)
+		d.categoryBySlug[strings.ToLower(c.CategorySlug)] = c
+	}
+}
+
+func (d *dump) addForum(f *dumpForum) {
+	if f.Parent != nil && *f.Parent == "" {
+		f.Parent = nil
+	}
+	if f.Category != nil && *f.Category == "" {
+		f.Category = nil
+	}
+	switch {
+	case f.ForumSlug == "":
+		d.fail(f.line, "forum: slug is empty")
+	case f.ForumTitle == "":
+		d.fail(f.line, "forum: title is empty")
+	case f.ForumUser == "":
+		d.fail(f.line, "forum: user is empty")
+	case d.forumBySlug[strings.ToLower(f.ForumSlug)] != nil:
+		d.fail(f.line, "forum: slug %q is already on line %d",
+			f.ForumSlug, d.forumBySlug[strings.ToLower(f.ForumSlug)].line)
+	case f.Parent != nil && f.Category != nil:
+		d.fail(f.line, "forum: a sub-forum can't have a category")
+	default:
+		f.ForumUser = d.refUser(f.line, f.ForumUser)
+		// a parent later in the dump, or the forum itself, is looked for in
+		// the database and not found there, so the forums make no cycle
+		if f.Parent != nil {
+			parent := d.refForum(f.line, *f.Parent)
+			f.Parent = &parent
+		}
+		if f.Category != nil {
+			category := d.refCategory(f.line, *f.Category)
+			f.Category = &category
+		}
+		d.forums = append(d.forums, f)
+		d.forumBySlug[strings.ToLower(f.ForumSlug)] = f
+	}
+}
+
+func (d *dump) addThread(t *dumpThread) {
+	tags, tagsErr := normalizeTags(t.Tags)
+	switch {
+	case t.ThreadID <= 0:
+		d.fail(t.line, "thread: id must be positive")
+	case t.Forum == "":
+		d.fail(t.line, "thread: forum is empty")
+	case t.ThreadTitle == "":
+		d.fail(t.line, "thread: title is empty")
+	case t.ThreadAuthor == "":
+		d.fail(t.line, "thread: author is empty")
+	case t.ThreadMessage == "":
+		d.fail(t.line, "thread: message is empty")
+	case d.threadByID[t.ThreadID] != nil:
+		d.fail(t.line, "thread: id %d is already on line %d", t.ThreadID, d.threadByID[t.ThreadID].line)
+	case t.ThreadSlug != nil && d.threadBySlug[strings.ToLower(*t.ThreadSlug)] != nil:
+		d.fail(t.line, "thread: slug %q is already on line %d",
+			*t.ThreadSlug, d.threadBySlug[strings.ToLower(*t.ThreadSlug)].line)
+	case tagsErr != nil:
+		d.fail(t.line, "thread: more than %d tags or a tag is not a word of up to %d letters", maxThreadTags, maxTagLength)
+	default:
+		t.Tags = tags
+		t.Forum = d.refForum(t.line, t.Forum)
+		t.ThreadAuthor = d.refUser(t.line, t.ThreadAuthor)
+		t.newID = t.ThreadID
+		d.threads = append(d.threads, t)
+		d.threadByID[t.ThreadID] = t
+		if t.ThreadSlug != nil {
+			d.threadBySlug[strings.ToLower(*t.ThreadSlug)] = t
+		}
+	}
+}
+
+func (d *dump) addPost(p *dumpPost) {
+	t := d.threadByID[p.Thread]
+	parent := d.postByID[p.Parent]
+	switch {
+	case p.PostID <= 0:
+		d.fail(p.line, "post: id must be positive")
+	case p.PostAuthor == "":
+		d.fail(p.line, "post: author is empty")
+	case p.PostMessage == "":
+		d.fail(p.line, "post: message is empty")
+	case d.postByID[p.PostID] != nil:
+		d.fail(p.line, "post: id %d is already on line %d", p.PostID, d.postByID[p.PostID].line)
+	case t == nil:
+		d.fail(p.line, "post: thread %d is not in the dump", p.Thread)
+	case p.Forum != "" && !strings.EqualFold(p.Forum, t.Forum):
+		d.fail(p.line, "post: forum %q differs from forum %q of thread %d", p.Forum, t.Forum, t.ThreadID)
+	case p.Parent != 0 && (parent == nil || parent.Thread != p.Thread):
+		d.fail(p.line, "post: parent post %d is not found before this line in thread %d", p.Parent, p.Thread)
+	default:
+		p.Forum = t.Forum
+		p.PostAuthor = d.refUser(p.line, p.PostAuthor)
+		d.posts = append(d.posts, p)
+		d.postByID[p.PostID] = p
+	}
+}
+
+func (d *dump) addVote(v *dumpVote) {
+	key := strings.ToLower(v.Nickname) + "\x00" + fmt.Sprint(v.Thread)
+	switch {
+	case v.Nickname == "":
+		d.fail(v.line, "vote: nickname is empty")
+	case v.Voice != -1 && v.Voice != 1:
+		d.fail(v.line, "vote: voice must be -1 or 1")
+	case d.threadByID[v.Thread] == nil:
+		d.fail(v.line, "vote: thread %d is not in the dump", v.Thread)
+	case d.voteSeen[key]:
+		d.fail(v.line, "vote: %s already voted for thread %d", v.Nickname, v.Thread)
+	default:
+		v.Nickname = d.refUser(v.line, v.Nickname)
+		d.votes = append(d.votes, v)
+		d.voteSeen[key] = true
+	}
+}
+
+// checkDatabase finds conflicts with the records already in the database
+// and resolves references to them.
+func (d *dump) checkDatabase(tx *sqlx.Tx, opts ImportOptions) error {
+	nicknames, emails := []string{}, []string{}
+	for _, u := range d.users {
+		nicknames = append(nicknames, u.Nickname)
+		emails = append(emails, u.Email)
+	}
+	existing := []models.ForumUser{}
+	err := tx.Select(&existing, "SELECT * FROM forum_user WHERE nickname = ANY($1) OR email = ANY($2)",
+		pq.Array(nicknames), pq.Array(emails))
+	if err != nil {
+		return err
+	}
+	for _, e := range existing {
+		// users are referenced by nickname, so the ones already here are kept
+		if u, ok := d.userByNickname[strings.ToLower(e.Nickname)]; ok {
+			u.exists = true
+			continue
+		}
+		if u, ok := d.userByEmail[strings.ToLower(e.Email)]; ok {
+			d.fail(u.line, "user: email %q is taken by %s in the database", u.Email, e.Nickname)
+		}
+	}
+
+	found, err := selectKeys(tx, "SELECT nickname FROM forum_user WHERE nickname = ANY($1)", d.extUsers)
+	if err != nil {
+		return err
+	}
+	for key, line := range d.extUsers {
+		if !found[key] {
+			d.fail(line, "user %q is neither in the dump nor in the database", key)
+		}
+	}
+	found, err = selectKeys(tx, "SELECT forum_slug FROM forum WHERE forum_slug = ANY($1)", d.extForums)
+	if err != nil {
+		return err
+	}
+	for key, line := range d.extForums {
+		if !found[key] {
+			d.fail(line, "forum %q is neither in the dump nor in the database", key)
+		}
+	}
+
+	found, err = selectKeys(tx, "SELECT category_slug FROM category WHERE category_slug = ANY($1)", d.extCategories)
+	if err != nil {
+		return err
+	}
+	for key, line := range d.extCategories {
+		if !found[key] {
+			d.fail(line, "category %q is neither in the dump nor in the database", key)
+		}
+	}
+
+	slugs := map[string]int{}
+	for _, c := range d.categories {
+		slugs[strings.ToLower(c.CategorySlug)] = c.line
+	}
+	err = d.failExisting(tx, "SELECT category_slug FROM category WHERE category_slug = ANY($1)", slugs,
+		"category: slug %q already exists")
+	if err != nil {
+		return err
+	}
+	slugs = map[string]int{}
+	for _, f := range d.forums {
+		slugs[strings.ToLower(f.ForumSlug)] = f.line
+	}
+	err = d.failExisting(tx, "SELECT forum_slug FROM forum WHERE forum_slug = ANY($1)", slugs, "forum: slug %q already exists")
+	if err != nil {
+		return err
+	}
+	slugs = map[string]int{}
+	for _, t := range d.threads {
+		if t.ThreadSlug != nil {
+			slugs[strings.ToLower(*t.ThreadSlug)] = t.line
+		}
+	}
+	err = d.failExisting(tx, "SELECT thread_slug FROM thread WHERE thread_slug = ANY($1)", slugs, "thread: slug %q already exists")
+	if err != nil {
+		return err
+	}
+
+	if !opts.RemapIDs {
+		ids := map[string]int{}
+		for _, t := range d.threads {
+			ids[fmt.Sprint(t.ThreadID)] = t.line
+		}
+		err = d.failExisting(tx, "SELECT thread_id::text FROM thread WHERE thread_id = ANY($1::int[])", ids, "thread: id %s already exists")
+		if err != nil {
+			return err
+		}
+		ids = map[string]int{}
+		for _, p := range d.posts {
+			ids[fmt.Sprint(p.PostID)] = p.line
+		}
+		err = d.failExisting(tx, "SELECT post_id::text FROM post WHERE post_id = ANY($1::int[])", ids, "post: id %s already exists")
+		if err != nil {
+			return err
+		}
+	}
+	return d.err()
+}
+
+// selectKeys returns which of keys query finds, compared in lower case.
+func selectKeys(tx *sqlx.Tx, query string, keys map[string]int) (map[string]bool, error) {
+	res := map[string]bool{}
+	if len(keys) == 0 {
+		return res, nil
+	}
+	list := make([]string, 0, len(keys))
+	for k := range keys {
+		list = append(list, k)
+	}
+	found := []string{}
+	err := tx.Select(&found, query, pq.Array(list))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range found {
+		res[strings.ToLower(f)] = true
+	}
+	return res, nil
+}
+
+func (d *dump) failExisting(tx *sqlx.Tx, query string, keys map[string]int, format string) error {
+	found, err := selectKeys(tx, query, keys)
+	if err != nil {
+		return err
+	}
+	for key, line := range keys {
+		if found[key] {
+			d.fail(line, format, key)
+		}
+	}
+	return nil
+}
+
+// nextIDs takes n ids from the sequence of the column. Sequences are not
+// rolled back, so a dry run counts on from the largest id instead.
+func nextIDs(tx *sqlx.Tx, table, column string, n int, dryRun bool) ([]int, error) {
+	res := []int{}
+	if dryRun {
+		err := tx.Select(&res, fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) + generate_series(1, $1) FROM %s", column, table), n)
+		return res, err
+	}
+	err := tx.Select(&res, "SELECT nextval(pg_get_serial_sequence($1, $2)) FROM generate_series(1, $3)",
+		table, column, n)
+	return res, err
+}
+
+// ImportDump loads a dump made by ExportDump in a single transaction.
+// Users that already exist are kept, categories, forums, threads and posts
+// must be new.
+// Post paths and all counters are rebuilt.
+func ImportDump(r io.Reader, opts ImportOptions) (*models.ImportResult, error) {
+	d, err := readDump(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = d.checkDatabase(tx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	postIDs := make(map[int]int, len(d.posts))
+	if opts.RemapIDs {
+		ids, err := nextIDs(tx, "thread", "thread_id", len(d.threads), opts.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range d.threads {
+			t.newID = ids[i]
+		}
+		ids, err = nextIDs(tx, "post", "post_id", len(d.posts), opts.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range d.posts {
+			postIDs[p.PostID] = ids[i]
+		}
+	} else {
+		for _, p := range d.posts {
+			postIDs[p.PostID] = p.PostID
+		}
+	}
+
+	res := &models.ImportResult{DryRun: opts.DryRun}
+	now := time.Now()
+	err = copyRows(tx, pq.CopyIn("forum_user", "nickname", "fullname", "email", "about",
+		"signature", "joined", "last_seen"), len(d.users),
+		func(i int) []interface{} {
+			u := d.users[i]
+			if u.exists {
+				return nil
+			}
+			res.Users++
+			joined := &now
+			if u.Joined != nil {
+				joined = u.Joined
+			}
+			return []interface{}{u.Nickname, u.Fullname, u.Email, u.About, u.Signature, joined, u.LastSeen}
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = copyRows(tx, pq.CopyIn("category", "category_slug", "category_title", "position"), len(d.categories),
+		func(i int) []interface{} {
+			c := d.categories[i]
+			return []interface{}{c.CategorySlug, c.CategoryTitle, c.Position}
+		})
+	if err != nil {
+		return nil, err
+	}
+	res.Categories = len(d.categories)
+	err = copyRows(tx, pq.CopyIn("forum", "forum_slug", "forum_title", "forum_user", "forum_parent",
+		"category", "position"), len(d.forums),
+		func(i int) []interface{} {
+			f := d.forums[i]
+			return []interface{}{f.ForumSlug, f.ForumTitle, f.ForumUser, f.Parent, f.Category, f.Position}
+		})
+	if err != nil {
+		return nil, err
+	}
+	res.Forums = len(d.forums)
+	err = copyRows(tx, pq.CopyIn("thread", "thread_id", "forum", "thread_slug", "thread_title",
+		"thread_author", "thread_created", "thread_message", "tags"), len(d.threads),
+		func(i int) []interface{} {
+			t := d.threads[i]
+			return []interface{}{t.newID, t.Forum, t.ThreadSlug, t.ThreadTitle,
+				t.ThreadAuthor, t.ThreadCreated, t.ThreadMessage, t.Tags}
+		})
+	if err != nil {
+		return nil, err
+	}
+	res.Threads = len(d.threads)
+
+	paths := make(map[int][]int64, len(d.posts))
+	err = copyRows(tx, pq.CopyIn("post", "post_id", "forum", "thread", "parent", "path", "path1",
+		"post_author", "post_created", "is_edited", "post_message"), len(d.posts),
+		func(i int) []interface{} {
+			p := d.posts[i]
+			id, parent := postIDs[p.PostID], 0
+			path := []int64{}
+			if p.Parent != 0 {
+				parent = postIDs[p.Parent]
+				path = append(path, paths[p.Parent]...)
+			}
+			path = append(path, int64(id))
+			paths[p.PostID] = path
+			return []interface{}{id, p.Forum, d.threadByID[p.Thread].newID, parent, pq.Array(path), path[0],
+				p.PostAuthor, p.PostCreated, p.IsEdited, p.PostMessage}
+		})
+	if err != nil {
+		return nil, err
+	}
+	res.Posts = len(d.posts)
+	err = copyRows(tx, pq.CopyIn("vote", "nickname", "thread", "voice"), len(d.votes),
+		func(i int) []interface{} {
+			v := d.votes[i]
+			return []interface{}{v.Nickname, d.threadByID[v.Thread].newID, v.Voice}
+		})
+	if err != nil {
+		return nil, err
+	}
+	res.Votes = len(d.votes)
+
+	if !opts.RemapIDs && !opts.DryRun {
+		_, err = tx.Exec(`SELECT setval(pg_get_serial_sequence('thread', 'thread_id'), MAX(thread_id)) FROM thread`)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`SELECT setval(pg_get_serial_sequence('post', 'post_id'), MAX(post_id)) FROM post`)
+		if err != nil {
+			return nil, err
+		}
+	}
+	forums, users := d.touched()
+	err = recountCounters(tx.Tx, forums, users)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return res, nil
+	}
+	err = tx.Commit()
+	purgeCaches()
+	return res, err
+}
+
+// touched lists the forums the dump adds threads to and the users whose
+// stats change, only their counters need to be rebuilt.
+func (d *dump) touched() (forums, users []string) {
+	seenForums, seenUsers := map[string]bool{}, map[string]bool{}
+	addForum := func(slug string) {
+		if !seenForums[strings.ToLower(slug)] {
+			seenForums[strings.ToLower(slug)] = true
+			forums = append(forums, slug)
+		}
+	}
+	addUser := func(nickname string) {
+		if !seenUsers[strings.ToLower(nickname)] {
+			seenUsers[strings.ToLower(nickname)] = true
+			users = append(users, nickname)
+		}
+	}
+	for _, f := range d.forums {
+		addForum(f.ForumSlug)
+	}
+	for _, u := range d.users {
+		addUser(u.Nickname)
+	}
+	for _, t := range d.threads {
+		addForum(t.Forum)
+		addUser(t.ThreadAuthor)
+	}
+	for _, p := range d.posts {
+		addUser(p.PostAuthor)
+	}
+	return forums, users
+}
+
+// copyRows copies n rows, row returns nil to skip one.
+func copyRows(tx *sqlx.Tx, query string, n int, row func(i int) []interface{}) error {
+	if n == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := 0; i < n; i++ {
+		args := row(i)
+		if args == nil {
+			continue
+		}
+		_, err = stmt.Exec(args...)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = stmt.Exec()
+	return err
+}
@@ -0,0 +1,138 @@
+package queries
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// importDump is a dump of a forum of its own by the existing user "local":
+// thread 1 with post 1 and a reply to it, and a vote. The ids are the
+// ones the first thread and post of any database get.
+const importDump = `{"type": "user", "data": {"nickname": "local", "fullname": "local", "email": "local@example.com"}}
+{"type": "user", "data": {"nickname": "imported", "fullname": "Imported", "email": "imported@example.com"}}
+{"type": "forum", "data": {"slug": "imports", "title": "Imports", "user": "imported"}}
+{"type": "thread", "data": {"id": 1, "forum": "imports", "slug": "imported-thread", "title": "t", "author": "imported", "message": "m", "created": "2017-01-01T00:00:00Z"}}
+{"type": "post", "data": {"id": 1, "forum": "imports", "thread": 1, "author": "imported", "message": "first", "created": "2017-01-01T00:00:00Z"}}
+{"type": "post", "data": {"id": 2, "forum": "imports", "thread": 1, "parent": 1, "author": "local", "message": "reply", "created": "2017-01-01T00:00:00Z"}}
+{"type": "vote", "data": {"nickname": "local", "thread": 1, "voice": 1}}
+`
+
+func testImportSource(t *testing.T) {
+	t.Helper()
+	testUser(t, "local")
+	testForum(t, "locals", "local")
+	th := testThread(t, "locals", "local")
+	posts := models.PostList{{PostAuthor: "local", PostMessage: "local post"}}
+	if _, err := CreatePosts(&posts, strconv.Itoa(th.ThreadID)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sequenceValue(t *testing.T, table, column string) int {
+	t.Helper()
+	n := 0
+	err := db.Get(&n, `SELECT COALESCE(last_value, 0) FROM pg_sequences
+		WHERE schemaname || '.' || sequencename = pg_get_serial_sequence($1, $2)`, table, column)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestImportDryRunChangesNothing(t *testing.T) {
+	testDB(t)
+	testImportSource(t)
+	tables := []string{"forum_user", "forum", "thread", "post", "vote"}
+	rows := map[string]int{}
+	for _, table := range tables {
+		rows[table] = countRows(t, table)
+	}
+	threadSeq, postSeq := sequenceValue(t, "thread", "thread_id"), sequenceValue(t, "post", "post_id")
+
+	for _, remap := range []bool{false, true} {
+		opts := ImportOptions{RemapIDs: remap, DryRun: true}
+		res, err := ImportDump(strings.NewReader(importDump), opts)
+		if remap != (err == nil) {
+			// the dumped ids are taken unless they are remapped
+			t.Fatalf("remap %v: %v", remap, err)
+		}
+		if err != nil {
+			continue
+		}
+		want := models.ImportResult{Users: 1, Forums: 1, Threads: 1, Posts: 2, Votes: 1, DryRun: true}
+		if *res != want {
+			t.Errorf("got %+v, want %+v", *res, want)
+		}
+	}
+
+	for _, table := range tables {
+		if n := countRows(t, table); n != rows[table] {
+			t.Errorf("%s: got %d rows after a dry run, want %d", table, n, rows[table])
+		}
+	}
+	if n := sequenceValue(t, "thread", "thread_id"); n != threadSeq {
+		t.Errorf("thread sequence moved from %d to %d", threadSeq, n)
+	}
+	if n := sequenceValue(t, "post", "post_id"); n != postSeq {
+		t.Errorf("post sequence moved from %d to %d", postSeq, n)
+	}
+}
+
+func TestImportRemapsIDsInNonEmptyDatabase(t *testing.T) {
+	testDB(t)
+	testImportSource(t)
+
+	res, err := ImportDump(strings.NewReader(importDump), ImportOptions{RemapIDs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Users != 1 || res.Threads != 1 || res.Posts != 2 {
+		t.Errorf("got %+v", res)
+	}
+
+	th, err := GetThreadBySlug("imported-thread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.ThreadID == 1 || th.Votes != 1 {
+		t.Errorf("got thread %+v, want a new id and the dumped vote", th)
+	}
+	local, err := GetThreadByID(1)
+	if err != nil || local.Forum != "locals" {
+		t.Errorf("the existing thread 1 is now %+v, %v", local, err)
+	}
+
+	posts := []models.Post{}
+	err = db.Select(&posts, "SELECT post_id, parent, post_message FROM post WHERE thread = $1 ORDER BY post_id", th.ThreadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts in the imported thread, want 2", len(posts))
+	}
+	first, reply := posts[0], posts[1]
+	if first.PostID == 1 || first.PostMessage != "first" || reply.Parent != first.PostID {
+		t.Errorf("got posts %+v, want new ids with the reply under the first one", posts)
+	}
+	if n := countRows(t, "post"); n != 3 {
+		t.Errorf("got %d posts, want the local one kept", n)
+	}
+}
+
+func TestImportReportsLineOfMalformedRecord(t *testing.T) {
+	lines := strings.Split(importDump, "\n")
+	// blank lines count too
+	dump := strings.Join(lines[:2], "\n") + "\n\n" + `{"type": "forum", "data": {"slug": ` + "\n" + strings.Join(lines[2:], "\n")
+
+	_, err := ImportDump(strings.NewReader(dump), ImportOptions{})
+	dumpErr, ok := err.(*DumpError)
+	if !ok {
+		t.Fatalf("got %v, want a dump error", err)
+	}
+	if len(dumpErr.Lines) != 1 || dumpErr.Lines[0].Line != 4 {
+		t.Errorf("got %v, want an error on line 4 only", err)
+	}
+}
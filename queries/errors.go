@@ -3,12 +3,20 @@ package queries
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/lib/pq"
 )
 
 var (
 	ErrParentPostIsNotInThisThread = errors.New("parent post is not found in this thread")
+	ErrPostIsNotInThisThread       = errors.New("post is not found in this thread")
+	ErrRecordChanged               = errors.New("record has been changed since it was read")
+	ErrAttachmentsDisabled         = errors.New("attachments are disabled")
+	ErrAttachmentTooLarge          = errors.New("attachment is too large")
+	ErrAttachmentType              = errors.New("attachment type is not allowed")
+	ErrRenameInProgress            = errors.New("user is being renamed")
+	ErrNicknameChanged             = errors.New("nickname can't be changed by a profile update, use POST /user/{nickname}/rename")
 	NotNullViolationCode           = pq.ErrorCode("23502")
 	UniqueViolationCode            = pq.ErrorCode("23505")
 )
@@ -57,3 +65,27 @@ func (s NoRowsAffectedError) Error() string {
 func (s NullFieldError) Error() string {
 	return fmt.Sprintf(`%s error: %s is NULL`, s.Model, s.Field)
 }
+
+// DumpError lists the problems found in a dump by line.
+type DumpError struct {
+	Lines []DumpLineError
+}
+
+type DumpLineError struct {
+	Line    int
+	Message string
+}
+
+func (s DumpError) Error() string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "dump error: %d problems found", len(s.Lines))
+	for _, l := range s.Lines {
+		b.WriteString("\n")
+		b.WriteString(l.Error())
+	}
+	return b.String()
+}
+
+func (s DumpLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", s.Line, s.Message)
+}
@@ -0,0 +1,262 @@
+package queries
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// eventsLock is held by the sequencer numbering new events, see
+// 17_events_order.sql. Numbering moved from the readers to a sequencer
+// of every server, so reading the feed is read only.
+const eventsLock = 5000002
+
+// eventsPoll is how often waiting readers look for events written by
+// other servers, the ones of this process wake them up right away.
+const eventsPoll = time.Second
+
+var (
+	eventsMu      sync.Mutex
+	eventsWritten = make(chan struct{})    // closed when events get numbered
+	eventsPending = make(chan struct{}, 1) // events await the sequencer
+)
+
+// eventsCommitted tells the sequencer there are events to number.
+func eventsCommitted() {
+	select {
+	case eventsPending <- struct{}{}:
+	default:
+	}
+}
+
+// eventsSequenced wakes up the readers waiting for new events.
+func eventsSequenced() {
+	eventsMu.Lock()
+	close(eventsWritten)
+	eventsWritten = make(chan struct{})
+	eventsMu.Unlock()
+}
+
+func eventsWaiter() <-chan struct{} {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return eventsWritten
+}
+
+type change struct {
+	record string
+	data   json.Marshaler
+}
+
+func userRecord(nickname string) string {
+	return "user:" + strings.ToLower(nickname)
+}
+
+func forumRecord(slug string) string {
+	return "forum:" + strings.ToLower(slug)
+}
+
+func categoryRecord(slug string) string {
+	return "category:" + strings.ToLower(slug)
+}
+
+func threadRecord(id int) string {
+	return "thread:" + strconv.Itoa(id)
+}
+
+func postRecord(id int) string {
+	return "post:" + strconv.Itoa(id)
+}
+
+func attachmentRecord(id int) string {
+	return "attachment:" + strconv.Itoa(id)
+}
+
+func voteRecord(nickname string, thread int) string {
+	return "vote:" + strings.ToLower(nickname) + ":" + strconv.Itoa(thread)
+}
+
+// recordChanges appends changes to the feed, they get their seq after tx
+// commits. Callers record a change after the write that locks its row.
+func recordChanges(tx *sqlx.Tx, typ, forum string, thread int, changes ...change) error {
+	records := make([]string, len(changes))
+	payloads := make([]string, len(changes))
+	for k, c := range changes {
+		j, err := c.data.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		records[k] = c.record
+		payloads[k] = string(j)
+	}
+	_, err := tx.Exec(`
+		INSERT INTO events (type, record, forum, thread, payload)
+		SELECT $1, c.record, NULLIF($2, ''), NULLIF($3, 0), c.payload
+		FROM unnest($4::text[], $5::text[]) WITH ORDINALITY c (record, payload, n)
+		ORDER BY c.n`,
+		typ, forum, thread, pq.Array(records), pq.Array(payloads))
+	return err
+}
+
+// GetEvents returns up to limit events after seq. If there are none it
+// waits for them until timeout or ctx is done.
+func GetEvents(ctx context.Context, after int64, limit uint64, timeout time.Duration) (*models.EventList, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(eventsPoll)
+	defer poll.Stop()
+	for {
+		written := eventsWaiter()
+		res, err := getEvents(after, limit)
+		if err != nil || len(*res) != 0 {
+			return res, err
+		}
+		select {
+		case <-written:
+		case <-poll.C:
+		case <-deadline.C:
+			return res, nil
+		case <-ctx.Done():
+			return res, nil
+		}
+	}
+}
+
+// RunEventsSequencer numbers events as soon as this process commits them,
+// and every interval the ones left by servers that went away before
+// numbering theirs.
+func RunEventsSequencer(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-eventsPending:
+		case <-tick.C:
+		}
+		if err := sequenceEvents(); err != nil {
+			log.Println("events sequencer:", err)
+		}
+	}
+}
+
+// sequenceEvents numbers the committed events that have no seq yet in
+// the order they were inserted. One sequencer does it at a time, events
+// committed meanwhile are left to the next run.
+func sequenceEvents() error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	locked := false
+	err = tx.Get(&locked, "SELECT pg_try_advisory_xact_lock($1)", eventsLock)
+	if err != nil || !locked {
+		return err
+	}
+	ids := []int64{}
+	err = tx.Select(&ids, "SELECT id FROM events WHERE seq IS NULL ORDER BY id")
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	_, err = tx.Exec(`
+		WITH last AS (SELECT setval('events_seq_seq', nextval('events_seq_seq') + $2 - 1) seq)
+		UPDATE events e SET seq = last.seq - $2 + p.n
+		FROM last, unnest($1::bigint[]) WITH ORDINALITY p (id, n)
+		WHERE e.id = p.id`,
+		pq.Array(ids), len(ids))
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err == nil {
+		eventsSequenced()
+	}
+	return err
+}
+
+func getEvents(after int64, limit uint64) (*models.EventList, error) {
+	res := models.EventList{}
+	err := onReplica(func(q *sqlx.DB) error {
+		res = res[:0]
+		rows, err := q.Query(`SELECT seq, type, COALESCE(forum, ''), COALESCE(thread, 0), payload
+			FROM events WHERE seq > $1 ORDER BY seq LIMIT $2`, after, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e := models.Event{}
+			payload := ""
+			err = rows.Scan(&e.ID, &e.Type, &e.Forum, &e.Thread, &payload)
+			if err != nil {
+				return err
+			}
+			e.Data = json.RawMessage(payload)
+			res = append(res, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// TrimEvents deletes events older than retain and, of the ones older than
+// compactAfter, all but the last event of every record. 0 disables either.
+func TrimEvents(retain, compactAfter time.Duration) (int64, error) {
+	n := int64(0)
+	if retain > 0 {
+		r, err := db.Exec("DELETE FROM events WHERE created < now() - $1 * interval '1 millisecond'",
+			retain.Nanoseconds()/int64(time.Millisecond))
+		if err != nil {
+			return n, err
+		}
+		deleted, _ := r.RowsAffected()
+		n += deleted
+	}
+	if compactAfter > 0 {
+		r, err := db.Exec(`DELETE FROM events e
+			WHERE created < now() - $1 * interval '1 millisecond'
+				AND EXISTS (SELECT 1 FROM events l WHERE l.record = e.record AND l.seq > e.seq)`,
+			compactAfter.Nanoseconds()/int64(time.Millisecond))
+		if err != nil {
+			return n, err
+		}
+		deleted, _ := r.RowsAffected()
+		n += deleted
+	}
+	return n, nil
+}
+
+// RunEventsRetention trims the change feed every interval.
+func RunEventsRetention(interval, retain, compactAfter time.Duration) {
+	for range time.Tick(interval) {
+		n, err := TrimEvents(retain, compactAfter)
+		if err != nil {
+			log.Println("events retention:", err)
+			continue
+		}
+		if n != 0 {
+			log.Printf("events retention: %d events deleted\n", n)
+		}
+	}
+}
+
+// commitChanges commits a transaction that recorded changes.
+func commitChanges(tx *sqlx.Tx) error {
+	err := tx.Commit()
+	if err == nil {
+		eventsCommitted()
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestEventsCommittedLateAreNotSkipped(t *testing.T) {
+	testDB(t)
+	testUser(t, "early")
+
+	// a write that began first but commits last
+	slow, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Rollback()
+	late := &models.ForumUser{Nickname: "late"}
+	if err = recordChanges(slow, models.EventUserUpdated, "", 0, change{userRecord("late"), late}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = UpdateUser("early", &models.ForumUser{About: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = sequenceEvents(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := getEvents(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*first) == 0 {
+		t.Fatal("no events of committed writes")
+	}
+	last := (*first)[len(*first)-1].ID
+
+	if err = commitChanges(slow); err != nil {
+		t.Fatal(err)
+	}
+	if err = sequenceEvents(); err != nil {
+		t.Fatal(err)
+	}
+	next, err := getEvents(last, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*next) != 1 || (*next)[0].Type != models.EventUserUpdated || (*next)[0].ID <= last {
+		t.Errorf("got events %+v after %d, want the late one", *next, last)
+	}
+}
@@ -2,26 +2,51 @@ package queries
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 
 	"github.com/ArtAndreev/ForumTP/models"
 )
 
+// forumTreeLock serializes moves of forums in the hierarchy.
+const forumTreeLock = 5000003
+
 func CreateForum(f *models.Forum) (*models.Forum, error) {
 	if f.ForumTitle == "" || f.ForumSlug == "" || f.ForumUser == "" {
 		return nil, &NullFieldError{"Forum", "title and/or slug and/or user"}
 	}
 
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	parent, category, err := placeForum(tx, f.Parent, f.Category)
+	if err != nil {
+		return nil, err
+	}
 	res := &models.Forum{}
-	err := db.Get(
+	err = tx.Get(
 		res,
-		`INSERT INTO forum (forum_title, forum_slug, forum_user)
-		VALUES ($1, $2, (SELECT nickname FROM forum_user WHERE nickname = $3)) RETURNING *`,
-		f.ForumTitle, f.ForumSlug, f.ForumUser)
+		`INSERT INTO forum (forum_title, forum_slug, forum_user, forum_parent, category, position)
+		VALUES ($1, $2, (SELECT nickname FROM forum_user WHERE nickname = $3 AND nickname <> '`+DeletedNickname+`'),
+			$4, $5, $6) RETURNING *`,
+		f.ForumTitle, f.ForumSlug, f.ForumUser, parent, category, f.Position)
+	if err == nil {
+		err = recordChanges(tx, models.EventForumCreated, res.ForumSlug, 0, change{forumRecord(res.ForumSlug), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
 	if err != nil {
-		pqErr := err.(*pq.Error)
+		pqErr, ok := err.(*pq.Error)
+		if !ok {
+			return res, err
+		}
 		switch pqErr.Code {
 		case UniqueViolationCode:
 			if strings.HasPrefix(pqErr.Detail, "Key (forum_slug)") {
@@ -42,7 +67,132 @@ func CreateForum(f *models.Forum) (*models.Forum, error) {
 	return res, nil
 }
 
+// placeForum checks where a forum goes: under the parent forum, into the
+// category or to the top level if both are empty. It returns both with
+// slugs as they are stored.
+func placeForum(tx *sqlx.Tx, parent, category *string) (*string, *string, error) {
+	if parent != nil && *parent == "" {
+		parent = nil
+	}
+	if category != nil && *category == "" {
+		category = nil
+	}
+	if parent != nil && category != nil {
+		// a sub-forum is in the category of its top-level forum
+		return nil, nil, &ValidationError{"Forum", "parent and category"}
+	}
+	if parent != nil {
+		res := ""
+		err := tx.Get(&res, "SELECT forum_slug FROM forum WHERE forum_slug = $1", *parent)
+		if err == sql.ErrNoRows {
+			return nil, nil, &RecordNotFoundError{"Forum", *parent}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		parent = &res
+	}
+	if category != nil {
+		res := ""
+		err := tx.Get(&res, "SELECT category_slug FROM category WHERE category_slug = $1", *category)
+		if err == sql.ErrNoRows {
+			return nil, nil, &RecordNotFoundError{"Category", *category}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		category = &res
+	}
+	return parent, category, nil
+}
+
+// UpdateForum changes the title or the position of the forum s, or moves
+// it with all of its sub-forums. A forum can't be moved under itself or
+// any of its sub-forums.
+func UpdateForum(s string, u *models.ForumUpdate) (*models.Forum, error) {
+	if u.Title == "" && u.Parent == nil && u.Category == nil && u.Position == nil {
+		return GetForumBySlug(s)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	moves := u.Parent != nil || u.Category != nil
+	if moves {
+		// two moves at once could put forums under each other
+		_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", forumTreeLock)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := &models.Forum{}
+	err = tx.Get(res, "SELECT * FROM forum WHERE forum_slug = $1 FOR UPDATE", s)
+	if err == sql.ErrNoRows {
+		return nil, &RecordNotFoundError{"Forum", s}
+	}
+	if err != nil {
+		return nil, err
+	}
+	parent, category := res.Parent, res.Category
+	if moves {
+		// a forum is either a sub-forum or in a category
+		if u.Parent != nil && *u.Parent != "" || u.Category != nil && *u.Category != "" {
+			parent, category = nil, nil
+		}
+		if u.Parent != nil {
+			parent = u.Parent
+		}
+		if u.Category != nil {
+			category = u.Category
+		}
+		parent, category, err = placeForum(tx, parent, category)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if parent != nil && (res.Parent == nil || !strings.EqualFold(*parent, *res.Parent)) {
+		cycle := false
+		err = tx.Get(&cycle, `
+			WITH RECURSIVE up AS (
+				SELECT forum_slug, forum_parent FROM forum WHERE forum_slug = $1
+				UNION ALL
+				SELECT f.forum_slug, f.forum_parent FROM up JOIN forum f ON f.forum_slug = up.forum_parent
+			)
+			SELECT EXISTS (SELECT FROM up WHERE forum_slug = $2)`, *parent, res.ForumSlug)
+		if err != nil {
+			return nil, err
+		}
+		if cycle {
+			return nil, &ValidationError{"Forum", "parent"}
+		}
+	}
+	err = tx.Get(res, `UPDATE forum SET
+		forum_title = COALESCE(NULLIF($2, ''), forum_title),
+		forum_parent = $3,
+		category = $4,
+		position = COALESCE($5, position)
+		WHERE forum_slug = $1 RETURNING *`,
+		res.ForumSlug, u.Title, parent, category, u.Position)
+	if err == nil {
+		err = recordChanges(tx, models.EventForumUpdated, res.ForumSlug, 0, change{forumRecord(res.ForumSlug), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	forumCache.Delete(cacheKey(res.ForumSlug))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func GetForumBySlug(s string) (*models.Forum, error) {
+	if res, ok := cachedForum(s); ok {
+		return res, nil
+	}
 	res := &models.Forum{}
 	err := db.Get(res, "SELECT * FROM forum	WHERE forum_slug = $1", s)
 	if err != nil {
@@ -51,10 +201,14 @@ func GetForumBySlug(s string) (*models.Forum, error) {
 		}
 		return res, err
 	}
+	cacheForum(res)
 	return res, nil
 }
 
 func CheckExistenceOfForum(s string) error {
+	if _, ok := cachedForum(s); ok {
+		return nil
+	}
 	err := db.QueryRow("SELECT FROM forum WHERE forum_slug = $1", s).Scan()
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -65,3 +219,79 @@ func CheckExistenceOfForum(s string) error {
 
 	return nil
 }
+
+// forumNodes finishes a query that starts with the page CTE of forums:
+// it selects them with the counters of all their sub-forums added up.
+const forumNodes = `, sub (root, forum_slug) AS (
+		SELECT forum_slug, forum_slug FROM page
+		UNION ALL
+		SELECT s.root, f.forum_slug FROM sub s JOIN forum f ON f.forum_parent = s.forum_slug
+	)
+	SELECT p.*, t.total_threads, t.total_posts FROM page p JOIN (
+		SELECT s.root, SUM(f.threads) total_threads, SUM(f.posts) total_posts
+		FROM sub s JOIN forum f ON f.forum_slug = s.forum_slug
+		GROUP BY s.root
+	) t ON t.root = p.forum_slug
+	`
+
+// GetForums returns forums at all levels of the hierarchy by slug.
+func GetForums(params *models.ForumQueryParams) (*models.ForumNodeList, error) {
+	q := strings.Builder{}
+	q.WriteString("WITH RECURSIVE page AS (SELECT * FROM forum")
+	args := []interface{}{}
+	if params.Since != "" {
+		args = append(args, params.Since)
+		if params.Desc {
+			q.WriteString(" WHERE forum_slug < $1")
+		} else {
+			q.WriteString(" WHERE forum_slug > $1")
+		}
+	}
+	order := "forum_slug"
+	if params.Desc {
+		order += " DESC"
+	}
+	q.WriteString(" ORDER BY " + order)
+	if params.Limit != 0 {
+		q.WriteString(fmt.Sprintf(" LIMIT %v", params.Limit))
+	}
+	q.WriteString(")" + forumNodes + "ORDER BY p." + order)
+
+	res := &models.ForumNodeList{}
+	err := onReplica(func(conn *sqlx.DB) error {
+		return conn.Select(res, q.String(), args...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// nestForums puts nodes under their parents, the ones without a parent are
+// returned. The order of nodes is kept among siblings.
+func nestForums(nodes models.ForumNodeList) models.ForumNodeList {
+	roots := []int{}
+	children := map[string][]int{}
+	for k, n := range nodes {
+		if n.Parent == nil {
+			roots = append(roots, k)
+			continue
+		}
+		key := strings.ToLower(*n.Parent)
+		children[key] = append(children[key], k)
+	}
+	var nest func(ids []int) models.ForumNodeList
+	nest = func(ids []int) models.ForumNodeList {
+		if len(ids) == 0 {
+			return nil
+		}
+		res := make(models.ForumNodeList, 0, len(ids))
+		for _, k := range ids {
+			n := nodes[k]
+			n.Forums = nest(children[strings.ToLower(n.ForumSlug)])
+			res = append(res, n)
+		}
+		return res
+	}
+	return nest(roots)
+}
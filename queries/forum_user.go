@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 
 	"github.com/ArtAndreev/ForumTP/models"
@@ -15,6 +16,9 @@ func CreateUser(u *models.ForumUser) (*models.ForumUserList, error) {
 	if u.Nickname == "" || u.Email == "" {
 		return nil, &NullFieldError{"User", "nickname and/or email"}
 	}
+	if strings.EqualFold(u.Nickname, DeletedNickname) {
+		return nil, &ValidationError{"User", "nickname"}
+	}
 
 	res := &models.ForumUserList{}
 	r1, err := GetUserByNickname(u.Nickname)
@@ -40,10 +44,26 @@ func CreateUser(u *models.ForumUser) (*models.ForumUserList, error) {
 		return res, &UniqueFieldValueAlreadyExistsError{"User", "nickname and/or email"}
 	}
 
-	_, err = db.NamedExec(`
-		INSERT INTO forum_user (nickname, fullname, email, about)
-		VALUES (:nickname, :fullname, :email, :about)`,
-		u)
+	tx, err := db.Beginx()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+	// an old nickname of a renamed user no longer redirects
+	_, err = tx.Exec("DELETE FROM nickname_redirect WHERE old_nickname = $1", u.Nickname)
+	if err != nil {
+		return res, err
+	}
+	err = tx.Get(u, `
+		INSERT INTO forum_user (nickname, fullname, email, about, signature)
+		VALUES ($1, $2, $3, $4, $5) RETURNING *`,
+		u.Nickname, u.Fullname, u.Email, u.About, u.Signature)
+	if err == nil {
+		err = recordChanges(tx, models.EventUserCreated, "", 0, change{userRecord(u.Nickname), u})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
 	if err != nil {
 		return res, err
 	}
@@ -54,14 +74,18 @@ func CreateUser(u *models.ForumUser) (*models.ForumUserList, error) {
 }
 
 func GetUserByNickname(n string) (*models.ForumUser, error) {
+	if res, ok := cachedUser(n); ok {
+		return res, nil
+	}
 	res := &models.ForumUser{}
-	err := db.Get(res, "SELECT * FROM forum_user WHERE nickname = $1", n)
+	err := db.Get(res, "SELECT * FROM forum_user WHERE nickname = $1 AND "+notRenaming, n)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return res, &RecordNotFoundError{"User", n}
 		}
 		return res, err
 	}
+	cacheUser(res)
 	return res, nil
 }
 
@@ -78,13 +102,18 @@ func GetUserByEmail(e string) (*models.ForumUser, error) {
 }
 
 func UpdateUser(n string, u *models.ForumUser) (*models.ForumUser, error) {
-	if u.Nickname == "" && u.Fullname == "" && u.Email == "" && u.About == "" {
+	if u.Nickname != "" && !strings.EqualFold(u.Nickname, n) {
+		// the nickname is the key other tables refer to, only its case
+		// may change here
+		return nil, ErrNicknameChanged
+	}
+	if u.Nickname == "" && u.Fullname == "" && u.Email == "" && u.About == "" && u.Signature == "" {
 		return GetUserByNickname(n)
 	}
 
 	q := strings.Builder{}
 	q.WriteString("UPDATE forum_user SET ")
-	args := make([]interface{}, 0, 5)
+	args := make([]interface{}, 0, 6)
 	continues := false
 	fieldCount := 0
 	if u.Nickname != "" {
@@ -119,19 +148,40 @@ func UpdateUser(n string, u *models.ForumUser) (*models.ForumUser, error) {
 			q.WriteString(", about = $" + strconv.Itoa(fieldCount))
 		} else {
 			q.WriteString("about = $" + strconv.Itoa(fieldCount))
+			continues = true
 		}
 		args = append(args, u.About)
 	}
-	q.WriteString(" WHERE nickname = $" + strconv.Itoa(fieldCount+1) + " RETURNING *")
+	if u.Signature != "" {
+		fieldCount++
+		if continues {
+			q.WriteString(", signature = $" + strconv.Itoa(fieldCount))
+		} else {
+			q.WriteString("signature = $" + strconv.Itoa(fieldCount))
+		}
+		args = append(args, u.Signature)
+	}
+	q.WriteString(" WHERE nickname = $" + strconv.Itoa(fieldCount+1) + " AND " + notRenaming + " RETURNING *")
 	args = append(args, n)
 	res := &models.ForumUser{}
-	err := db.Get(res, q.String(), args...)
+	tx, err := db.Beginx()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+	err = tx.Get(res, q.String(), args...)
+	if err == nil {
+		err = recordChanges(tx, models.EventUserUpdated, "", 0, change{userRecord(res.Nickname), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	userCache.Delete(cacheKey(n))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return res, &RecordNotFoundError{"User", n}
 		}
-		pqErr := err.(*pq.Error)
-		if pqErr.Code == UniqueViolationCode {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == UniqueViolationCode {
 			switch {
 			case strings.HasPrefix(pqErr.Detail, "Key (nickname)"):
 				return res, &UniqueFieldValueAlreadyExistsError{"User", "nickname"}
@@ -146,16 +196,30 @@ func UpdateUser(n string, u *models.ForumUser) (*models.ForumUser, error) {
 }
 
 func GetAllUsersInForum(s string, params *models.UserQueryParams) (*models.ForumUserList, error) {
-	err := CheckExistenceOfForum(s)
+	res := &models.ForumUserList{}
+	err := StreamUsersInForum(s, params, func(u *models.ForumUser) error {
+		*res = append(*res, *u)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return res, nil
+}
+
+// StreamUsersInForum calls f for every user GetAllUsersInForum would
+// return without collecting them, u is reused between calls.
+func StreamUsersInForum(s string, params *models.UserQueryParams, f func(u *models.ForumUser) error) error {
+	err := CheckExistenceOfForum(s)
+	if err != nil {
+		return err
+	}
 
 	q := strings.Builder{}
 	q.WriteString(`
-		SELECT nickname, fullname, email, about FROM forum_user u
+		SELECT nickname, fullname, email, about, signature, avatar, joined, last_seen FROM forum_user u
 		JOIN users_in_forum uif ON uif.forum_user = u.nickname
-		WHERE uif.forum = $1`) // all post authors
+		WHERE uif.forum = $1 AND ` + notRenaming) // all post authors
 	if params.Since != "" {
 		if params.Desc {
 			q.WriteString(" AND forum_user < $2")
@@ -170,14 +234,29 @@ func GetAllUsersInForum(s string, params *models.UserQueryParams) (*models.Forum
 	if params.Limit != 0 {
 		q.WriteString(fmt.Sprintf(" LIMIT %v", params.Limit))
 	}
-	res := &models.ForumUserList{}
+	u := &models.ForumUser{}
+	emit := func() error {
+		return f(u)
+	}
 	if params.Since == "" {
-		err = db.Select(res, q.String(), s)
-	} else {
-		err = db.Select(res, q.String(), s, params.Since)
+		return streamRows(u, emit, q.String(), s)
 	}
+	return streamRows(u, emit, q.String(), s, params.Since)
+}
+
+func GetUserStats(n string) (*models.UserStats, error) {
+	res := &models.UserStats{}
+	err := onReplica(func(q *sqlx.DB) error {
+		return q.Get(res, `SELECT u.nickname, COALESCE(s.threads, 0) threads, COALESCE(s.posts, 0) posts,
+			COALESCE(s.votes, 0) votes, u.joined, u.last_seen
+			FROM forum_user u LEFT JOIN user_stats s ON s.nickname = u.nickname
+			WHERE u.nickname = $1 AND `+notRenaming, n)
+	})
 	if err != nil {
-		return res, err
+		if err == sql.ErrNoRows {
+			return nil, &RecordNotFoundError{"User", n}
+		}
+		return nil, err
 	}
 	return res, nil
 }
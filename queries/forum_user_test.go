@@ -0,0 +1,65 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestWritesCountInUserStats(t *testing.T) {
+	testDB(t)
+	testUser(t, "active")
+	testUser(t, "voter")
+	testForum(t, "stats", "active")
+	th := testThread(t, "stats", "active")
+	id := strconv.Itoa(th.ThreadID)
+	posts := models.PostList{{PostAuthor: "active", PostMessage: "1"}, {PostAuthor: "active", PostMessage: "2"},
+		{PostAuthor: "voter", PostMessage: "3"}}
+	if _, err := CreatePosts(&posts, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VoteForPost(&models.Vote{Nickname: "voter", Voice: 1}, id); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetUserStats("ACTIVE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Threads != 1 || stats.Posts != 2 || stats.Votes != 1 || stats.LastSeen == nil {
+		t.Errorf("got stats %+v of the author", stats)
+	}
+	stats, err = GetUserStats("voter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Threads != 0 || stats.Posts != 1 || stats.Votes != 0 || stats.LastSeen == nil {
+		t.Errorf("got stats %+v of the voter", stats)
+	}
+
+	// last_seen moves at most once a minute
+	recent := time.Now().Add(-10 * time.Second).Truncate(time.Microsecond)
+	if _, err = db.Exec("UPDATE forum_user SET last_seen = $1 WHERE nickname = 'voter'", recent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VoteForPost(&models.Vote{Nickname: "voter", Voice: -1}, id); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = GetUserStats("voter"); err != nil || !stats.LastSeen.Equal(recent) {
+		t.Errorf("got stats %+v, %v, want last seen kept at %v", stats, err, recent)
+	}
+	if _, err = db.Exec("UPDATE forum_user SET last_seen = last_seen - interval '1 hour' WHERE nickname = 'voter'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VoteForPost(&models.Vote{Nickname: "voter", Voice: 1}, id); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = GetUserStats("voter"); err != nil || !stats.LastSeen.After(recent) {
+		t.Errorf("got stats %+v, %v, want last seen moved", stats, err)
+	}
+	if stats, err = GetUserStats("active"); err != nil || stats.Votes != 1 {
+		t.Errorf("got stats %+v, %v of the author after the votes changed", stats, err)
+	}
+}
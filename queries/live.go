@@ -0,0 +1,108 @@
+package queries
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/live"
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+const eventsChannel = "forum_events"
+
+// maxNotifyPayload stays under the 8000 bytes limit of NOTIFY, larger
+// events go without data.
+const maxNotifyPayload = 7900
+
+var events live.Publisher = live.Nop{}
+
+// UseHub publishes events of writes of this process to h.
+func UseHub(h live.Publisher) {
+	events = h
+}
+
+// UseNotifyHub publishes events with NOTIFY and passes the events of all
+// servers sharing the database to h.
+func UseNotifyHub(h live.Publisher, address, database string) error {
+	l := pq.NewListener(dataSourceName(address, database), time.Second, time.Minute,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Println("events listener:", err)
+			}
+		})
+	if err := l.Listen(eventsChannel); err != nil {
+		l.Close()
+		return err
+	}
+	go func() {
+		for n := range l.Notify {
+			if n == nil {
+				// reconnected, notifications in between are lost
+				continue
+			}
+			e := &models.Event{}
+			if err := e.UnmarshalJSON([]byte(n.Extra)); err != nil {
+				log.Println(err)
+				continue
+			}
+			h.Publish(e)
+		}
+	}()
+	events = notifier{}
+	return nil
+}
+
+type notifier struct{}
+
+func (n notifier) Publish(e *models.Event) {
+	n.publishAll([]*models.Event{e})
+}
+
+// publishAll sends events in one NOTIFY round trip.
+func (notifier) publishAll(es []*models.Event) {
+	payloads := make([]string, 0, len(es))
+	for _, e := range es {
+		j, err := e.MarshalJSON()
+		if err == nil && len(j) > maxNotifyPayload {
+			e.Data = nil
+			j, err = e.MarshalJSON()
+		}
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		payloads = append(payloads, string(j))
+	}
+	if len(payloads) == 0 {
+		return
+	}
+	_, err := db.Exec("SELECT pg_notify($1, payload) FROM unnest($2::text[]) payload",
+		eventsChannel, pq.Array(payloads))
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// publish sends the events of a committed write, one for every value.
+// Failures don't fail the write.
+func publish(typ, forum string, thread int, vs ...json.Marshaler) {
+	es := make([]*models.Event, 0, len(vs))
+	for _, v := range vs {
+		j, err := v.MarshalJSON()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		es = append(es, &models.Event{Type: typ, Forum: forum, Thread: thread, Data: j})
+	}
+	if n, ok := events.(notifier); ok {
+		n.publishAll(es)
+		return
+	}
+	for _, e := range es {
+		events.Publish(e)
+	}
+}
@@ -0,0 +1,32 @@
+package queries
+
+import (
+	"crypto/sha256"
+
+	"github.com/ArtAndreev/ForumTP/markdown"
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// renderMessage returns the sanitized HTML of a message. The cache is
+// keyed by the text, so every revision is rendered once and an edited
+// message never gets the HTML of the text before the edit.
+func renderMessage(src string) string {
+	sum := sha256.Sum256([]byte(src))
+	key := string(sum[:])
+	if v, ok := htmlCache.Get(key); ok {
+		return v.(string)
+	}
+	res := markdown.Render(src)
+	htmlCache.Set(key, res)
+	return res
+}
+
+// RenderThread fills in the message_html of t.
+func RenderThread(t *models.Thread) {
+	t.MessageHTML = renderMessage(t.ThreadMessage)
+}
+
+// RenderPost fills in the message_html of p.
+func RenderPost(p *models.Post) {
+	p.MessageHTML = renderMessage(p.PostMessage)
+}
@@ -1,21 +1,129 @@
 package queries
 
 import (
+	"context"
 	"log"
+	"net/http"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/rubenv/sql-migrate" // applies migrations
+
+	"github.com/ArtAndreev/ForumTP/migrations"
+	"github.com/ArtAndreev/ForumTP/models"
 )
 
-func makeMigrations(db *sqlx.DB) {
-	migrations := &migrate.FileMigrationSource{
-		Dir: "migrations",
+// migrationsLockKey identifies the advisory lock that serializes
+// migrations between replicas starting at the same time.
+const migrationsLockKey = 5000001
+
+var migrationSource migrate.MigrationSource = &migrate.HttpFileSystemMigrationSource{
+	FileSystem: http.FS(migrations.FS),
+}
+
+// UseMigrationsDir loads migrations from dir instead of the ones built
+// into the binary.
+func UseMigrationsDir(dir string) {
+	migrationSource = &migrate.FileMigrationSource{
+		Dir: dir,
 	}
+}
 
-	n, err := migrate.Exec(db.DB, "postgres", migrations, migrate.Up)
+func makeMigrations(mode string) {
+	if mode == MigrateOff {
+		return
+	}
+	n, err := MigrateUp()
 	if err != nil {
+		if mode == MigrateStrict {
+			log.Panicf("migrations failed, refusing to start: %v", err)
+		}
 		log.Println(err)
 	} else if n != 0 {
 		log.Printf("Applied %d migrations!\n", n)
 	}
 }
+
+func withMigrationsLock(f func() error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationsLockKey)
+
+	return f()
+}
+
+// MigrateUp applies all pending migrations.
+func MigrateUp() (int, error) {
+	n := 0
+	err := withMigrationsLock(func() error {
+		var err error
+		n, err = migrate.Exec(db.DB, "postgres", migrationSource, migrate.Up)
+		return err
+	})
+	return n, err
+}
+
+// MigrateDown rolls back at most n applied migrations, all of them if n is 0.
+func MigrateDown(n int) (int, error) {
+	res := 0
+	err := withMigrationsLock(func() error {
+		var err error
+		res, err = migrate.ExecMax(db.DB, "postgres", migrationSource, migrate.Down, n)
+		return err
+	})
+	return res, err
+}
+
+// MigrateRedo rolls back the last applied migration and applies it again.
+func MigrateRedo() error {
+	return withMigrationsLock(func() error {
+		n, err := migrate.ExecMax(db.DB, "postgres", migrationSource, migrate.Down, 1)
+		if err != nil || n == 0 {
+			return err
+		}
+		_, err = migrate.ExecMax(db.DB, "postgres", migrationSource, migrate.Up, 1)
+		return err
+	})
+}
+
+// GetMigrationStatus lists known migrations in the order they are applied.
+// Migrations recorded in the database but missing in the source are
+// reported too, it usually means the binary is older than the schema.
+func GetMigrationStatus() (*models.MigrationList, error) {
+	source, err := migrationSource.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+	records, err := migrate.GetMigrationRecords(db.DB, "postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]*migrate.MigrationRecord, len(records))
+	for _, r := range records {
+		applied[r.Id] = r
+	}
+	res := &models.MigrationList{}
+	for _, m := range source {
+		status := models.Migration{ID: m.Id, State: models.MigrationPending}
+		if r, ok := applied[m.Id]; ok {
+			appliedAt := r.AppliedAt
+			status.State = models.MigrationApplied
+			status.AppliedAt = &appliedAt
+			delete(applied, m.Id)
+		}
+		*res = append(*res, status)
+	}
+	for _, r := range applied {
+		appliedAt := r.AppliedAt
+		*res = append(*res, models.Migration{ID: r.Id, State: models.MigrationMissing, AppliedAt: &appliedAt})
+	}
+	return res, nil
+}
@@ -0,0 +1,96 @@
+package queries
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestMigrationsApplyToAnyDatabase(t *testing.T) {
+	address, name := createTestDB(t)
+	ConnectDB(address, name)
+
+	source, err := migrationSource.FindMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(source) {
+		t.Fatalf("applied %d migrations, want %d", n, len(source))
+	}
+
+	// nothing is set on the database, the server picks the session settings
+	settings := 0
+	err = db.Get(&settings, `SELECT COUNT(*) FROM pg_db_role_setting s
+		JOIN pg_database d ON d.oid = s.setdatabase WHERE d.datname = current_database()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings != 0 {
+		t.Errorf("migrations left %d settings on the database", settings)
+	}
+
+	n, err = MigrateDown(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(source) {
+		t.Errorf("rolled back %d migrations, want %d", n, len(source))
+	}
+	status, err := GetMigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range *status {
+		if m.State != models.MigrationPending {
+			t.Errorf("migration %s is %s after rolling back all", m.ID, m.State)
+		}
+	}
+	if n, err = MigrateUp(); err != nil || n != len(source) {
+		t.Errorf("applied %d migrations again, want %d: %v", n, len(source), err)
+	}
+}
+
+func TestTimestampsAreSerializedInUTC(t *testing.T) {
+	testDB(t)
+	// the database default must not leak into the API either
+	if _, err := db.Exec("ALTER DATABASE " + pq.QuoteIdentifier(currentDatabase(t)) + " SET timezone TO 'Asia/Tokyo'"); err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxIdleConns(0) // new connections see the database setting
+
+	testUser(t, "tz")
+	testForum(t, "tz", "tz")
+	created := time.Date(2017, 1, 1, 3, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+	th, err := CreateThread(&models.Thread{Forum: "tz", ThreadTitle: "t", ThreadAuthor: "tz", ThreadMessage: "m", ThreadCreated: &created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	th, err = GetThreadByID(th.ThreadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := th.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"created":"2017-01-01T00:00:00Z"`; !strings.Contains(string(j), want) {
+		t.Errorf("got %s, want %s in it", j, want)
+	}
+}
+
+func currentDatabase(t *testing.T) string {
+	t.Helper()
+	name := ""
+	if err := db.Get(&name, "SELECT current_database()"); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
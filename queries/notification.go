@@ -0,0 +1,189 @@
+package queries
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// mentionRe finds @nickname not preceded by a nickname character, so
+// e-mail addresses are no mentions.
+var mentionRe = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@])@([A-Za-z0-9_.]+)`)
+
+// parseMentions returns the lowercased nicknames mentioned in text, each
+// once. A trailing dot ends the sentence rather than the nickname.
+func parseMentions(text string) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, m := range mentionRe.FindAllStringSubmatch(text, -1) {
+		n := strings.ToLower(strings.TrimRight(m[1], "."))
+		if n != "" && !seen[n] {
+			seen[n] = true
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// resolveMentions maps lowercased nicknames to the ones of existing users.
+func resolveMentions(tx *sqlx.Tx, names []string) (map[string]string, error) {
+	res := map[string]string{}
+	if len(names) == 0 {
+		return res, nil
+	}
+	rows, err := tx.Query("SELECT nickname FROM forum_user WHERE nickname = ANY($1::citext[])", pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		n := ""
+		if err = rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		res[strings.ToLower(n)] = n
+	}
+	return res, rows.Err()
+}
+
+type notice struct {
+	recipient string
+	typ       string
+	actor     string
+	post      int
+}
+
+func insertNotices(tx *sqlx.Tx, forum string, thread int, notices []notice) error {
+	if len(notices) == 0 {
+		return nil
+	}
+	recipients := make([]string, len(notices))
+	types := make([]string, len(notices))
+	actors := make([]string, len(notices))
+	posts := make([]int64, len(notices))
+	for k, n := range notices {
+		recipients[k], types[k], actors[k], posts[k] = n.recipient, n.typ, n.actor, int64(n.post)
+	}
+	_, err := tx.Exec(`
+		INSERT INTO notification (recipient, type, actor, forum, thread, post)
+		SELECT n.recipient, n.type, n.actor, $1, $2, NULLIF(n.post, 0)
+		FROM unnest($3::text[], $4::text[], $5::text[], $6::integer[]) n (recipient, type, actor, post)`,
+		forum, thread, pq.Array(recipients), pq.Array(types), pq.Array(actors), pq.Array(posts))
+	return err
+}
+
+// notifyPosts notifies authors of the posts replied to, replyTo holds
+// them by post, and the users mentioned. Nobody is notified of their own
+// posts, a reply that also mentions its recipient notifies once.
+func notifyPosts(tx *sqlx.Tx, t *models.Thread, posts models.PostList, replyTo []string) error {
+	notices := []notice{}
+	mentions := make([][]string, len(posts))
+	names := []string{}
+	for k, v := range posts {
+		if replyTo[k] != "" && replyTo[k] != DeletedNickname && !strings.EqualFold(replyTo[k], v.PostAuthor) {
+			notices = append(notices, notice{replyTo[k], models.NotificationReply, v.PostAuthor, v.PostID})
+		}
+		mentions[k] = parseMentions(v.PostMessage)
+		names = append(names, mentions[k]...)
+	}
+	users, err := resolveMentions(tx, names)
+	if err != nil {
+		return err
+	}
+	for k, v := range posts {
+		for _, m := range mentions[k] {
+			n, ok := users[m]
+			if !ok || strings.EqualFold(n, v.PostAuthor) || strings.EqualFold(n, replyTo[k]) {
+				continue
+			}
+			notices = append(notices, notice{n, models.NotificationMention, v.PostAuthor, v.PostID})
+		}
+	}
+	return insertNotices(tx, t.Forum, t.ThreadID, notices)
+}
+
+// notifyThreadMentions notifies the users mentioned in a new thread.
+func notifyThreadMentions(tx *sqlx.Tx, t *models.Thread) error {
+	users, err := resolveMentions(tx, parseMentions(t.ThreadMessage))
+	if err != nil {
+		return err
+	}
+	notices := []notice{}
+	for _, n := range users {
+		if !strings.EqualFold(n, t.ThreadAuthor) {
+			notices = append(notices, notice{n, models.NotificationMention, t.ThreadAuthor, 0})
+		}
+	}
+	return insertNotices(tx, t.Forum, t.ThreadID, notices)
+}
+
+// notifyVote notifies the author of a thread of a new vote.
+func notifyVote(tx *sqlx.Tx, nickname string, thread, voice int) error {
+	_, err := tx.Exec(`
+		INSERT INTO notification (recipient, type, actor, forum, thread, voice)
+		SELECT thread_author, $1, $2, forum, thread_id, $4 FROM thread
+		WHERE thread_id = $3 AND thread_author <> $2 AND thread_author <> $5`,
+		models.NotificationVote, nickname, thread, voice, DeletedNickname)
+	return err
+}
+
+func GetNotifications(nickname string, params *models.NotificationQueryParams) (*models.NotificationPage, error) {
+	u, err := GetUserByNickname(nickname)
+	if err != nil {
+		return nil, err
+	}
+	res := &models.NotificationPage{Notifications: models.NotificationList{}}
+	err = db.Get(&res.Unread, "SELECT COUNT(*) FROM notification WHERE recipient = $1 AND NOT is_read", u.Nickname)
+	if err != nil {
+		return nil, err
+	}
+
+	q := strings.Builder{}
+	q.WriteString(`SELECT notification_id, type, actor, forum, thread, COALESCE(post, 0) AS post,
+		COALESCE(voice, 0) AS voice, created, is_read
+		FROM notification WHERE recipient = $1`)
+	args := []interface{}{u.Nickname}
+	if params.Since != 0 {
+		args = append(args, params.Since)
+		q.WriteString(" AND notification_id < $" + strconv.Itoa(len(args)))
+	}
+	if params.UnreadOnly {
+		q.WriteString(" AND NOT is_read")
+	}
+	args = append(args, params.Limit)
+	q.WriteString(" ORDER BY notification_id DESC LIMIT $" + strconv.Itoa(len(args)))
+	err = db.Select(&res.Notifications, q.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// MarkNotificationsRead returns how many notifications are left unread.
+func MarkNotificationsRead(nickname string, r *models.NotificationsRead) (*models.UnreadCount, error) {
+	u, err := GetUserByNickname(nickname)
+	if err != nil {
+		return nil, err
+	}
+	res := &models.UnreadCount{}
+	err = db.Get(&res.Unread, `
+		WITH marked AS (
+			UPDATE notification SET is_read = TRUE
+			WHERE recipient = $1 AND NOT is_read
+				AND (COALESCE(cardinality($2::bigint[]), 0) = 0 OR notification_id = ANY($2))
+				AND ($3::bigint = 0 OR notification_id <= $3)
+			RETURNING notification_id
+		)
+		SELECT (SELECT COUNT(*) FROM notification WHERE recipient = $1 AND NOT is_read) -
+			(SELECT COUNT(*) FROM marked)`,
+		u.Nickname, pq.Array(r.IDs), r.UpTo)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
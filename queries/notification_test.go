@@ -0,0 +1,78 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestNotifications(t *testing.T) {
+	testDB(t)
+	for _, n := range []string{"author", "replier", "fan", "other"} {
+		testUser(t, n)
+	}
+	testForum(t, "notices", "author")
+	th, err := CreateThread(&models.Thread{Forum: "notices", ThreadTitle: "t", ThreadAuthor: "author",
+		ThreadMessage: "hello @fan, @AUTHOR and @nobody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(th.ThreadID)
+
+	root := models.PostList{{PostAuthor: "replier", PostMessage: "see @other"}}
+	created, err := CreatePosts(&root, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootID := (*created)[0].PostID
+	// a reply that mentions its recipient notifies once, nobody hears of
+	// their own posts
+	reply := models.PostList{{PostAuthor: "author", PostMessage: "thanks @replier, says @author", Parent: rootID}}
+	if created, err = CreatePosts(&reply, id); err != nil {
+		t.Fatal(err)
+	}
+	replyID := (*created)[0].PostID
+	own := models.PostList{{PostAuthor: "author", PostMessage: "and me", Parent: replyID}}
+	if _, err = CreatePosts(&own, id); err != nil {
+		t.Fatal(err)
+	}
+	// only a new vote notifies
+	for _, v := range []models.Vote{{Nickname: "fan", Voice: 1}, {Nickname: "fan", Voice: -1}, {Nickname: "author", Voice: 1}} {
+		if _, err = VoteForPost(&v, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []struct {
+		recipient string
+		models.Notification
+	}{
+		{"fan", models.Notification{Type: models.NotificationMention, Actor: "author"}},
+		{"other", models.Notification{Type: models.NotificationMention, Actor: "replier", Post: rootID}},
+		{"replier", models.Notification{Type: models.NotificationReply, Actor: "author", Post: replyID}},
+		{"author", models.Notification{Type: models.NotificationVote, Actor: "fan", Voice: 1}},
+	} {
+		page, err := GetNotifications(want.recipient, &models.NotificationQueryParams{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Unread != 1 || len(page.Notifications) != 1 {
+			t.Errorf("%s: got %+v, want one unread notification", want.recipient, page)
+			continue
+		}
+		got := page.Notifications[0]
+		if got.Type != want.Type || got.Actor != want.Actor || got.Post != want.Post || got.Voice != want.Voice ||
+			got.Forum != "notices" || got.Thread != th.ThreadID || got.IsRead {
+			t.Errorf("%s: got %+v, want %+v", want.recipient, got, want.Notification)
+		}
+	}
+
+	res, err := MarkNotificationsRead("author", &models.NotificationsRead{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Unread != 0 {
+		t.Errorf("got %d unread after marking all read", res.Unread)
+	}
+}
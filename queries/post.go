@@ -2,10 +2,12 @@ package queries
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 
 	"github.com/ArtAndreev/ForumTP/models"
@@ -34,7 +36,7 @@ func CreatePosts(p *models.PostList, path string) (*models.PostList, error) {
 	}
 	defer tx.Rollback()
 
-	ustmt, err := tx.Prepare("SELECT nickname FROM forum_user WHERE nickname = $1")
+	ustmt, err := tx.Prepare("SELECT nickname FROM forum_user WHERE nickname = $1 AND nickname <> '" + DeletedNickname + "'")
 	if err != nil {
 		return nil, err
 	}
@@ -44,11 +46,13 @@ func CreatePosts(p *models.PostList, path string) (*models.PostList, error) {
 		return nil, err
 	}
 	defer idstmt.Close()
-	poststmt, err := tx.Preparex("SELECT * FROM post WHERE post_id = $1")
+	poststmt, err := tx.Preparex(`SELECT post_id, forum, thread, parent, path, path1,
+		post_author, post_created, is_edited, post_message FROM post WHERE post_id = $1`)
 	if err != nil {
 		return nil, err
 	}
 	defer poststmt.Close()
+	replyTo := make([]string, len(*p))
 	for k, v := range *p {
 		// get user
 		err := ustmt.QueryRow(v.PostAuthor).Scan(&(*p)[k].PostAuthor)
@@ -75,6 +79,7 @@ func CreatePosts(p *models.PostList, path string) (*models.PostList, error) {
 				return nil, ErrParentPostIsNotInThisThread
 			}
 			(*p)[k].Path = parent.Path
+			replyTo[k] = parent.PostAuthor
 		}
 
 		// get new primary key id
@@ -115,14 +120,39 @@ func CreatePosts(p *models.PostList, path string) (*models.PostList, error) {
 	if err != nil {
 		return nil, err
 	}
+	data := make([]json.Marshaler, len(*p))
+	for k, v := range *p {
+		data[k] = v
+	}
+	err = enqueueWebhooks(tx, models.EventPostCreated, t.Forum, t.ThreadID, data...)
+	if err != nil {
+		return nil, err
+	}
+	err = notifyPosts(tx, t, *p, replyTo)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]change, len(*p))
+	for k, v := range *p {
+		changes[k] = change{postRecord(v.PostID), v}
+	}
+	err = recordChanges(tx, models.EventPostCreated, t.Forum, t.ThreadID, changes...)
+	if err != nil {
+		return nil, err
+	}
 
 	res := &models.PostList{}
 	*res = *p
 
-	err = tx.Commit()
+	err = commitChanges(tx)
+	forumCache.Delete(cacheKey(t.Forum)) // posts counter
+	for _, v := range *p {
+		forgetUser(v.PostAuthor)
+	}
 	if err != nil {
 		return res, err
 	}
+	publish(models.EventPostCreated, t.Forum, t.ThreadID, data...)
 
 	// insert without transaction!
 	uifstmt, err := db.Prepare(`
@@ -145,9 +175,10 @@ func CreatePosts(p *models.PostList, path string) (*models.PostList, error) {
 
 func GetPostByID(id int) (*models.Post, error) {
 	res := &models.Post{}
-	err := db.QueryRow("SELECT * FROM post WHERE post_id = $1", id).Scan(
+	err := db.QueryRow(`SELECT post_id, forum, thread, parent, path, path1,
+		post_author, post_created, is_edited, post_message, version FROM post WHERE post_id = $1`, id).Scan(
 		&res.PostID, &res.Forum, &res.Thread, &res.Parent, pq.Array(&res.Path), &res.Path1, &res.PostAuthor,
-		&res.PostCreated, &res.IsEdited, &res.PostMessage)
+		&res.PostCreated, &res.IsEdited, &res.PostMessage, &res.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return res, &RecordNotFoundError{"Post", fmt.Sprintf("%v", id)}
@@ -160,7 +191,7 @@ func GetPostByID(id int) (*models.Post, error) {
 
 func GetPostInfoByID(id int, params *[]string) (*models.PostInfo, error) {
 	q := strings.Builder{}
-	q.WriteString("SELECT post_id, p.forum forum_slug, thread, parent, post_author, post_created, is_edited, post_message")
+	q.WriteString("SELECT post_id, p.forum forum_slug, thread, parent, post_author, post_created, is_edited, post_message, p.version post_version")
 	queryArgs := make(map[string]bool, 3)
 	for _, v := range *params {
 		queryArgs[v] = true
@@ -169,10 +200,10 @@ func GetPostInfoByID(id int, params *[]string) (*models.PostInfo, error) {
 		q.WriteString(", u.about, u.email, u.fullname")
 	}
 	if _, ok := queryArgs["thread"]; ok {
-		q.WriteString(", thread_id, thread_slug, thread_title, thread_author, thread_created, thread_message, votes")
+		q.WriteString(", thread_id, thread_slug, thread_title, thread_author, thread_created, thread_message, votes, tags")
 	}
 	if _, ok := queryArgs["forum"]; ok {
-		q.WriteString(", forum_title, forum_user, threads, posts")
+		q.WriteString(", forum_title, forum_user, threads, posts, forum_parent, category, position")
 	}
 
 	q.WriteString(" FROM post p")
@@ -188,7 +219,9 @@ func GetPostInfoByID(id int, params *[]string) (*models.PostInfo, error) {
 	q.WriteString(" WHERE post_id = $1")
 
 	all := &models.PostInfoAllFields{}
-	err := db.QueryRowx(q.String(), id).StructScan(all)
+	err := onReplica(func(conn *sqlx.DB) error {
+		return conn.QueryRowx(q.String(), id).StructScan(all)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, &RecordNotFoundError{"Post", fmt.Sprintf("%v", id)}
@@ -201,11 +234,12 @@ func GetPostInfoByID(id int, params *[]string) (*models.PostInfo, error) {
 		PostID:      all.PostID,
 		Forum:       all.ForumSlug,
 		Thread:      all.Post.Thread,
-		Parent:      all.Parent,
+		Parent:      all.Post.Parent,
 		PostAuthor:  all.PostAuthor,
 		PostCreated: all.PostCreated,
 		IsEdited:    all.IsEdited,
 		PostMessage: all.PostMessage,
+		Version:     all.PostVersion,
 	}
 	if _, ok := queryArgs["user"]; ok {
 		res.Author = &models.ForumUser{
@@ -225,6 +259,7 @@ func GetPostInfoByID(id int, params *[]string) (*models.PostInfo, error) {
 			ThreadCreated: all.ThreadCreated,
 			ThreadMessage: all.ThreadMessage,
 			Votes:         all.Votes,
+			Tags:          all.Tags,
 		}
 	}
 	if _, ok := queryArgs["forum"]; ok {
@@ -234,6 +269,9 @@ func GetPostInfoByID(id int, params *[]string) (*models.PostInfo, error) {
 			ForumUser:  all.Forum.ForumUser,
 			Threads:    all.Threads,
 			Posts:      all.Posts,
+			Parent:     all.Forum.Parent,
+			Category:   all.Category,
+			Position:   all.Position,
 		}
 	}
 
@@ -244,31 +282,75 @@ func UpdatePostByID(id int, p *models.Post) (*models.Post, error) {
 	if p.PostMessage == "" {
 		return GetPostByID(id)
 	}
+	return updatePost(id, p, 0)
+}
+
+// UpdatePostIfUnchanged applies p to cur only if the post has not been
+// changed since cur was read, ErrRecordChanged is returned otherwise.
+func UpdatePostIfUnchanged(p *models.Post, cur *models.Post) (*models.Post, error) {
+	if p.PostMessage == "" {
+		return cur, nil
+	}
+	return updatePost(cur.PostID, p, cur.Version)
+}
+
+// updatePost checks the version of the post unless it is 0.
+func updatePost(id int, p *models.Post, version int) (*models.Post, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	res := &models.Post{}
-	err := db.Get(res,
+	err = tx.Get(res,
 		`UPDATE post SET 
 			post_message = $1, 
 			is_edited = CASE WHEN $1 <> (SELECT post_message FROM post WHERE post_id = $2) 
 				THEN TRUE 
 				ELSE FALSE
 			END 
-		WHERE post_id = $2
-		RETURNING post_id, forum, thread, parent, post_author, post_created, is_edited, post_message`,
-		p.PostMessage, id)
+		WHERE post_id = $2 AND ($3 = 0 OR version = $3)
+		RETURNING post_id, forum, thread, parent, post_author, post_created, is_edited, post_message, version`,
+		p.PostMessage, id, version)
+	if err == nil {
+		err = recordChanges(tx, models.EventPostUpdated, res.Forum, res.Thread, change{postRecord(id), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
+			if version != 0 {
+				return res, ErrRecordChanged
+			}
 			return res, &RecordNotFoundError{"Post", fmt.Sprintf("%v", id)}
 		}
 		return res, err
 	}
+	publish(models.EventPostUpdated, res.Forum, res.Thread, res)
 
 	return res, nil
 }
 
 func GetThreadPosts(slugOrID string, args *models.ThreadPostsQueryArgs) (*models.PostList, error) {
+	res := &models.PostList{}
+	err := StreamThreadPosts(slugOrID, args, func(p *models.Post) error {
+		*res = append(*res, *p)
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// StreamThreadPosts calls f for every post GetThreadPosts would return
+// without collecting them, p is reused between calls.
+func StreamThreadPosts(slugOrID string, args *models.ThreadPostsQueryArgs, f func(p *models.Post) error) error {
 	threadID, err := GetThreadIDBySlugOrID(slugOrID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	q := strings.Builder{}
 	q.WriteString(`SELECT p.post_id, p.forum, p.thread, p.parent, 
@@ -350,24 +432,18 @@ func GetThreadPosts(slugOrID string, args *models.ThreadPostsQueryArgs) (*models
 			}
 		}
 	}
-	res := &models.PostList{}
+	p := &models.Post{}
+	emit := func() error {
+		return f(p)
+	}
 	if args.Since > 0 {
 		if args.Limit > 0 {
-			err = db.Select(res, q.String(), threadID, args.Since, args.Limit)
-		} else {
-			err = db.Select(res, q.String(), threadID, args.Since)
-		}
-
-	} else {
-		if args.Limit > 0 {
-			err = db.Select(res, q.String(), threadID, args.Limit)
-		} else {
-			err = db.Select(res, q.String(), threadID)
+			return streamRows(p, emit, q.String(), threadID, args.Since, args.Limit)
 		}
+		return streamRows(p, emit, q.String(), threadID, args.Since)
 	}
-	if err != nil {
-		return res, err
+	if args.Limit > 0 {
+		return streamRows(p, emit, q.String(), threadID, args.Limit)
 	}
-
-	return res, nil
+	return streamRows(p, emit, q.String(), threadID)
 }
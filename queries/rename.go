@@ -0,0 +1,305 @@
+package queries
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// Nicknames are the keys other tables refer to, and their foreign keys
+// don't cascade updates. A rename creates the new user, moves the rows of
+// the old one over in batches of short transactions, so that writers are
+// never blocked for long, and deletes the old user at the end, see
+// 12_renames.sql. An interrupted rename is finished by the next call or by
+// FinishRenames.
+
+// The new user gets the e-mail of the old one at the end, until then it
+// has one in renamingDomain and reads don't show it.
+const (
+	renamingDomain = "@renaming.invalid"
+	notRenaming    = "email NOT LIKE '%" + renamingDomain + "'"
+)
+
+// renameBatch is how many rows a transaction of a rename or a deletion
+// moves.
+const renameBatch = 1000
+
+// nicknameRefs are the columns that refer to users. Rows of tables with a
+// key are unique per user and key: a row the new user already has makes
+// the one of the old user a duplicate.
+var nicknameRefs = []struct {
+	table, column, key string
+}{
+	{"forum", "forum_user", ""},
+	{"thread", "thread_author", ""},
+	{"post", "post_author", ""},
+	{"vote", "nickname", "thread"},
+	{"users_in_forum", "forum_user", "forum"},
+	{"thread_subscription", "nickname", "thread"},
+	{"forum_subscription", "nickname", "forum"},
+	{"notification", "recipient", ""},
+	{"notification", "actor", ""},
+}
+
+// RenameUser changes the nickname of the user n to nickname. The old
+// nickname redirects to the new one until another user takes it.
+// Nicknames that differ only in case are the same key, so such a change is
+// refused.
+func RenameUser(n, nickname string) (*models.ForumUser, error) {
+	if nickname == "" {
+		return nil, &NullFieldError{"User", "nickname"}
+	}
+	if strings.EqualFold(n, DeletedNickname) || strings.EqualFold(nickname, DeletedNickname) {
+		return nil, &ValidationError{"User", "nickname"}
+	}
+	if strings.EqualFold(n, nickname) {
+		res, err := GetUserByNickname(n)
+		if err == nil && res.Nickname != nickname {
+			return nil, &ValidationError{"User", "nickname"}
+		}
+		return res, err
+	}
+	old, err := startRename(n, nickname)
+	if err != nil {
+		return nil, err
+	}
+	return finishRename(old, nickname)
+}
+
+// startRename creates the new user, or finds the rename started before.
+// It returns the old nickname as it is stored.
+func startRename(n, nickname string) (string, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	old := ""
+	err = tx.Get(&old, "SELECT nickname FROM forum_user WHERE nickname = $1 FOR UPDATE", n)
+	if err == sql.ErrNoRows {
+		return "", &RecordNotFoundError{"User", n}
+	}
+	if err != nil {
+		return "", err
+	}
+	deleting := false
+	err = tx.Get(&deleting, "SELECT EXISTS (SELECT FROM user_deletion WHERE nickname = $1)", old)
+	if err != nil {
+		return "", err
+	}
+	if deleting {
+		return "", &RecordNotFoundError{"User", n}
+	}
+	started := ""
+	err = tx.Get(&started, `SELECT nickname FROM nickname_rename
+		WHERE old_nickname = $1 OR nickname = $1`, old)
+	switch {
+	case err == nil && strings.EqualFold(started, nickname):
+		return old, nil
+	case err == nil:
+		return "", ErrRenameInProgress
+	case err != sql.ErrNoRows:
+		return "", err
+	}
+
+	// an old nickname of someone else is free to take
+	_, err = tx.Exec("DELETE FROM nickname_redirect WHERE old_nickname = $1", nickname)
+	if err != nil {
+		return "", err
+	}
+	// the e-mail is unique, the new user gets it at the end
+	_, err = tx.Exec(`
+		INSERT INTO forum_user (nickname, fullname, email, about, signature, avatar, joined, last_seen)
+		SELECT $2, fullname, lower($2) || '`+renamingDomain+`', about, signature, avatar, joined, last_seen
+		FROM forum_user WHERE nickname = $1`, old, nickname)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == UniqueViolationCode {
+		return "", &UniqueFieldValueAlreadyExistsError{"User", "nickname"}
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("INSERT INTO nickname_rename (old_nickname, nickname) VALUES ($1, $2)", old, nickname)
+	if err != nil {
+		return "", err
+	}
+	return old, tx.Commit()
+}
+
+// moveBatch moves up to renameBatch rows of a column from old to nickname
+// and returns how many it moved. Duplicates are left to the last step.
+func moveBatch(old, nickname, table, column, key string) (int64, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// writers that refer to the new user wait for the batch, so a
+	// duplicate can't appear between the check and the update
+	_, err = tx.Exec("SELECT FROM forum_user WHERE nickname = $1 FOR UPDATE", nickname)
+	if err != nil {
+		return 0, err
+	}
+	q := strings.Builder{}
+	fmt.Fprintf(&q, `UPDATE %[1]s SET %[2]s = $2 WHERE ctid = ANY(ARRAY(
+		SELECT ctid FROM %[1]s o WHERE o.%[2]s = $1`, table, column)
+	if key != "" {
+		fmt.Fprintf(&q, `
+		AND NOT EXISTS (SELECT FROM %[1]s n WHERE n.%[2]s = $2 AND n.%[3]s = o.%[3]s)`, table, column, key)
+	}
+	fmt.Fprintf(&q, "\n\t\tLIMIT %d))", renameBatch)
+	res, err := tx.Exec(q.String(), old, nickname)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return moved, tx.Commit()
+}
+
+// addUserStats adds the counters of the user from to the ones of to, whose
+// threads and posts they are now.
+func addUserStats(tx *sqlx.Tx, from, to string) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_stats (nickname, threads, posts, votes)
+		SELECT $2, threads, posts, votes FROM user_stats WHERE nickname = $1
+		ON CONFLICT (nickname) DO UPDATE SET
+			threads = user_stats.threads + EXCLUDED.threads,
+			posts = user_stats.posts + EXCLUDED.posts,
+			votes = user_stats.votes + EXCLUDED.votes`, from, to)
+	return err
+}
+
+func finishRename(old, nickname string) (*models.ForumUser, error) {
+	for _, ref := range nicknameRefs {
+		for {
+			moved, err := moveBatch(old, nickname, ref.table, ref.column, ref.key)
+			if err != nil {
+				return nil, err
+			}
+			if moved < renameBatch {
+				break
+			}
+		}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// with both users locked nothing can refer to them until commit
+	locked := 0
+	err = tx.Get(&locked, `SELECT COUNT(*) FROM (SELECT FROM forum_user
+		WHERE nickname IN ($1, $2) ORDER BY nickname FOR UPDATE) u`, old, nickname)
+	if err != nil {
+		return nil, err
+	}
+	if locked != 2 {
+		// finished by someone else
+		return GetUserByNickname(nickname)
+	}
+
+	// a vote of the old user for a thread the new one voted for too is
+	// dropped, the trigger only counts inserts and updates
+	_, err = tx.Exec(`
+		WITH dropped AS (
+			DELETE FROM vote o USING vote n
+			WHERE o.nickname = $1 AND n.nickname = $2 AND n.thread = o.thread
+			RETURNING o.thread, o.voice
+		)
+		UPDATE thread t SET votes = t.votes - d.voice
+		FROM dropped d WHERE t.thread_id = d.thread`, old, nickname)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range nicknameRefs {
+		if ref.key != "" && ref.table != "vote" {
+			_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %[1]s o USING %[1]s n
+				WHERE o.%[2]s = $1 AND n.%[2]s = $2 AND n.%[3]s = o.%[3]s`, ref.table, ref.column, ref.key),
+				old, nickname)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// rows written since the batches
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %[1]s SET %[2]s = $2 WHERE %[2]s = $1", ref.table, ref.column),
+			old, nickname)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = addUserStats(tx, old, nickname); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("UPDATE nickname_redirect SET nickname = $2 WHERE nickname = $1", old, nickname)
+	if err != nil {
+		return nil, err
+	}
+	email := ""
+	err = tx.Get(&email, "DELETE FROM forum_user WHERE nickname = $1 RETURNING email", old)
+	if err != nil {
+		return nil, err
+	}
+	res := &models.ForumUser{}
+	err = tx.Get(res, "UPDATE forum_user SET email = $2 WHERE nickname = $1 RETURNING *", nickname, email)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT INTO nickname_redirect (old_nickname, nickname) VALUES ($1, $2)", old, res.Nickname)
+	if err != nil {
+		return nil, err
+	}
+	rename := &models.UserRename{OldNickname: old, Nickname: res.Nickname}
+	err = recordChanges(tx, models.EventUserRenamed, "", 0,
+		change{userRecord(old), rename}, change{userRecord(res.Nickname), rename})
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	// forums and threads are cached with their authors
+	purgeCaches()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// FinishRenames completes the renames an earlier process was interrupted
+// in.
+func FinishRenames() {
+	renames := []struct {
+		Old      string `db:"old_nickname"`
+		Nickname string
+	}{}
+	err := db.Select(&renames, "SELECT old_nickname, nickname FROM nickname_rename ORDER BY started")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, r := range renames {
+		log.Printf("renames: finishing %v to %v\n", r.Old, r.Nickname)
+		if _, err = finishRename(r.Old, r.Nickname); err != nil {
+			log.Printf("renames: %v to %v: %v\n", r.Old, r.Nickname, err)
+		}
+	}
+}
+
+// GetRenamedNickname returns the nickname of the user who was called n.
+func GetRenamedNickname(n string) (string, error) {
+	res := ""
+	err := db.Get(&res, "SELECT nickname FROM nickname_redirect WHERE old_nickname = $1", n)
+	if err == sql.ErrNoRows {
+		return "", &RecordNotFoundError{"User", n}
+	}
+	return res, err
+}
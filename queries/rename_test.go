@@ -0,0 +1,149 @@
+package queries
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func countRefs(t *testing.T, table, column, nickname string) int {
+	t.Helper()
+	n := 0
+	if err := db.Get(&n, fmt.Sprintf("SELECT count(*) FROM %s WHERE %s = $1", table, column), nickname); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRenameMovesEveryReference(t *testing.T) {
+	testDB(t)
+	testUser(t, "old")
+	testUser(t, "other")
+	testForum(t, "renames", "old")
+	th := testThread(t, "renames", "other")
+	id := strconv.Itoa(th.ThreadID)
+
+	// more rows than a batch moves: threads, posts mentioning other and
+	// votes for all the threads
+	many := renameBatch + 1
+	_, err := db.Exec(`INSERT INTO thread (forum, thread_title, thread_author, thread_message)
+		SELECT 'renames', 'title', 'old', 'message' FROM generate_series(1, $1)`, many)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := make(models.PostList, many)
+	for k := range posts {
+		posts[k] = models.Post{PostAuthor: "old", PostMessage: "hi @other"}
+	}
+	created, err := CreatePosts(&posts, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := models.PostList{{PostAuthor: "other", PostMessage: "reply", Parent: (*created)[0].PostID}}
+	if _, err = CreatePosts(&reply, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO vote (nickname, thread, voice) SELECT 'old', thread_id, 1 FROM thread"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = WatchThread("old", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = WatchForum("old", "renames"); err != nil {
+		t.Fatal(err)
+	}
+
+	before := make([]int, len(nicknameRefs))
+	for k, ref := range nicknameRefs {
+		if before[k] = countRefs(t, ref.table, ref.column, "old"); before[k] == 0 {
+			t.Fatalf("no rows of %s.%s to move", ref.table, ref.column)
+		}
+	}
+	stats, err := GetUserStats("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := RenameUser("old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Nickname != "new" || res.Email != "old@example.com" {
+		t.Errorf("got user %+v", res)
+	}
+	for k, ref := range nicknameRefs {
+		if n := countRefs(t, ref.table, ref.column, "old"); n != 0 {
+			t.Errorf("%s.%s: %d rows left with the old nickname", ref.table, ref.column, n)
+		}
+		if n := countRefs(t, ref.table, ref.column, "new"); n != before[k] {
+			t.Errorf("%s.%s: %d rows moved, want %d", ref.table, ref.column, n, before[k])
+		}
+	}
+	if got, err := GetRenamedNickname("OLD"); err != nil || got != "new" {
+		t.Errorf("old nickname redirects to %q, %v", got, err)
+	}
+	if _, err = GetUserByNickname("old"); err == nil {
+		t.Error("the old user is still there")
+	}
+	got, err := GetUserStats("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Threads != stats.Threads || got.Posts != stats.Posts || got.Votes != stats.Votes {
+		t.Errorf("got stats %+v, want the ones of the old user %+v", got, stats)
+	}
+}
+
+func TestProfileUpdateDoesNotRename(t *testing.T) {
+	testDB(t)
+	testUser(t, "Keeper")
+	if _, err := UpdateUser("keeper", &models.ForumUser{Nickname: "other", About: "a"}); err != ErrNicknameChanged {
+		t.Errorf("got %v, want %v", err, ErrNicknameChanged)
+	}
+	res, err := UpdateUser("keeper", &models.ForumUser{Nickname: "KEEPER", About: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Nickname != "KEEPER" || res.About != "a" {
+		t.Errorf("got user %+v, want the nickname in upper case", res)
+	}
+}
+
+func TestUnfinishedRenameIsHidden(t *testing.T) {
+	testDB(t)
+	testUser(t, "before")
+	testForum(t, "halfway", "before")
+	testThread(t, "halfway", "before")
+
+	old, err := startRename("before", "after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = moveBatch(old, "after", "users_in_forum", "forum_user", "forum"); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := GetUserByNickname("after"); err == nil {
+		t.Errorf("got the user %+v of an unfinished rename", u)
+	}
+	if s, err := GetUserStats("after"); err == nil {
+		t.Errorf("got stats %+v of an unfinished rename", s)
+	}
+	users, err := GetAllUsersInForum("halfway", &models.UserQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range *users {
+		if u.Nickname == "after" {
+			t.Errorf("got the user %+v of an unfinished rename in the forum", u)
+		}
+	}
+
+	if _, err = finishRename(old, "after"); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := GetUserByNickname("after"); err != nil || u.Email != "before@example.com" {
+		t.Errorf("got user %+v, %v after the rename", u, err)
+	}
+}
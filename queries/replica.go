@@ -0,0 +1,162 @@
+package queries
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Read-only queries that tolerate replication lag go to replicas. Writes
+// and reads that must see them (existence checks before inserts, reads
+// after updates) stay on the primary.
+
+type replica struct {
+	address string
+	db      *sqlx.DB
+	healthy int32
+}
+
+var (
+	replicas    []*replica
+	nextReplica uint32
+)
+
+// AddReplica registers a hot standby of the database. Connections are
+// read only, so a misrouted write fails instead of diverging.
+func AddReplica(address, database string) error {
+	r, err := sqlx.Open("postgres", dataSourceName(address, database)+"&default_transaction_read_only=on")
+	if err != nil {
+		return err
+	}
+	rep := &replica{address: address, db: r}
+	rep.check(time.Second)
+	replicas = append(replicas, rep)
+	return nil
+}
+
+// CheckReplicas pings replicas every interval, the ones that fail get no
+// queries until they answer again.
+func CheckReplicas(interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, r := range replicas {
+			r.check(interval / 2)
+		}
+	}
+}
+
+func (r *replica) check(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := r.db.PingContext(ctx)
+	if err != nil {
+		r.setHealthy(false, err)
+	} else {
+		r.setHealthy(true, nil)
+	}
+}
+
+func (r *replica) setHealthy(healthy bool, err error) {
+	v := int32(0)
+	if healthy {
+		v = 1
+	}
+	if atomic.SwapInt32(&r.healthy, v) == v {
+		return
+	}
+	if healthy {
+		log.Printf("replica %v is up\n", r.address)
+	} else {
+		log.Printf("replica %v is down, reading from the primary: %v\n", r.address, err)
+	}
+}
+
+// pickReplica returns the next healthy replica, nil if there is none.
+func pickReplica() *replica {
+	n := uint32(len(replicas))
+	for i := uint32(0); i < n; i++ {
+		r := replicas[atomic.AddUint32(&nextReplica, 1)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+// onReplica runs f on a replica and falls back to the primary when the
+// replica can't be reached. f must not have returned any rows to its
+// caller when it fails with a connection error, streams hide such errors
+// behind errStreamBroken.
+func onReplica(f func(q *sqlx.DB) error) error {
+	r := pickReplica()
+	if r == nil {
+		return f(db)
+	}
+	err := f(r.db)
+	if err != nil && isConnError(err) {
+		r.setHealthy(false, err)
+		return f(db)
+	}
+	return err
+}
+
+func isConnError(err error) bool {
+	if err == driver.ErrBadConn {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		// connection_exception, operator_intervention (e.g. the standby
+		// shutting down or being promoted)
+		return pqErr.Code.Class() == "08" || pqErr.Code.Class() == "57"
+	}
+	return false
+}
+
+type streamBrokenError struct {
+	err error
+}
+
+func (e streamBrokenError) Error() string {
+	return "stream broken: " + e.err.Error()
+}
+
+// errStreamBroken keeps onReplica from repeating a query whose rows have
+// been partly handed out already.
+func errStreamBroken(err error, sent bool) error {
+	if err == nil || !sent {
+		return err
+	}
+	return streamBrokenError{err}
+}
+
+// streamRows scans the rows of a query run on a replica into dest one by
+// one, calling emit after each.
+func streamRows(dest interface{}, emit func() error, query string, args ...interface{}) error {
+	return onReplica(func(q *sqlx.DB) error {
+		rows, err := q.Queryx(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		sent := false
+		for rows.Next() {
+			err = rows.StructScan(dest)
+			if err == nil {
+				sent = true
+				err = emit()
+			}
+			if err != nil {
+				return errStreamBroken(err, sent)
+			}
+		}
+		return errStreamBroken(rows.Err(), sent)
+	})
+}
@@ -0,0 +1,111 @@
+package queries
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// testReplica adds a replica that never catches up: a database of its own
+// with the schema and no rows, so any read that goes there misses what
+// the test wrote.
+func testReplica(t *testing.T) *replica {
+	t.Helper()
+	address, name := createTestDB(t)
+	primary := db
+	ConnectDB(address, name)
+	_, err := MigrateUp()
+	db.Close()
+	db = primary
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addTestReplica(t, address, name)
+}
+
+func addTestReplica(t *testing.T, address, name string) *replica {
+	t.Helper()
+	if err := AddReplica(address, name); err != nil {
+		t.Fatal(err)
+	}
+	r := replicas[len(replicas)-1]
+	t.Cleanup(func() {
+		r.db.Close()
+		replicas = nil
+	})
+	return r
+}
+
+func TestDeadReplicaFallsBackToPrimary(t *testing.T) {
+	testDB(t)
+	testUser(t, "primary")
+	testForum(t, "primary", "primary")
+	// nothing listens on port 1, the replica looks healthy until it is used
+	r := addTestReplica(t, "docker:docker@127.0.0.1:1", "docker")
+	atomic.StoreInt32(&r.healthy, 1)
+
+	status, err := GetDatabaseStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Forum != 1 {
+		t.Errorf("got status %+v, want the forum on the primary", status)
+	}
+	if atomic.LoadInt32(&r.healthy) != 0 {
+		t.Error("the dead replica is still marked healthy")
+	}
+}
+
+func TestWritesDontReadFromLaggingReplica(t *testing.T) {
+	testDB(t)
+	r := testReplica(t)
+	if atomic.LoadInt32(&r.healthy) != 1 {
+		t.Fatal("the replica is not healthy")
+	}
+
+	// every write below checks what the previous one made
+	testUser(t, "lagging")
+	testForum(t, "lagging", "lagging")
+	th := testThread(t, "lagging", "lagging")
+	id := strconv.Itoa(th.ThreadID)
+	posts := models.PostList{{PostAuthor: "lagging", PostMessage: "first"}}
+	created, err := CreatePosts(&posts, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := models.PostList{{PostAuthor: "lagging", PostMessage: "reply", Parent: (*created)[0].PostID}}
+	if _, err = CreatePosts(&reply, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VoteForPost(&models.Vote{Nickname: "lagging", Voice: 1}, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// reads right after the writes
+	if _, err = UpdateThread(&models.Thread{ThreadTitle: "renamed"}, id); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetThreadBySlugOrID(id); err != nil || got.ThreadTitle != "renamed" || got.Votes != 1 {
+		t.Errorf("got thread %+v, %v after the writes", got, err)
+	}
+	if _, err = UpdateUser("lagging", &models.ForumUser{About: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetUserByNickname("lagging"); err != nil || got.About != "updated" {
+		t.Errorf("got user %+v, %v after the update", got, err)
+	}
+	if got, err := GetForumBySlug("lagging"); err != nil || got.Threads != 1 || got.Posts != 2 {
+		t.Errorf("got forum %+v, %v after the writes", got, err)
+	}
+
+	// while reads that may lag do go to the replica
+	status, err := GetDatabaseStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Forum != 0 {
+		t.Errorf("got status %+v, want it read from the replica", status)
+	}
+}
@@ -1,6 +1,11 @@
 package queries
 
 import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
 	"github.com/ArtAndreev/ForumTP/models"
 )
 
@@ -30,22 +35,122 @@ func ClearDatabase() error {
 	if err != nil {
 		return err
 	}
+	_, err = tx.Exec("TRUNCATE TABLE category CASCADE")
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec("TRUNCATE TABLE forum_user CASCADE")
 	if err != nil {
 		return err
 	}
-	return tx.Commit()
+	// a cleared database is a new one, which has the placeholder
+	if err = createDeletedUser(tx); err != nil {
+		return err
+	}
+	// webhooks go with their forums, deliveries must not outlive them
+	_, err = tx.Exec("TRUNCATE TABLE webhook_outbox")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("TRUNCATE TABLE webhook_delivery")
+	if err != nil {
+		return err
+	}
+	// seq goes on, consumers of the feed must not miss the new events
+	_, err = tx.Exec("TRUNCATE TABLE events")
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	purgeCaches()
+	return err
 }
 
 func GetDatabaseStatus() (*models.Status, error) {
 	res := &models.Status{}
-	err := db.Get(res, `SELECT "user", forum, thread, post
-		FROM (SELECT COUNT(*) AS "user" FROM forum_user) a
-		CROSS JOIN (SELECT COUNT(*) AS forum FROM forum) b
-		CROSS JOIN (SELECT COUNT(*) AS thread FROM thread) c
-		CROSS JOIN (SELECT COUNT(*) AS post FROM post) d;`)
+	err := onReplica(func(q *sqlx.DB) error {
+		return q.Get(res, `SELECT "user", forum, thread, post
+			FROM (SELECT COUNT(*) AS "user" FROM forum_user
+				WHERE nickname <> '`+DeletedNickname+`' AND `+notRenaming+`) a
+			CROSS JOIN (SELECT COUNT(*) AS forum FROM forum) b
+			CROSS JOIN (SELECT COUNT(*) AS thread FROM thread) c
+			CROSS JOIN (SELECT COUNT(*) AS post FROM post) d;`)
+	})
 	if err != nil {
 		return res, err
 	}
 	return res, nil
 }
+
+// RecountCounters rebuilds denormalized counters and users_in_forum from
+// the source tables, e.g. after manual data fixes.
+func RecountCounters() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = recountCounters(tx, nil, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	purgeCaches()
+	return err
+}
+
+// recountCounters rebuilds the counters of the forums and their threads,
+// the stats of the users and the members of the forums from the source
+// tables. Nil forums rebuild all of them.
+func recountCounters(tx *sql.Tx, forums, users []string) error {
+	forumsOnly, threadsOnly, usersOnly, membersOnly := "", "", "", ""
+	scope, userScope, memberArgs := []interface{}{}, []interface{}{}, []interface{}{DeletedNickname}
+	if forums != nil {
+		forumsOnly = "WHERE forum_slug = ANY($1::citext[])"
+		threadsOnly = "WHERE forum = ANY($1::citext[])"
+		usersOnly = "WHERE u.nickname = ANY($1::citext[])"
+		membersOnly = "AND forum = ANY($2::citext[])"
+		scope = append(scope, pq.Array(forums))
+		userScope = append(userScope, pq.Array(users))
+		memberArgs = append(memberArgs, pq.Array(forums))
+	}
+	_, err := tx.Exec(`UPDATE forum f SET
+		threads = (SELECT COUNT(*) FROM thread t WHERE t.forum = f.forum_slug),
+		posts = (SELECT COUNT(*) FROM post p WHERE p.forum = f.forum_slug)
+		`+forumsOnly, scope...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE thread t SET
+		votes = COALESCE((SELECT SUM(voice) FROM vote v WHERE v.thread = t.thread_id), 0)
+		`+threadsOnly, scope...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO user_stats (nickname, threads, posts, votes)
+		SELECT u.nickname,
+			(SELECT COUNT(*) FROM thread WHERE thread_author = u.nickname),
+			(SELECT COUNT(*) FROM post WHERE post_author = u.nickname),
+			COALESCE((SELECT SUM(votes) FROM thread WHERE thread_author = u.nickname), 0)
+		FROM forum_user u `+usersOnly+`
+		ON CONFLICT (nickname) DO UPDATE SET
+			threads = EXCLUDED.threads, posts = EXCLUDED.posts, votes = EXCLUDED.votes`, userScope...)
+	if err != nil {
+		return err
+	}
+	// the placeholder of deleted users is no member of forums
+	_, err = tx.Exec(`DELETE FROM users_in_forum m
+		WHERE (forum_user = $1
+			OR NOT EXISTS (SELECT 1 FROM thread WHERE thread_author = m.forum_user AND forum = m.forum)
+			AND NOT EXISTS (SELECT 1 FROM post WHERE post_author = m.forum_user AND forum = m.forum))
+		`+membersOnly, memberArgs...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO users_in_forum (forum_user, forum)
+		SELECT thread_author, forum FROM thread WHERE thread_author <> $1 `+membersOnly+`
+		UNION
+		SELECT post_author, forum FROM post WHERE post_author <> $1 `+membersOnly+`
+		ON CONFLICT (forum_user, forum) DO NOTHING`, memberArgs...)
+	return err
+}
@@ -0,0 +1,46 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestStatusOfNewAndClearedDatabase(t *testing.T) {
+	testDB(t)
+	empty := func(when string) {
+		t.Helper()
+		status, err := GetDatabaseStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *status != (models.Status{}) {
+			t.Errorf("got status %+v of a %s database", status, when)
+		}
+		if _, err = GetUserByNickname(DeletedNickname); err != nil {
+			t.Errorf("no placeholder in a %s database: %v", when, err)
+		}
+	}
+	empty("new")
+
+	testUser(t, "counted")
+	testForum(t, "counted", "counted")
+	th := testThread(t, "counted", "counted")
+	posts := models.PostList{{PostAuthor: "counted", PostMessage: "m"}}
+	if _, err := CreatePosts(&posts, strconv.Itoa(th.ThreadID)); err != nil {
+		t.Fatal(err)
+	}
+	status, err := GetDatabaseStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (models.Status{User: 1, Forum: 1, Thread: 1, Post: 1}); *status != want {
+		t.Errorf("got status %+v, want %+v", status, want)
+	}
+
+	if err = ClearDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	empty("cleared")
+}
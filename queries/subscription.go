@@ -0,0 +1,276 @@
+package queries
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// WatchThread subscribes a user to a thread, posts written before count
+// as read. created is false if the thread was watched already.
+func WatchThread(nickname, slugOrID string) (res *models.WatchedThread, created bool, err error) {
+	u, err := GetUserByNickname(nickname)
+	if err != nil {
+		return nil, false, err
+	}
+	t, err := GetThreadBySlugOrID(slugOrID)
+	if err != nil {
+		return nil, false, err
+	}
+	r, err := db.Exec(`
+		INSERT INTO thread_subscription (nickname, thread, last_read)
+		VALUES ($1, $2, (SELECT COALESCE(MAX(post_id), 0) FROM post WHERE thread = $2))
+		ON CONFLICT (nickname, thread) DO NOTHING`,
+		u.Nickname, t.ThreadID)
+	if err != nil {
+		return nil, false, err
+	}
+	n, _ := r.RowsAffected()
+	res, err = getWatchedThread(u.Nickname, t)
+	return res, n != 0, err
+}
+
+func UnwatchThread(nickname, slugOrID string) error {
+	threadID, err := GetThreadIDBySlugOrID(slugOrID)
+	if err != nil {
+		return err
+	}
+	r, err := db.Exec("DELETE FROM thread_subscription WHERE nickname = $1 AND thread = $2", nickname, threadID)
+	if err != nil {
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return &RecordNotFoundError{"Subscription", nickname + " to thread " + strconv.Itoa(threadID)}
+	}
+	return nil
+}
+
+// MarkThreadRead moves the read marker of a watched thread to post, 0
+// means the last post.
+func MarkThreadRead(nickname, slugOrID string, post int) (*models.WatchedThread, error) {
+	t, err := GetThreadBySlugOrID(slugOrID)
+	if err != nil {
+		return nil, err
+	}
+	if post != 0 {
+		thread := 0
+		err = db.Get(&thread, "SELECT thread FROM post WHERE post_id = $1", post)
+		if err == sql.ErrNoRows || (err == nil && thread != t.ThreadID) {
+			return nil, ErrPostIsNotInThisThread
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	u := ""
+	err = db.Get(&u, `
+		UPDATE thread_subscription SET last_read = CASE WHEN $3 = 0
+			THEN (SELECT COALESCE(MAX(post_id), 0) FROM post WHERE thread = $2)
+			ELSE $3
+		END
+		WHERE nickname = $1 AND thread = $2 RETURNING nickname`,
+		nickname, t.ThreadID, post)
+	if err != nil {
+		return nil, notWatched(err, nickname, "thread "+strconv.Itoa(t.ThreadID))
+	}
+	return getWatchedThread(u, t)
+}
+
+func getWatchedThread(nickname string, t *models.Thread) (*models.WatchedThread, error) {
+	res := &models.WatchedThread{Thread: t}
+	err := db.QueryRow(`
+		SELECT s.last_read, (SELECT COUNT(*) FROM post p
+			WHERE p.thread = s.thread AND p.post_id > s.last_read AND p.post_author <> s.nickname)
+		FROM thread_subscription s WHERE s.nickname = $1 AND s.thread = $2`,
+		nickname, t.ThreadID).Scan(&res.LastRead, &res.Unread)
+	if err != nil {
+		return nil, notWatched(err, nickname, "thread "+strconv.Itoa(t.ThreadID))
+	}
+	return res, nil
+}
+
+// WatchForum subscribes a user to the new threads of a forum. created is
+// false if the forum was watched already.
+func WatchForum(nickname, slug string) (res *models.Forum, created bool, err error) {
+	u, err := GetUserByNickname(nickname)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err = GetForumBySlug(slug)
+	if err != nil {
+		return nil, false, err
+	}
+	r, err := db.Exec(`INSERT INTO forum_subscription (nickname, forum) VALUES ($1, $2)
+		ON CONFLICT (nickname, forum) DO NOTHING`, u.Nickname, res.ForumSlug)
+	if err != nil {
+		return nil, false, err
+	}
+	n, _ := r.RowsAffected()
+	return res, n != 0, nil
+}
+
+func UnwatchForum(nickname, slug string) error {
+	if err := CheckExistenceOfForum(slug); err != nil {
+		return err
+	}
+	r, err := db.Exec("DELETE FROM forum_subscription WHERE nickname = $1 AND forum = $2", nickname, slug)
+	if err != nil {
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return &RecordNotFoundError{"Subscription", nickname + " to forum " + slug}
+	}
+	return nil
+}
+
+func GetWatchList(nickname string) (*models.WatchList, error) {
+	u, err := GetUserByNickname(nickname)
+	if err != nil {
+		return nil, err
+	}
+	res := &models.WatchList{Threads: []models.WatchedThread{}, Forums: []models.Forum{}}
+
+	rows, err := db.Queryx(`
+		SELECT t.*, s.last_read, (SELECT COUNT(*) FROM post p
+			WHERE p.thread = s.thread AND p.post_id > s.last_read AND p.post_author <> s.nickname) AS unread
+		FROM thread_subscription s JOIN thread t ON t.thread_id = s.thread
+		WHERE s.nickname = $1 ORDER BY t.thread_id`, u.Nickname)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		w := struct {
+			models.Thread
+			LastRead int `db:"last_read"`
+			Unread   int
+		}{}
+		if err = rows.StructScan(&w); err != nil {
+			return nil, err
+		}
+		t := w.Thread
+		res.Threads = append(res.Threads, models.WatchedThread{Thread: &t, LastRead: w.LastRead, Unread: w.Unread})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = db.Select(&res.Forums, `SELECT f.* FROM forum_subscription s JOIN forum f ON f.forum_slug = s.forum
+		WHERE s.nickname = $1 ORDER BY f.forum_slug`, u.Nickname)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetFeed returns the threads of watched forums and posts of watched
+// threads not written by the user, newest first, starting after cursor.
+func GetFeed(nickname string, cursor *models.FeedCursor, limit uint64) (*models.FeedItemList, error) {
+	u, err := GetUserByNickname(nickname)
+	if err != nil {
+		return nil, err
+	}
+	if cursor.Created.IsZero() {
+		// later than anything
+		cursor = &models.FeedCursor{Created: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), Type: "~"}
+	}
+
+	type key struct {
+		Type    string
+		ID      int
+		Created time.Time
+	}
+	// every branch takes at most limit items after the cursor on its own,
+	// see 18_feed_order.sql
+	keys := []key{}
+	err = db.Select(&keys, `
+		SELECT type, id, created FROM ((
+			SELECT 'thread' AS type, t.thread_id AS id, COALESCE(t.thread_created, 'epoch') AS created
+			FROM forum_subscription s JOIN thread t ON t.forum = s.forum
+			WHERE s.nickname = $1 AND t.thread_author <> $1
+				AND (COALESCE(t.thread_created, 'epoch'), t.thread_id) < ($2, $3)
+			ORDER BY 3 DESC, 2 DESC
+			LIMIT $5
+		) UNION ALL (
+			SELECT 'post', p.post_id, COALESCE(p.post_created, 'epoch')
+			FROM thread_subscription s JOIN post p ON p.thread = s.thread
+			WHERE s.nickname = $1 AND p.post_author <> $1
+				AND (COALESCE(p.post_created, 'epoch'), p.post_id) < ($2, $4)
+			ORDER BY 3 DESC, 2 DESC
+			LIMIT $5
+		)) f
+		ORDER BY created DESC, type DESC, id DESC
+		LIMIT $5`,
+		u.Nickname, cursor.Created, feedBound(cursor, models.FeedThread), feedBound(cursor, models.FeedPost), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	threadIDs, postIDs := []int64{}, []int64{}
+	for _, k := range keys {
+		if k.Type == models.FeedThread {
+			threadIDs = append(threadIDs, int64(k.ID))
+		} else {
+			postIDs = append(postIDs, int64(k.ID))
+		}
+	}
+	threads := map[int]*models.Thread{}
+	if len(threadIDs) != 0 {
+		list := models.ThreadList{}
+		err = db.Select(&list, "SELECT * FROM thread WHERE thread_id = ANY($1)", pq.Array(threadIDs))
+		if err != nil {
+			return nil, err
+		}
+		for k := range list {
+			threads[list[k].ThreadID] = &list[k]
+		}
+	}
+	posts := map[int]*models.Post{}
+	if len(postIDs) != 0 {
+		list := models.PostList{}
+		err = db.Select(&list, `SELECT post_id, forum, thread, parent, post_author, post_created,
+			is_edited, post_message FROM post WHERE post_id = ANY($1)`, pq.Array(postIDs))
+		if err != nil {
+			return nil, err
+		}
+		for k := range list {
+			posts[list[k].PostID] = &list[k]
+		}
+	}
+
+	res := make(models.FeedItemList, 0, len(keys))
+	for _, k := range keys {
+		if k.Type == models.FeedThread {
+			res = append(res, models.FeedItem{Type: k.Type, Thread: threads[k.ID]})
+		} else {
+			res = append(res, models.FeedItem{Type: k.Type, Post: posts[k.ID]})
+		}
+	}
+	return &res, nil
+}
+
+// feedBound is the id items of type created at the time of the cursor
+// must be below to come after it: the feed is ordered by time, type and
+// id, all descending.
+func feedBound(cursor *models.FeedCursor, typ string) int {
+	switch {
+	case cursor.Type > typ:
+		return math.MaxInt32
+	case cursor.Type == typ:
+		return cursor.ID
+	default:
+		return 0
+	}
+}
+
+func notWatched(err error, nickname, what string) error {
+	if err == sql.ErrNoRows {
+		return &RecordNotFoundError{"Subscription", nickname + " to " + what}
+	}
+	return err
+}
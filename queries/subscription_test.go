@@ -0,0 +1,119 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestFeedPagesDontOverlap(t *testing.T) {
+	testDB(t)
+	testUser(t, "watcher")
+	testUser(t, "writer")
+	testForum(t, "watched", "writer")
+	watched := testThread(t, "watched", "writer")
+	id := strconv.Itoa(watched.ThreadID)
+	if _, _, err := WatchForum("watcher", "watched"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := WatchThread("watcher", id); err != nil {
+		t.Fatal(err)
+	}
+
+	// threads and posts created at the same time, so only the type and the
+	// id order them
+	created := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	for k := 0; k < 3; k++ {
+		_, err := CreateThread(&models.Thread{Forum: "watched", ThreadTitle: "t", ThreadAuthor: "writer",
+			ThreadMessage: "m", ThreadCreated: &created})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	posts := models.PostList{{PostAuthor: "writer", PostMessage: "1"}, {PostAuthor: "writer", PostMessage: "2"},
+		{PostAuthor: "watcher", PostMessage: "own"}, {PostAuthor: "writer", PostMessage: "3"}}
+	if _, err := CreatePosts(&posts, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE post SET post_created = $1", created); err != nil {
+		t.Fatal(err)
+	}
+	all, err := GetFeed("watcher", &models.FeedCursor{}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the watched thread, the new ones and the posts of the writer
+	if len(*all) != 7 {
+		t.Fatalf("got %d items, want 7", len(*all))
+	}
+
+	for _, limit := range []uint64{1, 2, 3} {
+		got := models.FeedItemList{}
+		cursor := &models.FeedCursor{}
+		for len(got) <= len(*all) {
+			page, err := GetFeed("watcher", cursor, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, *page...)
+			if uint64(len(*page)) < limit {
+				break
+			}
+			last := (*page)[len(*page)-1]
+			cursor = &models.FeedCursor{Type: last.Type}
+			if last.Thread != nil {
+				cursor.ID, cursor.Created = last.Thread.ThreadID, *last.Thread.ThreadCreated
+			} else {
+				cursor.ID, cursor.Created = last.Post.PostID, last.Post.PostCreated
+			}
+		}
+		if len(got) != len(*all) {
+			t.Errorf("limit %d: got %d items, want %d", limit, len(got), len(*all))
+			continue
+		}
+		for k := range got {
+			if feedID(got[k]) != feedID((*all)[k]) {
+				t.Errorf("limit %d: item %d is %s, want %s", limit, k, feedID(got[k]), feedID((*all)[k]))
+			}
+		}
+	}
+}
+
+func feedID(item models.FeedItem) string {
+	if item.Thread != nil {
+		return "thread " + strconv.Itoa(item.Thread.ThreadID)
+	}
+	return "post " + strconv.Itoa(item.Post.PostID)
+}
+
+func TestMarkThreadReadRejectsPostOfOtherThread(t *testing.T) {
+	testDB(t)
+	testUser(t, "reader")
+	testForum(t, "reading", "reader")
+	th := testThread(t, "reading", "reader")
+	other := testThread(t, "reading", "reader")
+	posts := models.PostList{{PostAuthor: "reader", PostMessage: "elsewhere"}}
+	created, err := CreatePosts(&posts, strconv.Itoa(other.ThreadID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(th.ThreadID)
+	if _, _, err = WatchThread("reader", id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, post := range []int{(*created)[0].PostID, 2147483647} {
+		if _, err = MarkThreadRead("reader", id, post); err != ErrPostIsNotInThisThread {
+			t.Errorf("post %d: got %v, want %v", post, err, ErrPostIsNotInThisThread)
+		}
+	}
+	res, err := MarkThreadRead("reader", id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.LastRead != 0 {
+		t.Errorf("got last read %d of a thread without posts", res.LastRead)
+	}
+}
@@ -0,0 +1,91 @@
+package queries
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func TestTagListsFollowUpdates(t *testing.T) {
+	testDB(t)
+	testUser(t, "tagger")
+	testForum(t, "tagged", "tagger")
+	testForum(t, "elsewhere", "tagger")
+	ids := []int{}
+	for _, tags := range [][]string{{"Go", "db"}, {"go"}, {"db", "GO", "go"}} {
+		th, err := CreateThread(&models.Thread{Forum: "tagged", ThreadTitle: "t", ThreadAuthor: "tagger",
+			ThreadMessage: "m", Tags: tags})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, th.ThreadID)
+	}
+	if _, err := CreateThread(&models.Thread{Forum: "elsewhere", ThreadTitle: "t", ThreadAuthor: "tagger",
+		ThreadMessage: "m", Tags: []string{"go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := func(tag string, desc bool) []int {
+		t.Helper()
+		list, err := GetAllThreadsInForum("TAGGED", &models.ThreadQueryParams{Tag: tag, Desc: desc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := []int{}
+		for _, th := range *list {
+			res = append(res, th.ThreadID)
+		}
+		return res
+	}
+	cloud := func() models.TagCountList {
+		t.Helper()
+		list, err := GetForumTags("tagged", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *list
+	}
+
+	if got := tagged("GO", false); !equalIDs(got, ids) {
+		t.Errorf("got threads %v tagged go, want %v", got, ids)
+	}
+	if got := tagged("go", true); !equalIDs(got, reversed(ids)) {
+		t.Errorf("got threads %v tagged go in reverse, want %v", got, reversed(ids))
+	}
+	if got, want := cloud(), (models.TagCountList{{Tag: "go", Threads: 3}, {Tag: "db", Threads: 2}}); !equalTags(got, want) {
+		t.Errorf("got tags %+v, want %+v", got, want)
+	}
+
+	// the tag is removed from one thread and all tags from another
+	id := strconv.Itoa(ids[0])
+	if _, err := UpdateThread(&models.Thread{Tags: pq.StringArray{"db"}}, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateThread(&models.Thread{Tags: pq.StringArray{}}, strconv.Itoa(ids[2])); err != nil {
+		t.Fatal(err)
+	}
+	if got := tagged("go", false); !equalIDs(got, ids[1:2]) {
+		t.Errorf("got threads %v tagged go after the updates, want %v", got, ids[1:2])
+	}
+	if got := tagged("db", false); !equalIDs(got, ids[:1]) {
+		t.Errorf("got threads %v tagged db after the updates, want %v", got, ids[:1])
+	}
+	if got, want := cloud(), (models.TagCountList{{Tag: "db", Threads: 1}, {Tag: "go", Threads: 1}}); !equalTags(got, want) {
+		t.Errorf("got tags %+v after the updates, want %+v", got, want)
+	}
+}
+
+func equalTags(a, b models.TagCountList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
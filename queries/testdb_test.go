@@ -0,0 +1,93 @@
+package queries
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// Tests that need PostgreSQL run against the server in FORUM_TEST_DB,
+// user:password@host:port of a role that may create databases, and are
+// skipped without it. Every test gets a database of its own.
+
+// createTestDB makes an empty database that is dropped after the test.
+// The name is deliberately not a plain identifier, nothing may depend on
+// the database being called "docker".
+func createTestDB(t *testing.T) (address, name string) {
+	t.Helper()
+	address = os.Getenv("FORUM_TEST_DB")
+	if address == "" {
+		t.Skip("FORUM_TEST_DB is not set")
+	}
+	name = fmt.Sprintf("Forum test-%s-%d", strings.ReplaceAll(t.Name(), "/", "-"), time.Now().UnixNano())
+	if len(name) > 63 {
+		name = name[len(name)-63:]
+	}
+
+	admin, err := sqlx.Open("postgres", dataSourceName(address, "postgres"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = admin.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if db != nil {
+			db.Close()
+		}
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name)); err != nil {
+			t.Error(err)
+		}
+		admin.Close()
+	})
+	return address, name
+}
+
+// testDB connects the package to a new database with the schema applied.
+func testDB(t *testing.T) {
+	t.Helper()
+	address, name := createTestDB(t)
+	ConnectDB(address, name)
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testUser(t *testing.T, nickname string) *models.ForumUser {
+	t.Helper()
+	res, err := CreateUser(&models.ForumUser{
+		Nickname: nickname,
+		Fullname: nickname,
+		Email:    nickname + "@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &(*res)[0]
+}
+
+func testForum(t *testing.T, slug, user string) *models.Forum {
+	t.Helper()
+	res, err := CreateForum(&models.Forum{ForumSlug: slug, ForumTitle: slug, ForumUser: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func testThread(t *testing.T, forum, author string) *models.Thread {
+	t.Helper()
+	res, err := CreateThread(&models.Thread{Forum: forum, ThreadTitle: "title", ThreadAuthor: author, ThreadMessage: "message"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
@@ -5,28 +5,85 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 
 	"github.com/ArtAndreev/ForumTP/models"
 )
 
+// Limits of the tags of a thread.
+const (
+	maxThreadTags = 10
+	maxTagLength  = 32
+)
+
+// normalizeTags lower-cases tags and drops repeated ones. A tag is a
+// single word, so that it can be passed in a query.
+func normalizeTags(tags []string) (pq.StringArray, error) {
+	res := make(pq.StringArray, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.ContainsAny(tag, ", \t\n") {
+			return nil, &ValidationError{"Thread", "tags"}
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			res = append(res, tag)
+		}
+	}
+	if len(res) > maxThreadTags {
+		return nil, &ValidationError{"Thread", "tags"}
+	}
+	return res, nil
+}
+
 func CreateThread(t *models.Thread) (*models.Thread, error) {
 	if t.Forum == "" || t.ThreadTitle == "" || t.ThreadAuthor == "" {
 		return nil, &NullFieldError{"Thread", "some value(-s) is/are null"}
 	}
+	tags, err := normalizeTags(t.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
 	res := &models.Thread{}
-	err := db.Get(res, `
-		INSERT INTO thread (forum, thread_slug, thread_title, thread_author, thread_created, thread_message)
+	err = tx.Get(res, `
+		INSERT INTO thread (forum, thread_slug, thread_title, thread_author, thread_created, thread_message, tags)
 		VALUES (
 			(SELECT forum_slug FROM forum WHERE forum_slug = $1), $2, $3, 
-			(SELECT nickname FROM forum_user WHERE nickname = $4), $5, $6
+			(SELECT nickname FROM forum_user WHERE nickname = $4 AND nickname <> '`+DeletedNickname+`'), $5, $6, $7
 		) RETURNING *`,
-		t.Forum, t.ThreadSlug, t.ThreadTitle, t.ThreadAuthor, t.ThreadCreated, t.ThreadMessage)
+		t.Forum, t.ThreadSlug, t.ThreadTitle, t.ThreadAuthor, t.ThreadCreated, t.ThreadMessage, tags)
+	if err == nil {
+		err = notifyThreadMentions(tx, res)
+	}
+	if err == nil {
+		err = enqueueWebhooks(tx, models.EventThreadCreated, res.Forum, res.ThreadID, res)
+	}
+	if err == nil {
+		err = recordChanges(tx, models.EventThreadCreated, res.Forum, res.ThreadID, change{threadRecord(res.ThreadID), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	if err == nil {
+		forumCache.Delete(cacheKey(res.Forum)) // threads counter
+		forgetUser(res.ThreadAuthor)
+	}
 	if err != nil {
-		pqErr := err.(*pq.Error)
+		pqErr, ok := err.(*pq.Error)
+		if !ok {
+			return res, err
+		}
 		switch pqErr.Code {
 		case UniqueViolationCode:
 			if strings.HasPrefix(pqErr.Detail, "Key (thread_slug)") {
@@ -46,6 +103,7 @@ func CreateThread(t *models.Thread) (*models.Thread, error) {
 		}
 		return res, err
 	}
+	publish(models.EventThreadCreated, res.Forum, res.ThreadID, res)
 
 	_, err = db.Exec(`INSERT INTO users_in_forum (forum_user, forum) 
 		VALUES (
@@ -60,6 +118,9 @@ func CreateThread(t *models.Thread) (*models.Thread, error) {
 }
 
 func GetThreadByID(id int) (*models.Thread, error) {
+	if res, ok := cachedThread(id); ok {
+		return res, nil
+	}
 	res := &models.Thread{}
 	err := db.Get(res, "SELECT * FROM thread WHERE thread_id = $1", id)
 	if err != nil {
@@ -68,10 +129,14 @@ func GetThreadByID(id int) (*models.Thread, error) {
 		}
 		return res, err
 	}
+	cacheThread(res)
 	return res, nil
 }
 
 func GetThreadBySlug(s string) (*models.Thread, error) {
+	if id, ok := threadSlugCache.Get(cacheKey(s)); ok {
+		return GetThreadByID(id.(int))
+	}
 	res := &models.Thread{}
 	err := db.Get(res, "SELECT * FROM thread WHERE thread_slug = $1", s)
 	if err != nil {
@@ -80,6 +145,7 @@ func GetThreadBySlug(s string) (*models.Thread, error) {
 		}
 		return res, err
 	}
+	cacheThread(res)
 	return res, nil
 }
 
@@ -103,6 +169,9 @@ func GetThreadBySlugOrID(slugOrID string) (*models.Thread, error) {
 }
 
 func GetThreadIDByID(id int) (int, error) {
+	if _, ok := cachedThread(id); ok {
+		return id, nil
+	}
 	res := 0
 	err := db.Get(&res, "SELECT thread_id FROM thread WHERE thread_id = $1", id)
 	if err != nil {
@@ -115,6 +184,9 @@ func GetThreadIDByID(id int) (int, error) {
 }
 
 func GetThreadIDBySlug(s string) (int, error) {
+	if id, ok := threadSlugCache.Get(cacheKey(s)); ok {
+		return id.(int), nil
+	}
 	res := 0
 	err := db.Get(&res, "SELECT thread_id FROM thread WHERE thread_slug = $1", s)
 	if err != nil {
@@ -123,6 +195,7 @@ func GetThreadIDBySlug(s string) (int, error) {
 		}
 		return res, err
 	}
+	threadSlugCache.Set(cacheKey(s), res)
 	return res, nil
 }
 
@@ -146,36 +219,84 @@ func GetThreadIDBySlugOrID(slugOrID string) (int, error) {
 }
 
 func GetAllThreadsInForum(s string, params *models.ThreadQueryParams) (*models.ThreadList, error) {
-	err := CheckExistenceOfForum(s)
+	res := &models.ThreadList{}
+	err := StreamThreadsInForum(s, params, func(t *models.Thread) error {
+		*res = append(*res, *t)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return res, nil
+}
 
+// StreamThreadsInForum calls f for every thread GetAllThreadsInForum would
+// return without collecting them, t is reused between calls.
+func StreamThreadsInForum(s string, params *models.ThreadQueryParams, f func(t *models.Thread) error) error {
+	err := CheckExistenceOfForum(s)
+	if err != nil {
+		return err
+	}
+
+	// threads of a tag are read in the order of the index on thread_tag
 	q := strings.Builder{}
-	q.WriteString("SELECT * FROM thread WHERE forum = $1 ")
-	var nt time.Time
-	if params.Since != nt {
-		if params.Desc {
-			q.WriteString("AND thread_created <= $2\n")
-		} else {
-			q.WriteString("AND thread_created >= $2\n")
+	args := []interface{}{s}
+	prefix := "thread"
+	if params.Tag != "" {
+		prefix = "thread_tag"
+		args = append(args, strings.ToLower(params.Tag))
+		q.WriteString("SELECT thread.* FROM thread_tag JOIN thread USING (thread_id) WHERE thread_tag.forum = $1 AND tag = $2\n")
+	} else {
+		q.WriteString("SELECT * FROM thread WHERE forum = $1\n")
+	}
+	if !params.Since.IsZero() {
+		args = append(args, params.Since)
+		n := len(args)
+		switch {
+		case params.SinceID != 0 && params.Desc:
+			args = append(args, params.SinceID)
+			fmt.Fprintf(&q, "AND (%[1]s.thread_created, %[1]s.thread_id) < ($%[2]d, $%[3]d)\n", prefix, n, n+1)
+		case params.SinceID != 0:
+			args = append(args, params.SinceID)
+			fmt.Fprintf(&q, "AND (%[1]s.thread_created, %[1]s.thread_id) > ($%[2]d, $%[3]d)\n", prefix, n, n+1)
+		case params.Desc:
+			fmt.Fprintf(&q, "AND %[1]s.thread_created <= $%[2]d\n", prefix, n)
+		default:
+			fmt.Fprintf(&q, "AND %[1]s.thread_created >= $%[2]d\n", prefix, n)
 		}
 	}
-	q.WriteString("ORDER BY thread_created ")
+	// the id breaks ties, so pages never overlap
 	if params.Desc {
-		q.WriteString("DESC")
+		fmt.Fprintf(&q, "ORDER BY %[1]s.thread_created DESC, %[1]s.thread_id DESC", prefix)
+	} else {
+		fmt.Fprintf(&q, "ORDER BY %[1]s.thread_created, %[1]s.thread_id", prefix)
 	}
 	if params.Limit != 0 {
-		q.WriteString(fmt.Sprintf("\nLIMIT %v", params.Limit))
+		fmt.Fprintf(&q, "\nLIMIT %v", params.Limit)
 	}
-	res := &models.ThreadList{}
-	if params.Since == nt {
-		err = db.Select(res, q.String(), s)
-	} else {
-		err = db.Select(res, q.String(), s, params.Since)
+	t := &models.Thread{}
+	return streamRows(t, func() error {
+		return f(t)
+	}, q.String(), args...)
+}
+
+// GetForumTags returns the tags used in the forum, the most used first.
+func GetForumTags(s string, limit uint64) (*models.TagCountList, error) {
+	err := CheckExistenceOfForum(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := "SELECT tag, COUNT(*) threads FROM thread_tag WHERE forum = $1 GROUP BY tag ORDER BY threads DESC, tag"
+	if limit != 0 {
+		q += fmt.Sprintf(" LIMIT %v", limit)
 	}
+	res := &models.TagCountList{}
+	err = onReplica(func(conn *sqlx.DB) error {
+		return conn.Select(res, q, s)
+	})
 	if err != nil {
-		return res, err
+		return nil, err
 	}
 	return res, nil
 }
@@ -185,6 +306,27 @@ func UpdateThread(t *models.Thread, path string) (*models.Thread, error) {
 	if err != nil {
 		return res, err
 	}
+	return updateThread(t, res, 0)
+}
+
+// UpdateThreadIfUnchanged applies t to cur only if the thread has not been
+// changed since cur was read, ErrRecordChanged is returned otherwise.
+func UpdateThreadIfUnchanged(t *models.Thread, cur *models.Thread) (*models.Thread, error) {
+	return updateThread(t, cur, cur.Version)
+}
+
+// updateThread checks the version of res unless it is 0.
+func updateThread(t *models.Thread, res *models.Thread, version int) (*models.Thread, error) {
+	if t.ThreadTitle == "" && t.ThreadMessage == "" && t.Tags == nil {
+		return res, nil
+	}
+	var tags pq.StringArray
+	if t.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(t.Tags); err != nil {
+			return res, err
+		}
+	}
 
 	q := strings.Builder{}
 	q.WriteString("UPDATE thread SET ")
@@ -203,17 +345,48 @@ func UpdateThread(t *models.Thread, path string) (*models.Thread, error) {
 			q.WriteString(", thread_message = $" + strconv.Itoa(fieldCount))
 		} else {
 			q.WriteString("thread_message = $" + strconv.Itoa(fieldCount))
-
+			continues = true
 		}
 		args = append(args, t.ThreadMessage)
 	}
-	q.WriteString(" WHERE thread_id = $" + strconv.Itoa(fieldCount+1) + " RETURNING *")
+	if tags != nil {
+		fieldCount++
+		if continues {
+			q.WriteString(", tags = $" + strconv.Itoa(fieldCount))
+		} else {
+			q.WriteString("tags = $" + strconv.Itoa(fieldCount))
+		}
+		args = append(args, tags)
+	}
+	q.WriteString(" WHERE thread_id = $" + strconv.Itoa(fieldCount+1))
 	args = append(args, res.ThreadID)
-	err = db.Get(res, q.String(), args...)
+	if version != 0 {
+		q.WriteString(" AND version = $" + strconv.Itoa(fieldCount+2))
+		args = append(args, version)
+	}
+	q.WriteString(" RETURNING *")
+	tx, err := db.Beginx()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+	id := res.ThreadID
+	err = tx.Get(res, q.String(), args...)
+	if err == nil {
+		err = recordChanges(tx, models.EventThreadUpdated, res.Forum, id, change{threadRecord(id), res})
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	forgetThread(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return res, &RecordNotFoundError{"Thread", strconv.Itoa(res.ThreadID)}
+			if version != 0 {
+				return res, ErrRecordChanged
+			}
+			return res, &RecordNotFoundError{"Thread", strconv.Itoa(id)}
 		}
+		return res, err
 	}
 
 	return res, nil
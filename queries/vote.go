@@ -19,15 +19,39 @@ func VoteForPost(v *models.Vote, path string) (*models.Thread, error) {
 		return nil, err
 	}
 
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	res := &models.Thread{}
-	_, err = db.Exec(`
+	vote := models.DumpVote{Thread: threadID, Voice: v.Voice}
+	inserted, forum := false, ""
+	err = tx.QueryRow(`
 		INSERT INTO vote VALUES (
-			(SELECT nickname FROM forum_user WHERE nickname = $1), $2, $3
+			(SELECT nickname FROM forum_user WHERE nickname = $1 AND nickname <> '`+DeletedNickname+`'), $2, $3
 		)
-		ON CONFLICT (nickname, thread) DO UPDATE SET voice = $3`,
-		v.Nickname, threadID, v.Voice)
+		ON CONFLICT (nickname, thread) DO UPDATE SET voice = $3
+		RETURNING nickname, xmax = 0, (SELECT forum FROM thread WHERE thread_id = $2)`,
+		v.Nickname, threadID, v.Voice).Scan(&vote.Nickname, &inserted, &forum)
+	if err == nil {
+		typ := models.EventVoteUpdated
+		if inserted {
+			typ = models.EventVoteCreated
+			err = notifyVote(tx, vote.Nickname, threadID, v.Voice)
+		}
+		if err == nil {
+			err = recordChanges(tx, typ, forum, threadID, change{voteRecord(vote.Nickname, threadID), vote})
+		}
+	}
+	if err == nil {
+		err = commitChanges(tx)
+	}
+	forgetThread(threadID) // votes counter
+	forgetUser(v.Nickname)
 	if err != nil {
-		if pqErr := err.(*pq.Error); pqErr.Code == NotNullViolationCode && pqErr.Column == "nickname" {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == NotNullViolationCode && pqErr.Column == "nickname" {
 			return res, &RecordNotFoundError{"User", v.Nickname}
 		}
 		return res, err
@@ -37,5 +61,6 @@ func VoteForPost(v *models.Vote, path string) (*models.Thread, error) {
 	if err != nil {
 		return res, err
 	}
+	publish(models.EventThreadVoted, res.Forum, res.ThreadID, res)
 	return res, nil
 }
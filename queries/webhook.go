@@ -0,0 +1,199 @@
+package queries
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+// WebhookEvents are the events webhooks can subscribe to.
+var WebhookEvents = []string{models.EventThreadCreated, models.EventPostCreated}
+
+func CreateWebhook(w *models.Webhook) (*models.Webhook, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &ValidationError{"Webhook", "url"}
+	}
+	if w.Secret == "" {
+		return nil, &NullFieldError{"Webhook", "secret"}
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	for _, e := range w.Events {
+		if !isWebhookEvent(e) {
+			return nil, &ValidationError{"Webhook", "events"}
+		}
+	}
+
+	res := &models.Webhook{}
+	err = db.QueryRowx(`
+		INSERT INTO webhook (forum, url, secret, events)
+		VALUES ((SELECT forum_slug FROM forum WHERE forum_slug = $1), $2, $3, $4)
+		RETURNING webhook_id, forum, url, events, created`,
+		w.Forum, w.URL, w.Secret, pq.Array(w.Events)).Scan(
+		&res.WebhookID, &res.Forum, &res.URL, pq.Array(&res.Events), &res.Created)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == NotNullViolationCode {
+			return nil, &RecordNotFoundError{"Forum", w.Forum}
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func isWebhookEvent(e string) bool {
+	for _, v := range WebhookEvents {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+func GetForumWebhooks(slug string) (*models.WebhookList, error) {
+	if err := CheckExistenceOfForum(slug); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT webhook_id, forum, url, events, created FROM webhook
+		WHERE forum = $1 ORDER BY webhook_id`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := models.WebhookList{}
+	for rows.Next() {
+		w := models.Webhook{}
+		err = rows.Scan(&w.WebhookID, &w.Forum, &w.URL, pq.Array(&w.Events), &w.Created)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, w)
+	}
+	return &res, rows.Err()
+}
+
+func DeleteWebhook(slug string, id int) error {
+	r, err := db.Exec("DELETE FROM webhook WHERE forum = $1 AND webhook_id = $2", slug, id)
+	if err != nil {
+		return err
+	}
+	if n, err := r.RowsAffected(); err != nil || n == 0 {
+		return &RecordNotFoundError{"Webhook", strconv.Itoa(id)}
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest
+// attempts first.
+func GetWebhookDeliveries(slug string, id int, limit uint64) (*models.WebhookDeliveryList, error) {
+	exists := false
+	err := db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM webhook WHERE forum = $1 AND webhook_id = $2)", slug, id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &RecordNotFoundError{"Webhook", strconv.Itoa(id)}
+	}
+	res := models.WebhookDeliveryList{}
+	err = db.Select(&res, `SELECT delivery_id, webhook_id, event, attempt, status, error, duration_ms, delivered
+		FROM webhook_delivery WHERE webhook_id = $1 ORDER BY log_id DESC LIMIT $2`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// enqueueWebhooks puts deliveries of an event for the webhooks of forum
+// into the outbox, tx is the transaction of the change.
+func enqueueWebhooks(tx *sqlx.Tx, event, forum string, thread int, data ...json.Marshaler) error {
+	exists := false
+	err := tx.Get(&exists, `SELECT EXISTS(SELECT 1 FROM webhook
+		WHERE forum = $1 AND (events = '{}' OR $2 = ANY(events)))`, forum, event)
+	if err != nil || !exists {
+		return err
+	}
+
+	payloads := make([]string, 0, len(data))
+	for _, v := range data {
+		j, err := v.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		p, err := models.Event{Type: event, Forum: forum, Thread: thread, Data: j}.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, string(p))
+	}
+	_, err = tx.Exec(`
+		INSERT INTO webhook_outbox (webhook_id, event, payload)
+		SELECT w.webhook_id, $2, p.payload
+		FROM webhook w CROSS JOIN unnest($3::text[]) WITH ORDINALITY p (payload, n)
+		WHERE w.forum = $1 AND (w.events = '{}' OR $2 = ANY(w.events))
+		ORDER BY p.n, w.webhook_id`,
+		forum, event, pq.Array(payloads))
+	return err
+}
+
+// ClaimWebhookDeliveries takes up to n due deliveries from the outbox.
+// They are not handed out again for lease, so a dispatcher that dies
+// halfway only delays them.
+func ClaimWebhookDeliveries(n int, lease time.Duration) ([]models.WebhookOutboxItem, error) {
+	res := []models.WebhookOutboxItem{}
+	err := db.Select(&res, `
+		UPDATE webhook_outbox o SET next_attempt = now() + $2 * interval '1 millisecond'
+		FROM webhook w
+		WHERE w.webhook_id = o.webhook_id AND o.delivery_id IN (
+			SELECT delivery_id FROM webhook_outbox WHERE next_attempt <= now()
+			ORDER BY next_attempt, delivery_id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING o.delivery_id, o.webhook_id, o.event, o.payload, o.attempts, w.url, w.secret`,
+		n, lease.Nanoseconds()/int64(time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// FinishWebhookDelivery logs an attempt, the delivery leaves the outbox
+// unless retryIn is positive.
+func FinishWebhookDelivery(d *models.WebhookDelivery, retryIn time.Duration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status := sql.NullInt64{}
+	if d.Status != nil {
+		status = sql.NullInt64{Int64: int64(*d.Status), Valid: true}
+	}
+	_, err = tx.Exec(`INSERT INTO webhook_delivery
+		(delivery_id, webhook_id, event, attempt, status, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		d.DeliveryID, d.WebhookID, d.Event, d.Attempt, status, d.Error, d.Duration)
+	if err != nil {
+		return err
+	}
+	if retryIn > 0 {
+		_, err = tx.Exec(`UPDATE webhook_outbox
+			SET attempts = $2, next_attempt = now() + $3 * interval '1 millisecond'
+			WHERE delivery_id = $1`,
+			d.DeliveryID, d.Attempt, retryIn.Nanoseconds()/int64(time.Millisecond))
+	} else {
+		_, err = tx.Exec("DELETE FROM webhook_outbox WHERE delivery_id = $1", d.DeliveryID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
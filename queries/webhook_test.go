@@ -0,0 +1,98 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+func countRows(t *testing.T, table string) int {
+	t.Helper()
+	n := 0
+	if err := db.Get(&n, "SELECT count(*) FROM "+table); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestClaimSkipsLockedDeliveries(t *testing.T) {
+	testDB(t)
+	testUser(t, "hooker")
+	testForum(t, "hooks", "hooker")
+	w, err := CreateWebhook(&models.Webhook{Forum: "hooks", URL: "http://example.com/hook", Secret: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		testThread(t, "hooks", "hooker")
+	}
+
+	// another dispatcher is busy with the first delivery
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var locked int64
+	err = tx.QueryRow("SELECT delivery_id FROM webhook_outbox ORDER BY delivery_id LIMIT 1 FOR UPDATE").Scan(&locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := ClaimWebhookDeliveries(10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("claimed %d deliveries, want 2", len(items))
+	}
+	for _, it := range items {
+		if it.DeliveryID == locked {
+			t.Errorf("claimed the locked delivery %d", locked)
+		}
+		if it.URL != w.URL || it.Secret != "s" || it.Event != models.EventThreadCreated {
+			t.Errorf("got delivery %+v", it)
+		}
+	}
+	if again, err := ClaimWebhookDeliveries(10, time.Hour); err != nil || len(again) != 0 {
+		t.Errorf("claimed %d leased deliveries again, %v", len(again), err)
+	}
+	tx.Rollback()
+	if again, err := ClaimWebhookDeliveries(10, time.Hour); err != nil || len(again) != 1 || again[0].DeliveryID != locked {
+		t.Errorf("got %+v, %v after the lock was released, want delivery %d", again, err, locked)
+	}
+
+	failed := &models.WebhookDelivery{DeliveryID: items[0].DeliveryID, WebhookID: w.WebhookID,
+		Event: items[0].Event, Attempt: 1, Error: "503 Service Unavailable"}
+	if err = FinishWebhookDelivery(failed, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	attempts := 0
+	err = db.Get(&attempts, "SELECT attempts FROM webhook_outbox WHERE delivery_id = $1", failed.DeliveryID)
+	if err != nil || attempts != 1 {
+		t.Errorf("got %d attempts, %v for the failed delivery, want it kept for a retry", attempts, err)
+	}
+	status := 200
+	done := &models.WebhookDelivery{DeliveryID: items[1].DeliveryID, WebhookID: w.WebhookID,
+		Event: items[1].Event, Attempt: 1, Status: &status}
+	if err = FinishWebhookDelivery(done, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, "webhook_outbox"); n != 2 {
+		t.Errorf("got %d deliveries in the outbox, want 2", n)
+	}
+	logged, err := GetWebhookDeliveries("hooks", w.WebhookID, 10)
+	if err != nil || len(*logged) != 2 {
+		t.Errorf("got deliveries %+v, %v, want both attempts", logged, err)
+	}
+
+	if err = ClearDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"webhook", "webhook_outbox", "webhook_delivery"} {
+		if n := countRows(t, table); n != 0 {
+			t.Errorf("%s has %d rows after clear", table, n)
+		}
+	}
+}
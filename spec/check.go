@@ -0,0 +1,163 @@
+package spec
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CheckRouter reports routes registered in r that are not documented and
+// documented operations that have no route.
+func CheckRouter(s *Spec, r *mux.Router) ([]string, error) {
+	res := []string{}
+	registered := map[string]bool{}
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(tpl, s.BasePath+"/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := TemplatePath(s.BasePath, tpl)
+		for _, m := range methods {
+			registered[m+" "+path] = true
+			if s.Operation(m, path) == nil {
+				res = append(res, fmt.Sprintf("route %s %s is not documented", m, tpl))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range s.Operations() {
+		if !registered[op.String()] {
+			res = append(res, fmt.Sprintf("operation %s (%s) has no route", op, op.OperationID))
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// CheckModel compares json fields of t with the properties of definition.
+func CheckModel(s *Spec, definition string, t reflect.Type) []string {
+	schema, ok := s.Definitions[definition]
+	if !ok {
+		return []string{fmt.Sprintf("definition %s not found", definition)}
+	}
+	return checkType(s, definition, schema, t, map[string]bool{definition: true})
+}
+
+// checkType compares schema with t. Definitions in refs are being checked
+// further up, they are not followed again, so recursive ones end.
+func checkType(s *Spec, loc string, schema *Schema, t reflect.Type, refs map[string]bool) []string {
+	if schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/definitions/")
+		if refs[name] {
+			return nil
+		}
+		refs[name] = true
+		defer delete(refs, name)
+	}
+	schema, err := s.Resolve(schema)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", loc, err)}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	mismatch := func() []string {
+		return []string{fmt.Sprintf("%s: %s does not match type %q", loc, t, schema.Type)}
+	}
+	switch schema.Type {
+	case "object", "":
+		if t.Kind() != reflect.Struct || t == timeType {
+			return mismatch()
+		}
+		res := []string{}
+		fields := jsonFields(t)
+		for name, prop := range schema.Properties {
+			f, ok := fields[name]
+			if !ok {
+				res = append(res, fmt.Sprintf("%s.%s: property has no field in %s", loc, name, t))
+				continue
+			}
+			res = append(res, checkType(s, loc+"."+name, prop, f.Type, refs)...)
+		}
+		for name := range fields {
+			if _, ok := schema.Properties[name]; !ok {
+				res = append(res, fmt.Sprintf("%s.%s: field of %s is not documented", loc, name, t))
+			}
+		}
+		sort.Strings(res)
+		return res
+	case "array":
+		if t.Kind() != reflect.Slice {
+			return mismatch()
+		}
+		return checkType(s, loc+"[]", schema.Items, t.Elem(), refs)
+	case "number", "integer":
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return nil
+		}
+		return mismatch()
+	case "boolean":
+		if t.Kind() != reflect.Bool {
+			return mismatch()
+		}
+	case "string":
+		if schema.Format == "date-time" {
+			if t != timeType {
+				return mismatch()
+			}
+			return nil
+		}
+		if t.Kind() != reflect.String {
+			return mismatch()
+		}
+	}
+	return nil
+}
+
+// jsonFields collects fields by their json names, following embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	res := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			for k, v := range jsonFields(ft) {
+				res[k] = v
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		res[name] = f
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+package spec
+
+import (
+	"bytes"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// docsTemplate is a self-contained page: no scripts, fonts or styles are
+// loaded from elsewhere, so it works behind any firewall.
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"typeName": typeName,
+	"lower":    strings.ToLower,
+	"anchor":   anchor,
+}).Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>{{.Info.Title}} API {{.Info.Version}}</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 960px; padding: 0 16px 48px; color: #222; }
+h1 small { color: #888; font-weight: normal; font-size: 60%; }
+nav ul { columns: 2; padding-left: 16px; }
+section { border: 1px solid #ddd; border-radius: 4px; margin: 16px 0; padding: 0 16px 8px; }
+.method { display: inline-block; min-width: 56px; padding: 2px 6px; border-radius: 3px; color: #fff; text-align: center; font-size: 85%; }
+.get { background: #2f80ed; } .post { background: #27ae60; } .put { background: #f2994a; } .delete { background: #eb5757; }
+code, .path { font-family: monospace; }
+table { border-collapse: collapse; width: 100%; margin: 8px 0; }
+th, td { border-bottom: 1px solid #eee; padding: 4px 8px; text-align: left; vertical-align: top; }
+pre { white-space: pre-wrap; margin: 0; font-family: inherit; }
+</style>
+</head>
+<body>
+<h1>{{.Info.Title}} <small>{{.Info.Version}}</small></h1>
+<pre>{{.Info.Description}}</pre>
+<p>Base URL: <code>{{.BaseURL}}</code>.
+Specification: <a href="openapi.yml">openapi.yml</a>, <a href="openapi.json">openapi.json</a>.</p>
+<nav><ul>
+{{range .Operations}}<li><a href="#{{anchor .}}"><span class="method {{lower .Method}}">{{.Method}}</span> <span class="path">{{.Path}}</span></a> {{.Summary}}</li>
+{{end}}</ul></nav>
+{{range .Operations}}
+<section id="{{anchor .}}">
+<h2><span class="method {{lower .Method}}">{{.Method}}</span> <span class="path">{{.Path}}</span></h2>
+<p><b>{{.Summary}}</b> <code>{{.OperationID}}</code></p>
+<pre>{{.Description}}</pre>
+{{if .Parameters}}<h3>Parameters</h3>
+<table><tr><th>Name</th><th>In</th><th>Type</th><th>Description</th></tr>
+{{range .Parameters}}<tr><td><code>{{.Name}}</code>{{if .Required}} *{{end}}</td><td>{{.In}}</td>
+<td>{{if .Schema}}{{typeName .Schema}}{{else}}{{.Type}}{{if .Format}} ({{.Format}}){{end}}{{end}}{{if .Enum}} {{.Enum}}{{end}}</td>
+<td><pre>{{.Description}}</pre></td></tr>
+{{end}}</table>{{end}}
+<h3>Responses</h3>
+<table><tr><th>Status</th><th>Body</th><th>Description</th></tr>
+{{range $code, $resp := .Responses}}<tr><td>{{$code}}</td><td>{{if $resp.Schema}}{{typeName $resp.Schema}}{{end}}</td><td><pre>{{$resp.Description}}</pre></td></tr>
+{{end}}</table>
+</section>
+{{end}}
+<h2>Definitions</h2>
+{{range .Definitions}}
+<section id="definition-{{.Name}}">
+<h3>{{.Name}}</h3>
+<pre>{{.Schema.Description}}</pre>
+{{if .Schema.Items}}<p>Array of {{typeName .Schema.Items}}</p>{{end}}
+{{if .Properties}}<table><tr><th>Property</th><th>Type</th><th>Description</th></tr>
+{{range .Properties}}<tr><td><code>{{.Name}}</code>{{if .Required}} *{{end}}{{if .Schema.ReadOnly}} (read only){{end}}</td>
+<td>{{typeName .Schema}}</td><td><pre>{{.Schema.Description}}</pre></td></tr>
+{{end}}</table>{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+type docsDefinition struct {
+	Name       string
+	Schema     *Schema
+	Properties []docsProperty
+}
+
+type docsProperty struct {
+	Name     string
+	Required bool
+	Schema   *Schema
+}
+
+func typeName(s *Schema) template.HTML {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/definitions/")
+		return template.HTML(`<a href="#definition-` + template.HTMLEscapeString(name) + `">` +
+			template.HTMLEscapeString(name) + `</a>`)
+	}
+	if s.Type == "array" && s.Items != nil {
+		return "array of " + typeName(s.Items)
+	}
+	if s.Format != "" {
+		return template.HTML(template.HTMLEscapeString(s.Type + " (" + s.Format + ")"))
+	}
+	return template.HTML(template.HTMLEscapeString(s.Type))
+}
+
+func anchor(op *Operation) string {
+	if op.OperationID != "" {
+		return op.OperationID
+	}
+	return strings.ToLower(op.Method) + strings.NewReplacer("/", "-", "{", "", "}", "").Replace(op.Path)
+}
+
+// RenderDocs renders a human-readable HTML page describing the API.
+func (s *Spec) RenderDocs(baseURL string) ([]byte, error) {
+	defs := []docsDefinition{}
+	for name, schema := range s.Definitions {
+		d := docsDefinition{Name: name, Schema: schema}
+		required := map[string]bool{}
+		for _, r := range schema.Required {
+			required[r] = true
+		}
+		for prop, ps := range schema.Properties {
+			d.Properties = append(d.Properties, docsProperty{prop, required[prop], ps})
+		}
+		sort.Slice(d.Properties, func(i, j int) bool {
+			return d.Properties[i].Name < d.Properties[j].Name
+		})
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+
+	buf := &bytes.Buffer{}
+	err := docsTemplate.Execute(buf, map[string]interface{}{
+		"Info":        s.Info,
+		"BaseURL":     baseURL,
+		"Operations":  s.Operations(),
+		"Definitions": defs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,170 @@
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+const (
+	// ModeLog only logs requests and responses that do not conform to the spec.
+	ModeLog = "log"
+	// ModeStrict additionally rejects invalid requests with 400 and replaces
+	// invalid responses with 500, so that test runs fail loudly.
+	ModeStrict = "strict"
+)
+
+var routeVarPattern = regexp.MustCompile(`{([^:}]+):[^}]+}`)
+
+// TemplatePath converts a gorilla/mux path template to the spec form:
+// the base path is cut off and variable patterns are dropped.
+func TemplatePath(basePath, tpl string) string {
+	tpl = strings.TrimPrefix(tpl, basePath)
+	return routeVarPattern.ReplaceAllString(tpl, "{$1}")
+}
+
+// MaxValidatedBody is how much of a response is held back to be checked.
+// Longer ones, streamed lists mostly, are sent on as they come once they
+// outgrow it, and only their status is checked.
+const MaxValidatedBody = 1 << 20
+
+// responseRecorder holds the response back until it is checked, or until
+// it turns out to be too long for that.
+type responseRecorder struct {
+	w      http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	passed bool // the response went on unchecked
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.w.Header()
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.passed {
+		return r.w.Write(b)
+	}
+	if r.body.Len()+len(b) <= MaxValidatedBody {
+		return r.body.Write(b)
+	}
+	r.passed = true
+	r.w.WriteHeader(r.status)
+	if _, err := r.body.WriteTo(r.w); err != nil {
+		return 0, err
+	}
+	return r.w.Write(b)
+}
+
+// Flush sends on what was written once the response goes unchecked;
+// before that there is nothing to send yet.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.w.(http.Flusher); ok && r.passed {
+		f.Flush()
+	}
+}
+
+// Middleware checks requests and responses of the routes of the API
+// mounted at prefix, which stands for the base path of the spec: /api/v2
+// differs from /api in details the spec documents, so both are checked
+// against it.
+func Middleware(s *Spec, prefix, mode string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tpl, err := route.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			op := s.Operation(r.Method, TemplatePath(prefix, tpl))
+			if op == nil {
+				log.Printf("spec: %s %s is not documented\n", r.Method, tpl)
+				if mode == ModeStrict {
+					writeViolation(w, http.StatusNotImplemented, "operation is not documented")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				log.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			r.Body.Close()
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			if violations := s.ValidateRequest(op, r, mux.Vars(r), body); len(violations) != 0 {
+				logViolations(violations)
+				if mode == ModeStrict {
+					writeViolation(w, http.StatusBadRequest, violations[0].Error())
+					return
+				}
+			}
+
+			rec := &responseRecorder{w: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			if rec.passed {
+				// too late to replace it, but still worth a log line
+				if op.Response(rec.status) == nil {
+					log.Printf("spec: %s: status: undocumented status %d\n", op, rec.status)
+				}
+				return
+			}
+
+			if violations := s.ValidateResponse(op, rec.status, rec.body.Bytes()); len(violations) != 0 {
+				logViolations(violations)
+				if mode == ModeStrict {
+					writeViolation(w, http.StatusInternalServerError, violations[0].Error())
+					return
+				}
+			}
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+		})
+	}
+}
+
+func logViolations(violations []Violation) {
+	for _, v := range violations {
+		log.Println("spec:", v.Error())
+	}
+}
+
+func writeViolation(w http.ResponseWriter, status int, msg string) {
+	j, err := models.ErrorMessage{Message: "spec violation: " + msg}.MarshalJSON()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	fmt.Fprintln(w, string(j))
+}
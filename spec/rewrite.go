@@ -0,0 +1,95 @@
+package spec
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Overrides are deployment specific values patched into the document.
+// Empty fields leave the document as is.
+type Overrides struct {
+	Host    string
+	Schemes []string
+	Version string
+}
+
+// Rewrite applies o to the YAML document keeping its formatting,
+// so the result is still readable by humans.
+func Rewrite(data []byte, o Overrides) []byte {
+	lines := strings.Split(string(data), "\n")
+	if o.Host != "" {
+		lines = setTopLevel(lines, "host", []string{"host: " + strconv.Quote(o.Host)})
+	}
+	if len(o.Schemes) != 0 {
+		block := []string{"schemes:"}
+		for _, s := range o.Schemes {
+			block = append(block, "- "+s)
+		}
+		lines = setTopLevel(lines, "schemes", block)
+	}
+	if o.Version != "" {
+		lines = setInfoVersion(lines, o.Version)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func isTopLevelKey(line string) bool {
+	return line != "" && line[0] != ' ' && line[0] != '#' && line[0] != '-' &&
+		strings.Contains(line, ":")
+}
+
+// topLevelBlock returns the line range of a top-level key and its value.
+func topLevelBlock(lines []string, key string) (int, int) {
+	for i, line := range lines {
+		if !isTopLevelKey(line) || !strings.HasPrefix(line, key+":") {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !isTopLevelKey(lines[end]) {
+			end++
+		}
+		// leave trailing blank lines to the next key
+		for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		return i, end
+	}
+	return -1, -1
+}
+
+func setTopLevel(lines []string, key string, block []string) []string {
+	start, end := topLevelBlock(lines, key)
+	if start < 0 {
+		// new keys go after basePath which is where swagger.yml keeps
+		// the connection details
+		_, end = topLevelBlock(lines, "basePath")
+		if end < 0 {
+			_, end = topLevelBlock(lines, "swagger")
+		}
+		if end < 0 {
+			end = 0
+		}
+		start = end
+	}
+	res := make([]string, 0, len(lines)+len(block))
+	res = append(res, lines[:start]...)
+	res = append(res, block...)
+	return append(res, lines[end:]...)
+}
+
+func setInfoVersion(lines []string, version string) []string {
+	start, end := topLevelBlock(lines, "info")
+	if start < 0 {
+		return setTopLevel(lines, "info", []string{"info:", "  version: " + strconv.Quote(version)})
+	}
+	for i := start + 1; i < end; i++ {
+		if strings.HasPrefix(lines[i], "  version:") {
+			lines[i] = "  version: " + strconv.Quote(version)
+			return lines
+		}
+	}
+	res := make([]string, 0, len(lines)+1)
+	res = append(res, lines[:end]...)
+	res = append(res, "  version: "+strconv.Quote(version))
+	return append(res, lines[end:]...)
+}
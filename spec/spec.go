@@ -0,0 +1,184 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Spec struct {
+	Swagger     string                 `json:"swagger"`
+	Host        string                 `json:"host"`
+	Schemes     []string               `json:"schemes"`
+	Info        Info                   `json:"info"`
+	BasePath    string                 `json:"basePath"`
+	Paths       map[string]PathItem    `json:"paths"`
+	Definitions map[string]*Schema     `json:"definitions"`
+	Raw         map[string]interface{} `json:"-"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Description string               `json:"description"`
+	Parameters  []*Parameter         `json:"parameters"`
+	Responses   map[string]*Response `json:"responses"`
+
+	Method string `json:"-"`
+	Path   string `json:"-"`
+}
+
+type Parameter struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description"`
+	Required    bool          `json:"required"`
+	Type        string        `json:"type"`
+	Format      string        `json:"format"`
+	Enum        []interface{} `json:"enum"`
+	Minimum     *float64      `json:"minimum"`
+	Maximum     *float64      `json:"maximum"`
+	Items       *Schema       `json:"items"`
+	Schema      *Schema       `json:"schema"`
+}
+
+type Response struct {
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Format      string             `json:"format"`
+	Description string             `json:"description"`
+	Properties  map[string]*Schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Items       *Schema            `json:"items"`
+	Enum        []interface{}      `json:"enum"`
+	Pattern     string             `json:"pattern"`
+	ReadOnly    bool               `json:"readOnly"`
+	Minimum     *float64           `json:"minimum"`
+	Maximum     *float64           `json:"maximum"`
+}
+
+func Load(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Spec, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("spec: document is not a mapping")
+	}
+	j, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spec{Raw: raw}
+	err = json.Unmarshal(j, s)
+	if err != nil {
+		return nil, err
+	}
+	for path, item := range s.Paths {
+		for method, op := range item {
+			op.Method = strings.ToUpper(method)
+			op.Path = path
+		}
+	}
+	return s, nil
+}
+
+// JSON returns the document as it was read, encoded as JSON.
+func (s *Spec) JSON() ([]byte, error) {
+	return json.Marshal(s.Raw)
+}
+
+// Operations returns all documented operations sorted by path and method.
+func (s *Spec) Operations() []*Operation {
+	res := []*Operation{}
+	for _, item := range s.Paths {
+		for _, op := range item {
+			res = append(res, op)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
+}
+
+// Operation finds an operation by its path template relative to basePath,
+// e.g. "/thread/{slug_or_id}/posts".
+func (s *Spec) Operation(method, path string) *Operation {
+	item, ok := s.Paths[path]
+	if !ok {
+		return nil
+	}
+	return item[strings.ToLower(method)]
+}
+
+func (s *Spec) Resolve(schema *Schema) (*Schema, error) {
+	for schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/definitions/")
+		def, ok := s.Definitions[name]
+		if !ok {
+			return nil, fmt.Errorf("spec: unresolved reference %s", schema.Ref)
+		}
+		schema = def
+	}
+	return schema, nil
+}
+
+// StatusCodes returns documented response codes of the operation.
+func (op *Operation) StatusCodes() []int {
+	res := []int{}
+	for code := range op.Responses {
+		c, err := strconv.Atoi(code)
+		if err != nil {
+			continue
+		}
+		res = append(res, c)
+	}
+	sort.Ints(res)
+	return res
+}
+
+func (op *Operation) Response(status int) *Response {
+	if res, ok := op.Responses[strconv.Itoa(status)]; ok {
+		return res
+	}
+	return op.Responses["default"]
+}
+
+func (op *Operation) String() string {
+	return op.Method + " " + op.Path
+}
+
+func statusText(code int) string {
+	return strconv.Itoa(code) + " " + http.StatusText(code)
+}
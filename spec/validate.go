@@ -0,0 +1,251 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Violation struct {
+	Operation string
+	Location  string
+	Message   string
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("%s: %s: %s", v.Operation, v.Location, v.Message)
+}
+
+// ValidateRequest checks path, query and body parameters of r.
+// Path parameters are passed separately as they are extracted by the router.
+func (s *Spec) ValidateRequest(op *Operation, r *http.Request, vars map[string]string, body []byte) []Violation {
+	res := []Violation{}
+	add := func(loc, format string, args ...interface{}) {
+		res = append(res, Violation{op.String(), loc, fmt.Sprintf(format, args...)})
+	}
+
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			v, ok := vars[p.Name]
+			if !ok {
+				add("path."+p.Name, "missing")
+				continue
+			}
+			if err := checkParameter(p, v); err != nil {
+				add("path."+p.Name, "%v", err)
+			}
+		case "query":
+			values, ok := query[p.Name]
+			if !ok {
+				if p.Required {
+					add("query."+p.Name, "missing")
+				}
+				continue
+			}
+			if p.Type == "array" {
+				for _, v := range strings.Split(values[0], ",") {
+					if err := checkParameter(&Parameter{Type: p.Items.Type, Enum: p.Items.Enum}, v); err != nil {
+						add("query."+p.Name, "%v", err)
+					}
+				}
+				continue
+			}
+			if err := checkParameter(p, values[0]); err != nil {
+				add("query."+p.Name, "%v", err)
+			}
+		case "body":
+			if len(strings.TrimSpace(string(body))) == 0 {
+				if p.Required {
+					add("body", "missing")
+				}
+				continue
+			}
+			var v interface{}
+			if err := json.Unmarshal(body, &v); err != nil {
+				add("body", "invalid json: %v", err)
+				continue
+			}
+			for _, err := range s.validate(p.Schema, v, "body", true) {
+				add(err.Location, "%s", err.Message)
+			}
+		}
+	}
+	return res
+}
+
+// ValidateResponse checks that status is documented for op and body matches
+// its schema. Files are not checked beyond their status.
+func (s *Spec) ValidateResponse(op *Operation, status int, body []byte) []Violation {
+	resp := op.Response(status)
+	if resp == nil {
+		return []Violation{{op.String(), "status", "undocumented status " + statusText(status)}}
+	}
+	if resp.Schema == nil || resp.Schema.Type == "file" {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []Violation{{op.String(), "response", fmt.Sprintf("invalid json: %v", err)}}
+	}
+	res := []Violation{}
+	for _, err := range s.validate(resp.Schema, v, "response", false) {
+		res = append(res, Violation{op.String(), err.Location, err.Message})
+	}
+	return res
+}
+
+func checkParameter(p *Parameter, raw string) error {
+	var v interface{} = raw
+	switch p.Type {
+	case "number", "integer":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		if p.Minimum != nil && f < *p.Minimum {
+			return fmt.Errorf("%v is less than %v", f, *p.Minimum)
+		}
+		if p.Maximum != nil && f > *p.Maximum {
+			return fmt.Errorf("%v is greater than %v", f, *p.Maximum)
+		}
+		v = f
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v = b
+	case "string":
+		if p.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, raw); err != nil {
+				return fmt.Errorf("%q is not a date-time", raw)
+			}
+		}
+	}
+	if len(p.Enum) != 0 && !inEnum(p.Enum, v) {
+		return fmt.Errorf("%q is not one of %v", raw, p.Enum)
+	}
+	return nil
+}
+
+// validate checks a decoded JSON value against schema. Requests may omit
+// read-only properties, responses are checked for them too.
+func (s *Spec) validate(schema *Schema, v interface{}, loc string, request bool) []Violation {
+	schema, err := s.Resolve(schema)
+	if err != nil {
+		return []Violation{{Location: loc, Message: err.Error()}}
+	}
+	if schema == nil || v == nil {
+		return nil
+	}
+	res := []Violation{}
+	add := func(loc, format string, args ...interface{}) {
+		res = append(res, Violation{Location: loc, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch schema.Type {
+	case "object", "":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			if schema.Type != "" {
+				add(loc, "expected object, got %s", jsonType(v))
+			}
+			return res
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				if prop := schema.Properties[name]; request && prop != nil && prop.ReadOnly {
+					continue
+				}
+				add(loc+"."+name, "missing required property")
+			}
+		}
+		for name, value := range obj {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				if !request {
+					add(loc+"."+name, "undocumented property")
+				}
+				continue
+			}
+			res = append(res, s.validate(prop, value, loc+"."+name, request)...)
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			add(loc, "expected array, got %s", jsonType(v))
+			return res
+		}
+		for i, item := range arr {
+			res = append(res, s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", loc, i), request)...)
+		}
+	case "number", "integer":
+		f, ok := v.(float64)
+		if !ok {
+			add(loc, "expected number, got %s", jsonType(v))
+			return res
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			add(loc, "%v is less than %v", f, *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			add(loc, "%v is greater than %v", f, *schema.Maximum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			add(loc, "expected boolean, got %s", jsonType(v))
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			add(loc, "expected string, got %s", jsonType(v))
+			return res
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				add(loc, "%q is not a date-time", str)
+			}
+		}
+		if schema.Pattern != "" {
+			re, err := regexp.Compile(schema.Pattern)
+			if err == nil && !re.MatchString(str) {
+				add(loc, "%q does not match %s", str, schema.Pattern)
+			}
+		}
+	}
+	if len(schema.Enum) != 0 && !inEnum(schema.Enum, v) {
+		add(loc, "%v is not one of %v", v, schema.Enum)
+	}
+	return res
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	}
+	return "null"
+}
@@ -0,0 +1,277 @@
+package spec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlParser understands the subset of YAML used by swagger.yml:
+// block mappings and sequences, literal block scalars and plain or quoted
+// scalars. Flow collections are supported only in their empty form.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string // without indentation
+}
+
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		p.lines = append(p.lines, yamlLine{
+			num:    i + 1,
+			indent: len(raw) - len(text),
+			text:   text,
+		})
+	}
+	p.skipEmpty()
+	if p.eof() {
+		return nil, nil
+	}
+	v, err := p.parseNode(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipEmpty()
+	if !p.eof() {
+		return nil, p.errorf("unexpected content")
+	}
+	return v, nil
+}
+
+func (p *yamlParser) eof() bool {
+	return p.pos >= len(p.lines)
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	num := 0
+	if !p.eof() {
+		num = p.lines[p.pos].num
+	}
+	return fmt.Errorf("yaml: line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+func (p *yamlParser) skipEmpty() {
+	for !p.eof() {
+		text := p.lines[p.pos].text
+		if text != "" && !strings.HasPrefix(text, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseMapping(indent int) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	for p.skipEmpty(); !p.eof(); p.skipEmpty() {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && isSeqItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf("bad indentation")
+		}
+		key, value, err := splitKey(line.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, ok := res[key]; ok {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		switch {
+		case value == "":
+			res[key], err = p.parseNested(indent)
+		case value == "|" || value == "|-" || value == ">" || value == ">-":
+			res[key] = p.parseBlockScalar(indent, value)
+		default:
+			res[key], err = parseScalar(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// parseNested parses the value of a key that has nothing after the colon.
+// Sequences are allowed to start at the same indentation as their key.
+func (p *yamlParser) parseNested(indent int) (interface{}, error) {
+	p.skipEmpty()
+	if p.eof() {
+		return nil, nil
+	}
+	line := p.lines[p.pos]
+	if line.indent > indent || (line.indent == indent && isSeqItem(line.text)) {
+		return p.parseNode(line.indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	res := []interface{}{}
+	for p.skipEmpty(); !p.eof(); p.skipEmpty() {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSeqItem(line.text) {
+			if line.indent > indent {
+				return nil, p.errorf("bad indentation")
+			}
+			break
+		}
+		content := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		switch {
+		case content == "":
+			p.pos++
+			v, err := p.parseNested(indent)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		case isMappingLine(content):
+			// "- key: value" starts a mapping whose keys are aligned
+			// with the first key, so reparse the line without the dash
+			shift := len(line.text) - len(content)
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + shift, text: content}
+			v, err := p.parseMapping(indent + shift)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		default:
+			v, err := parseScalar(content)
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			res = append(res, v)
+			p.pos++
+		}
+	}
+	return res, nil
+}
+
+func (p *yamlParser) parseBlockScalar(indent int, style string) string {
+	var lines []string
+	blockIndent := -1
+	for ; !p.eof(); p.pos++ {
+		line := p.lines[p.pos]
+		if line.text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		prefix := ""
+		if line.indent > blockIndent {
+			prefix = strings.Repeat(" ", line.indent-blockIndent)
+		}
+		lines = append(lines, prefix+line.text)
+	}
+	// trailing empty lines belong to the following node
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		p.pos--
+	}
+	sep := "\n"
+	if strings.HasPrefix(style, ">") {
+		sep = " "
+	}
+	res := strings.Join(lines, sep)
+	if !strings.HasSuffix(style, "-") && len(lines) > 0 {
+		res += "\n"
+	}
+	return res
+}
+
+func isMappingLine(text string) bool {
+	_, _, err := splitKey(text)
+	return err == nil
+}
+
+func splitKey(text string) (string, string, error) {
+	if strings.HasPrefix(text, "'") || strings.HasPrefix(text, `"`) {
+		end := strings.Index(text[1:], text[:1])
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted key")
+		}
+		key := text[1 : end+1]
+		rest := text[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("expected colon after key")
+		}
+		return key, strings.TrimSpace(rest[1:]), nil
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", fmt.Errorf("expected key")
+		}
+		i = len(text) - 1
+	}
+	key := text[:i]
+	if strings.ContainsAny(key, "#") {
+		return "", "", fmt.Errorf("expected key")
+	}
+	return key, strings.TrimSpace(text[i+1:]), nil
+}
+
+func parseScalar(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case strings.HasPrefix(s, `"`):
+		res, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad string %s", s)
+		}
+		return res, nil
+	case s == "[]":
+		return []interface{}{}, nil
+	case s == "{}":
+		return map[string]interface{}{}, nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	switch s {
+	case "~", "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if strings.IndexAny(s[:1], "-.0123456789") == 0 {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,28 @@
+// Package storage keeps attachment files for the queries package.
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotExist is returned by Open for keys that have not been stored.
+var ErrNotExist = errors.New("storage: file does not exist")
+
+// File is a stored file opened for reading.
+type File interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Storage is safe for concurrent use. Keys are made of letters, digits,
+// dots and dashes, a key is only ever stored with the same content.
+type Storage interface {
+	// Put stores the content of r under key, replacing what was there.
+	// Readers never see a partially written file.
+	Put(key string, r io.Reader) error
+	Open(key string) (File, error)
+	Exists(key string) (bool, error)
+	// Delete removes key, missing keys are not an error.
+	Delete(key string) error
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// maxImagePixels bounds the images decoded for thumbnails, a small file
+// can claim a huge canvas.
+const maxImagePixels = 40 << 20
+
+var ErrImageTooLarge = errors.New("storage: image is too large for a thumbnail")
+
+// ImageSize returns the dimensions of a JPEG, PNG or GIF image without
+// decoding its pixels.
+func ImageSize(r io.Reader, contentType string) (int, int, error) {
+	var cfg image.Config
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		cfg, err = jpeg.DecodeConfig(r)
+	case "image/png":
+		cfg, err = png.DecodeConfig(r)
+	case "image/gif":
+		cfg, err = gif.DecodeConfig(r)
+	default:
+		return 0, 0, image.ErrFormat
+	}
+	return cfg.Width, cfg.Height, err
+}
+
+// Thumbnail scales down a JPEG, PNG or GIF image of width x height to fit
+// a size x size square, smaller images keep their size. Images with
+// transparency give PNG thumbnails, the rest JPEG ones.
+func Thumbnail(r io.Reader, contentType string, width, height, size int) ([]byte, string, error) {
+	if width*height > maxImagePixels {
+		return nil, "", ErrImageTooLarge
+	}
+	var src image.Image
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		src, err = jpeg.Decode(r)
+	case "image/png":
+		src, err = png.Decode(r)
+	case "image/gif":
+		src, err = gif.Decode(r) // the first frame
+	default:
+		return nil, "", image.ErrFormat
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, h*size/w
+		} else {
+			w, h = w*size/h, size
+		}
+		if w == 0 {
+			w = 1
+		}
+		if h == 0 {
+			h = 1
+		}
+	}
+	dst := scale(src, w, h)
+
+	buf := bytes.Buffer{}
+	if o, ok := src.(interface{ Opaque() bool }); ok && o.Opaque() {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+// scale resizes src to w x h averaging the source pixels that fall into
+// every destination pixel, which is enough for shrinking.
+func scale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+			if x1 == x0 {
+				x1++
+			}
+			var sr, sg, sb, sa, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, bl, a := src.At(sx, sy).RGBA()
+					sr += uint64(r)
+					sg += uint64(g)
+					sb += uint64(bl)
+					sa += uint64(a)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(sr / n >> 8)
+			dst.Pix[i+1] = uint8(sg / n >> 8)
+			dst.Pix[i+2] = uint8(sb / n >> 8)
+			dst.Pix[i+3] = uint8(sa / n >> 8)
+		}
+	}
+	return dst
+}
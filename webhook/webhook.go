@@ -0,0 +1,157 @@
+// Package webhook delivers events from the outbox to forum webhooks.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+	"github.com/ArtAndreev/ForumTP/queries"
+)
+
+// Receivers get the event as JSON in the body, with the delivery ID as
+// the event ID. The same delivery can arrive more than once.
+const (
+	EventHeader     = "X-Forum-Event"
+	DeliveryHeader  = "X-Forum-Delivery"
+	SignatureHeader = "X-Forum-Signature"
+)
+
+// Sign returns the signature header value of body: the hex HMAC-SHA256
+// with the secret of the webhook.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher polls the outbox and retries failed deliveries with
+// exponential backoff. Several dispatchers can share the database.
+type Dispatcher struct {
+	Client      *http.Client
+	Batch       int
+	MaxAttempts int
+	Backoff     time.Duration // before the second attempt, doubled for every next one
+	MaxBackoff  time.Duration
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Batch:       100,
+		MaxAttempts: 10,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  time.Hour,
+	}
+}
+
+// Run delivers due events every interval, and right away while the
+// outbox has a backlog.
+func (d *Dispatcher) Run(interval time.Duration) {
+	for {
+		n, err := d.RunOnce()
+		if err != nil {
+			log.Println("webhooks:", err)
+		}
+		if err != nil || n < d.Batch {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// RunOnce makes an attempt for the deliveries due now and returns how
+// many there were.
+func (d *Dispatcher) RunOnce() (int, error) {
+	// every attempt of the batch may take the whole timeout
+	lease := time.Duration(d.Batch+1) * d.Client.Timeout
+	items, err := queries.ClaimWebhookDeliveries(d.Batch, lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, it := range items {
+		res := d.deliver(&it)
+		err = queries.FinishWebhookDelivery(res, d.retryIn(res))
+		if err != nil {
+			return len(items), err
+		}
+	}
+	return len(items), nil
+}
+
+// retryIn is when to make the next attempt of a delivery, 0 if it
+// succeeded or is given up on.
+func (d *Dispatcher) retryIn(res *models.WebhookDelivery) time.Duration {
+	if res.Error == "" || res.Attempt >= d.MaxAttempts {
+		return 0
+	}
+	return d.backoff(res.Attempt)
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	b := d.Backoff
+	for i := 1; i < attempt && b < d.MaxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.MaxBackoff {
+		b = d.MaxBackoff
+	}
+	return b
+}
+
+func (d *Dispatcher) deliver(it *models.WebhookOutboxItem) *models.WebhookDelivery {
+	res := &models.WebhookDelivery{
+		DeliveryID: it.DeliveryID,
+		WebhookID:  it.WebhookID,
+		Event:      it.Event,
+		Attempt:    it.Attempts + 1,
+	}
+
+	e := models.Event{}
+	err := e.UnmarshalJSON([]byte(it.Payload))
+	var body []byte
+	if err == nil {
+		e.ID = it.DeliveryID
+		body, err = e.MarshalJSON()
+	}
+	if err != nil {
+		// can't get better on retries
+		res.Attempt = d.MaxAttempts
+		res.Error = err.Error()
+		return res
+	}
+
+	req, err := http.NewRequest("POST", it.URL, bytes.NewReader(body))
+	if err != nil {
+		res.Attempt = d.MaxAttempts
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "forum-webhooks")
+	req.Header.Set(EventHeader, it.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(it.DeliveryID, 10))
+	req.Header.Set(SignatureHeader, Sign(it.Secret, body))
+
+	start := time.Now()
+	resp, err := d.Client.Do(req)
+	res.Duration = int(time.Since(start) / time.Millisecond)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	res.Status = &resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		res.Error = resp.Status
+	}
+	return res
+}
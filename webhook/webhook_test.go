@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ArtAndreev/ForumTP/models"
+)
+
+const testSecret = "s3cret"
+
+// receiver keeps the last request and answers with status.
+type receiver struct {
+	*httptest.Server
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	rc := &receiver{status: status}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.header = r.Header
+		rc.body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(rc.status)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func testItem(url string) *models.WebhookOutboxItem {
+	return &models.WebhookOutboxItem{
+		DeliveryID: 7,
+		WebhookID:  3,
+		Event:      models.EventThreadCreated,
+		Payload:    `{"type":"thread_created","forum":"f","thread":1,"data":{"id":1}}`,
+		Attempts:   1,
+		URL:        url,
+		Secret:     testSecret,
+	}
+}
+
+func TestDeliverSignsTheEvent(t *testing.T) {
+	rc := newReceiver(t, http.StatusNoContent)
+	res := NewDispatcher().deliver(testItem(rc.URL))
+	if res.Error != "" || res.Status == nil || *res.Status != http.StatusNoContent {
+		t.Fatalf("got delivery %+v", res)
+	}
+	if res.Attempt != 2 || res.DeliveryID != 7 || res.WebhookID != 3 {
+		t.Errorf("got delivery %+v, want attempt 2 of delivery 7 to webhook 3", res)
+	}
+
+	sig := rc.header.Get(SignatureHeader)
+	if !hmac.Equal([]byte(sig), []byte(Sign(testSecret, rc.body))) {
+		t.Errorf("signature %q does not match the body", sig)
+	}
+	if sig == Sign("other", rc.body) {
+		t.Error("signature does not depend on the secret")
+	}
+	if got := rc.header.Get(EventHeader); got != models.EventThreadCreated {
+		t.Errorf("got event header %q", got)
+	}
+	if got := rc.header.Get(DeliveryHeader); got != "7" {
+		t.Errorf("got delivery header %q", got)
+	}
+	e := models.Event{}
+	if err := e.UnmarshalJSON(rc.body); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 7 || e.Type != models.EventThreadCreated || e.Forum != "f" {
+		t.Errorf("got event %+v, want the payload with the delivery id", e)
+	}
+}
+
+func TestDeliverFailures(t *testing.T) {
+	rc := newReceiver(t, http.StatusServiceUnavailable)
+	d := NewDispatcher()
+	res := d.deliver(testItem(rc.URL))
+	if res.Error == "" || res.Status == nil || *res.Status != http.StatusServiceUnavailable {
+		t.Errorf("got delivery %+v, want a failed one with the status", res)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	res = d.deliver(testItem(closed.URL))
+	if res.Error == "" || res.Status != nil {
+		t.Errorf("got delivery %+v, want a failed one without a status", res)
+	}
+
+	bad := testItem(rc.URL)
+	bad.Payload = "{"
+	res = d.deliver(bad)
+	if res.Error == "" || res.Attempt != d.MaxAttempts {
+		t.Errorf("got delivery %+v, want one given up on", res)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	d := &Dispatcher{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	status := http.StatusInternalServerError
+	for _, tt := range []struct {
+		res  models.WebhookDelivery
+		want time.Duration
+	}{
+		{models.WebhookDelivery{Attempt: 1, Status: &status}, 0},
+		{models.WebhookDelivery{Attempt: 1, Error: "500"}, time.Second},
+		{models.WebhookDelivery{Attempt: 2, Error: "500"}, 2 * time.Second},
+		{models.WebhookDelivery{Attempt: 3, Error: "500"}, 4 * time.Second},
+		{models.WebhookDelivery{Attempt: 4, Error: "500"}, 5 * time.Second},
+		{models.WebhookDelivery{Attempt: 5, Error: "500"}, 0},
+	} {
+		if got := d.retryIn(&tt.res); got != tt.want {
+			t.Errorf("attempt %d, error %q: got retry in %v, want %v", tt.res.Attempt, tt.res.Error, got, tt.want)
+		}
+	}
+}